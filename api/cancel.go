@@ -0,0 +1,70 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"time"
+)
+
+// CancelChannel is the redis channel for cancellation events, queue workers
+// can subscribe to it to abort canceled tasks
+const CancelChannel = "task:cancel"
+
+type CancelRequest struct {
+	Reason string `json:"reason"`
+}
+
+type CancelEvent struct {
+	ID         string    `json:"id"`
+	ModelName  string    `json:"model_name"`
+	QueueID    string    `json:"queue_id"`
+	CanceledBy string    `json:"canceled_by"`
+	Reason     string    `json:"reason"`
+	CanceledAt time.Time `json:"canceled_at"`
+}
+
+func (server *Server) Cancel(ctx *gin.Context) {
+	var id URI
+	if err := ctx.BindUri(&id); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	// The request body is optional
+	var req CancelRequest
+	if ctx.Request.ContentLength > 0 {
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorResponse(err))
+			return
+		}
+	}
+	canceledBy := ctx.GetHeader("UID")
+	if canceledBy == "" {
+		canceledBy = "unknown"
+	}
+
+	task, err := server.updateTask(ctx, &UpdateRequest{
+		ID:         id.ID,
+		Status:     TaskStatusCanceled,
+		ErrorInfo:  req.Reason,
+		CanceledBy: canceledBy,
+	}, ctx.GetHeader("If-Match"))
+	if hasError(ctx, err) {
+		return
+	}
+
+	event := CancelEvent{
+		ID:         task.ID,
+		ModelName:  task.ModelName,
+		QueueID:    task.QueueID,
+		CanceledBy: canceledBy,
+		Reason:     req.Reason,
+		CanceledAt: time.Now(),
+	}
+	// The task is already canceled, so a failed notification is only logged
+	if err = server.cache.Publish(CancelChannel, event); err != nil {
+		log.Error().Msgf("failed to publish the cancellation of task %s: %v", task.ID, err)
+	}
+	ctx.Header("ETag", task.ETag())
+	ctx.JSON(http.StatusOK, newTaskV1(task))
+}
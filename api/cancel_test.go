@@ -0,0 +1,143 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/HyperGAI/serving-webhook/storage"
+	mockstore "github.com/HyperGAI/serving-webhook/storage/mock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCancel(t *testing.T) {
+	pending := TaskInfo{
+		ID:        "12345",
+		ModelName: "test_model",
+		Status:    TaskStatusRunning,
+		QueueID:   "1234",
+		Version:   2,
+	}
+	succeeded := pending
+	succeeded.Status = TaskStatusSucceeded
+
+	testCases := []struct {
+		name          string
+		body          gin.H
+		buildStubs    func(cache *mockstore.MockCache)
+		checkResponse func(recoder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			body: gin.H{"reason": "not needed"},
+			buildStubs: func(cache *mockstore.MockCache) {
+				data, _ := json.Marshal(pending)
+				cache.EXPECT().
+					UpdateKey(gomock.Eq("12345"), gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(updateKeyWith(string(data)))
+				cache.EXPECT().
+					Publish(gomock.Eq(CancelChannel), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(channel string, message interface{}) error {
+						event := message.(CancelEvent)
+						require.Equal(t, "12345", event.ID)
+						require.Equal(t, "1234", event.QueueID)
+						require.Equal(t, "user", event.CanceledBy)
+						require.Equal(t, "not needed", event.Reason)
+						return nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				var task TaskInfo
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &task))
+				require.Equal(t, TaskStatusCanceled, task.Status)
+				require.Equal(t, "user", task.CanceledBy)
+				require.Equal(t, "not needed", task.ErrorInfo)
+				require.Equal(t, int64(3), task.Version)
+			},
+		},
+		{
+			name: "Publish failed",
+			buildStubs: func(cache *mockstore.MockCache) {
+				data, _ := json.Marshal(pending)
+				cache.EXPECT().
+					UpdateKey(gomock.Eq("12345"), gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(updateKeyWith(string(data)))
+				cache.EXPECT().
+					Publish(gomock.Eq(CancelChannel), gomock.Any()).
+					Times(1).
+					Return(errors.New("redis error"))
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "Already finished",
+			buildStubs: func(cache *mockstore.MockCache) {
+				data, _ := json.Marshal(succeeded)
+				cache.EXPECT().
+					UpdateKey(gomock.Eq("12345"), gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(updateKeyWith(string(data)))
+				cache.EXPECT().
+					Publish(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusConflict, recorder.Code)
+			},
+		},
+		{
+			name: "Task not found",
+			buildStubs: func(cache *mockstore.MockCache) {
+				cache.EXPECT().
+					UpdateKey(gomock.Eq("12345"), gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(storage.ErrKeyNotFound)
+				cache.EXPECT().
+					Publish(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			cache := mockstore.NewMockCache(ctrl)
+			tc.buildStubs(cache)
+			cache.EXPECT().Publish(gomock.Any(), gomock.Any()).AnyTimes().Return(nil)
+
+			server := newTestServer(t, nil, cache, nil)
+			recorder := httptest.NewRecorder()
+
+			body := bytes.NewReader(nil)
+			if tc.body != nil {
+				data, err := json.Marshal(tc.body)
+				require.NoError(t, err)
+				body = bytes.NewReader(data)
+			}
+			request, err := http.NewRequest(http.MethodPost, "/task/12345/cancel", body)
+			require.NoError(t, err)
+			request.Header.Set("UID", "user")
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
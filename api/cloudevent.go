@@ -0,0 +1,374 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CloudEvents 1.0 over HTTP, see https://github.com/cloudevents/spec/blob/v1.0.2/cloudevents/bindings/http-protocol-binding.md
+const (
+	CloudEventsModeStructured = "structured"
+	CloudEventsModeBinary     = "binary"
+
+	cloudEventsSpecVersion      = "1.0"
+	cloudEventsContentType      = "application/cloudevents+json"
+	cloudEventsHeaderPrefix     = "Ce-"
+	cloudEventsDefaultSource    = "serving-webhook"
+	cloudEventsMaxBodySize      = 10 << 20 // 10 MiB
+	cloudEventTypePrefix        = "com.hypergai.serving.task."
+	cloudEventTypeTaskUpdate    = "com.hypergai.serving.task.update"
+	cloudEventTypeKServeRequest = "org.kubeflow.serving.inference.request"
+	cloudEventTypeKServeReply   = "org.kubeflow.serving.inference.response"
+	cloudEventTaskIDExtension   = "taskid"
+)
+
+var errInvalidCloudEvent = errors.New("invalid cloud event")
+
+// CloudEvent holds the context attributes and the data of an event.
+// Extensions are the attributes not defined by the spec, which must be strings here.
+type CloudEvent struct {
+	SpecVersion     string            `json:"specversion"`
+	ID              string            `json:"id"`
+	Source          string            `json:"source"`
+	Type            string            `json:"type"`
+	Subject         string            `json:"subject,omitempty"`
+	Time            *time.Time        `json:"time,omitempty"`
+	DataContentType string            `json:"datacontenttype,omitempty"`
+	Data            json.RawMessage   `json:"data,omitempty"`
+	Extensions      map[string]string `json:"-"`
+}
+
+var cloudEventAttributes = map[string]bool{
+	"specversion":     true,
+	"id":              true,
+	"source":          true,
+	"type":            true,
+	"subject":         true,
+	"time":            true,
+	"datacontenttype": true,
+	"dataschema":      true,
+	"data":            true,
+	"data_base64":     true,
+}
+
+func (event *CloudEvent) validate() error {
+	if event.SpecVersion != cloudEventsSpecVersion {
+		return fmt.Errorf("%w: unsupported specversion %q", errInvalidCloudEvent, event.SpecVersion)
+	}
+	if event.ID == "" || event.Source == "" || event.Type == "" {
+		return fmt.Errorf("%w: id, source and type are required", errInvalidCloudEvent)
+	}
+	return nil
+}
+
+// MarshalJSON encodes the event in the structured mode, with the extensions as top-level attributes
+func (event CloudEvent) MarshalJSON() ([]byte, error) {
+	type attributes CloudEvent
+	data, err := json.Marshal(attributes(event))
+	if err != nil || len(event.Extensions) == 0 {
+		return data, err
+	}
+	var fields map[string]interface{}
+	if err = json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for key, value := range event.Extensions {
+		fields[key] = value
+	}
+	return json.Marshal(fields)
+}
+
+// UnmarshalJSON decodes an event in the structured mode, data_base64 is decoded into Data
+func (event *CloudEvent) UnmarshalJSON(data []byte) error {
+	type attributes CloudEvent
+	var e attributes
+	if err := json.Unmarshal(data, &e); err != nil {
+		return err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	*event = CloudEvent(e)
+	if raw, ok := fields["data_base64"]; ok && event.Data == nil {
+		var encoded string
+		if err := json.Unmarshal(raw, &encoded); err != nil {
+			return err
+		}
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return err
+		}
+		event.Data = decoded
+	}
+	for key, raw := range fields {
+		if cloudEventAttributes[key] {
+			continue
+		}
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			value = string(raw)
+		}
+		if event.Extensions == nil {
+			event.Extensions = make(map[string]string)
+		}
+		event.Extensions[key] = value
+	}
+	return nil
+}
+
+// newCloudEventRequest creates the HTTP request for sending an event in the structured or binary mode
+func newCloudEventRequest(ctx context.Context, url string, mode string, event *CloudEvent) (*http.Request, error) {
+	if mode == CloudEventsModeStructured {
+		body, err := json.Marshal(event)
+		if err != nil {
+			return nil, err
+		}
+		request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Set("Content-Type", cloudEventsContentType+"; charset=utf-8")
+		return request, nil
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(event.Data))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set(cloudEventsHeaderPrefix+"Specversion", event.SpecVersion)
+	request.Header.Set(cloudEventsHeaderPrefix+"Id", event.ID)
+	request.Header.Set(cloudEventsHeaderPrefix+"Source", event.Source)
+	request.Header.Set(cloudEventsHeaderPrefix+"Type", event.Type)
+	if event.Subject != "" {
+		request.Header.Set(cloudEventsHeaderPrefix+"Subject", event.Subject)
+	}
+	if event.Time != nil {
+		request.Header.Set(cloudEventsHeaderPrefix+"Time", event.Time.Format(time.RFC3339Nano))
+	}
+	for key, value := range event.Extensions {
+		request.Header.Set(cloudEventsHeaderPrefix+key, value)
+	}
+	if event.DataContentType != "" {
+		request.Header.Set("Content-Type", event.DataContentType)
+	}
+	return request, nil
+}
+
+// parseCloudEvent reads an event from a request in the structured or binary mode
+func parseCloudEvent(request *http.Request) (*CloudEvent, error) {
+	body, err := io.ReadAll(request.Body)
+	if err != nil {
+		return nil, err
+	}
+	mediaType, _, _ := mime.ParseMediaType(request.Header.Get("Content-Type"))
+
+	var event CloudEvent
+	if mediaType == cloudEventsContentType {
+		if err = json.Unmarshal(body, &event); err != nil {
+			return nil, fmt.Errorf("%w: %v", errInvalidCloudEvent, err)
+		}
+	} else {
+		for key, values := range request.Header {
+			if !strings.HasPrefix(key, cloudEventsHeaderPrefix) || len(values) == 0 {
+				continue
+			}
+			value := values[0]
+			switch name := strings.ToLower(strings.TrimPrefix(key, cloudEventsHeaderPrefix)); name {
+			case "specversion":
+				event.SpecVersion = value
+			case "id":
+				event.ID = value
+			case "source":
+				event.Source = value
+			case "type":
+				event.Type = value
+			case "subject":
+				event.Subject = value
+			case "time":
+				t, err := time.Parse(time.RFC3339Nano, value)
+				if err != nil {
+					return nil, fmt.Errorf("%w: invalid time %q", errInvalidCloudEvent, value)
+				}
+				event.Time = &t
+			default:
+				if event.Extensions == nil {
+					event.Extensions = make(map[string]string)
+				}
+				event.Extensions[name] = value
+			}
+		}
+		event.DataContentType = request.Header.Get("Content-Type")
+		if len(body) > 0 {
+			event.Data = body
+		}
+	}
+	if err = event.validate(); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// cloudEventType returns the type of the cloud event for a task event, the terminal
+// statuses have their own types, e.g. com.hypergai.serving.task.succeeded
+func cloudEventType(eventType string, task *TaskInfo) string {
+	if eventType == TaskEventUpdated && isTerminalStatus(task.Status) {
+		return cloudEventTypePrefix + task.Status
+	}
+	return cloudEventTypePrefix + eventType
+}
+
+func (server *Server) cloudEventsSource() string {
+	if server.config.CloudEventsSource != "" {
+		return server.config.CloudEventsSource
+	}
+	return cloudEventsDefaultSource
+}
+
+// newTaskCloudEvent converts a task event into a cloud event, whose id is unique
+// for each version of the task
+func (server *Server) newTaskCloudEvent(eventType string, task *TaskInfo) (*CloudEvent, error) {
+	data, err := json.Marshal(newTaskV1(task))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	return &CloudEvent{
+		SpecVersion:     cloudEventsSpecVersion,
+		ID:              task.ID + "-" + strconv.FormatInt(task.Version, 10),
+		Source:          server.cloudEventsSource(),
+		Type:            cloudEventType(eventType, task),
+		Subject:         task.ID,
+		Time:            &now,
+		DataContentType: "application/json",
+		Data:            data,
+	}, nil
+}
+
+// emitCloudEvent sends the event to K_SINK in the background if it is set
+func (server *Server) emitCloudEvent(event *CloudEvent) {
+	if server.config.CloudEventsSink == "" {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), server.cloudEventClient.Timeout)
+		defer cancel()
+		if err := server.sendCloudEvent(ctx, event); err != nil {
+			log.Error().Msgf("failed to send cloud event %s: %v", event.ID, err)
+		}
+	}()
+}
+
+func (server *Server) sendCloudEvent(ctx context.Context, event *CloudEvent) error {
+	mode := server.config.CloudEventsMode
+	if mode == "" {
+		mode = CloudEventsModeBinary
+	}
+	request, err := newCloudEventRequest(ctx, server.config.CloudEventsSink, mode, event)
+	if err != nil {
+		return err
+	}
+	response, err := server.cloudEventClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("sink responded with status %d", response.StatusCode)
+	}
+	return nil
+}
+
+// updateRequestFromCloudEvent maps an ingested event to a task update. The task ID is
+// the subject, the taskid extension, or the event id for the KServe inference logger,
+// which uses the X-Request-Id of the prediction as the event id.
+func updateRequestFromCloudEvent(event *CloudEvent) (*UpdateRequest, error) {
+	taskID := event.Subject
+	if taskID == "" {
+		taskID = event.Extensions[cloudEventTaskIDExtension]
+	}
+
+	var req UpdateRequest
+	switch event.Type {
+	case cloudEventTypeTaskUpdate:
+		if len(event.Data) > 0 {
+			if err := json.Unmarshal(event.Data, &req); err != nil {
+				return nil, fmt.Errorf("%w: %v", errInvalidCloudEvent, err)
+			}
+		}
+		// The ingested updates always go through redis
+		req.DatabaseOnly = false
+	case cloudEventTypeKServeRequest, cloudEventTypeKServeReply:
+		if taskID == "" {
+			taskID = event.ID
+		}
+		req.Status = TaskStatusRunning
+		if event.Type == cloudEventTypeKServeReply {
+			req.Status = TaskStatusSucceeded
+			if len(event.Data) > 0 {
+				var outputs interface{}
+				if err := json.Unmarshal(event.Data, &outputs); err != nil {
+					return nil, fmt.Errorf("%w: the data is not JSON: %v", errInvalidCloudEvent, err)
+				}
+				req.Outputs = outputs
+			}
+		}
+	default:
+		return nil, fmt.Errorf("%w: unsupported type %q", errInvalidCloudEvent, event.Type)
+	}
+	if taskID != "" {
+		req.ID = taskID
+	}
+	if req.ID == "" {
+		return nil, fmt.Errorf("%w: no task id in the subject, taskid or data", errInvalidCloudEvent)
+	}
+	return &req, nil
+}
+
+/*
+curl -X POST http://localhost:12000/cloudevents \
+  -H "Ce-Specversion: 1.0" -H "Ce-Id: 1" -H "Ce-Source: test" \
+  -H "Ce-Type: com.hypergai.serving.task.update" -H "Ce-Subject: <TASK_ID>" \
+  -H "Content-Type: application/json" -d '{"status": "running"}'
+*/
+
+// IngestCloudEvent updates a task from a cloud event in the structured or binary mode.
+// Redelivered events are accepted, i.e., moving a task into its current terminal status
+// is not an error.
+func (server *Server) IngestCloudEvent(ctx *gin.Context) {
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, cloudEventsMaxBodySize)
+	event, err := parseCloudEvent(ctx.Request)
+	if hasError(ctx, err) {
+		return
+	}
+	req, err := updateRequestFromCloudEvent(event)
+	if hasError(ctx, err) {
+		return
+	}
+	if req.Status != "" && hasError(ctx, validateStatus(req.Status)) {
+		return
+	}
+	task, err := server.updateTask(ctx, req, "")
+	if errors.Is(err, errInvalidTransition) {
+		if current, e := server.getTask(ctx, req.ID); e == nil && current.Status == req.Status {
+			ctx.JSON(http.StatusOK, newTaskV1(current))
+			return
+		}
+	}
+	if hasError(ctx, err) {
+		return
+	}
+	ctx.JSON(http.StatusOK, newTaskV1(task))
+}
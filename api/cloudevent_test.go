@@ -0,0 +1,227 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/HyperGAI/serving-webhook/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCloudEventModes(t *testing.T) {
+	now := time.Date(2023, 11, 1, 12, 0, 0, 0, time.UTC)
+	event := &CloudEvent{
+		SpecVersion:     cloudEventsSpecVersion,
+		ID:              "12345-2",
+		Source:          "test",
+		Type:            cloudEventTypePrefix + TaskEventUpdated,
+		Subject:         "12345",
+		Time:            &now,
+		DataContentType: "application/json",
+		Data:            json.RawMessage(`{"id":"12345","status":"running"}`),
+		Extensions:      map[string]string{"traceparent": "00-abc-def-01"},
+	}
+	for _, mode := range []string{CloudEventsModeStructured, CloudEventsModeBinary} {
+		t.Run(mode, func(t *testing.T) {
+			request, err := newCloudEventRequest(context.Background(), "http://localhost", mode, event)
+			require.NoError(t, err)
+			if mode == CloudEventsModeBinary {
+				require.Equal(t, "12345-2", request.Header.Get("Ce-Id"))
+				require.Equal(t, "application/json", request.Header.Get("Content-Type"))
+			} else {
+				require.Contains(t, request.Header.Get("Content-Type"), cloudEventsContentType)
+			}
+			parsed, err := parseCloudEvent(request)
+			require.NoError(t, err)
+			require.Equal(t, event.ID, parsed.ID)
+			require.Equal(t, event.Source, parsed.Source)
+			require.Equal(t, event.Type, parsed.Type)
+			require.Equal(t, event.Subject, parsed.Subject)
+			require.True(t, event.Time.Equal(*parsed.Time))
+			require.Equal(t, event.Extensions, parsed.Extensions)
+			require.JSONEq(t, string(event.Data), string(parsed.Data))
+		})
+	}
+}
+
+func TestParseCloudEvent(t *testing.T) {
+	testCases := []struct {
+		name    string
+		header  map[string]string
+		body    string
+		checkFn func(event *CloudEvent, err error)
+	}{
+		{
+			name:   "Base64 data",
+			header: map[string]string{"Content-Type": "application/cloudevents+json"},
+			body:   `{"specversion":"1.0","id":"1","source":"test","type":"test","data_base64":"eyJhIjoxfQ=="}`,
+			checkFn: func(event *CloudEvent, err error) {
+				require.NoError(t, err)
+				require.JSONEq(t, `{"a":1}`, string(event.Data))
+			},
+		},
+		{
+			name:   "Missing attributes",
+			header: map[string]string{"Content-Type": "application/cloudevents+json"},
+			body:   `{"specversion":"1.0","id":"1"}`,
+			checkFn: func(event *CloudEvent, err error) {
+				require.ErrorIs(t, err, errInvalidCloudEvent)
+			},
+		},
+		{
+			name:   "Unsupported version",
+			header: map[string]string{"Ce-Specversion": "0.3", "Ce-Id": "1", "Ce-Source": "test", "Ce-Type": "test"},
+			checkFn: func(event *CloudEvent, err error) {
+				require.ErrorIs(t, err, errInvalidCloudEvent)
+			},
+		},
+		{
+			name:   "Not a cloud event",
+			header: map[string]string{"Content-Type": "application/json"},
+			body:   `{"id":"12345"}`,
+			checkFn: func(event *CloudEvent, err error) {
+				require.ErrorIs(t, err, errInvalidCloudEvent)
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			request, err := http.NewRequest(http.MethodPost, "/cloudevents", bytes.NewReader([]byte(tc.body)))
+			require.NoError(t, err)
+			for key, value := range tc.header {
+				request.Header.Set(key, value)
+			}
+			tc.checkFn(parseCloudEvent(request))
+		})
+	}
+}
+
+func TestIngestCloudEvent(t *testing.T) {
+	server := newTestServer(t, nil, storage.NewMemoryCache(), nil)
+	sendRequest := func(method string, url string, header map[string]string, body []byte) *httptest.ResponseRecorder {
+		request, err := http.NewRequest(method, url, bytes.NewReader(body))
+		require.NoError(t, err)
+		for key, value := range header {
+			request.Header.Set(key, value)
+		}
+		recorder := httptest.NewRecorder()
+		server.router.ServeHTTP(recorder, request)
+		return recorder
+	}
+	data, err := json.Marshal(gin.H{"id": "12345", "model_name": "test_model"})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, sendRequest(http.MethodPost, "/task", nil, data).Code)
+
+	// Binary mode with the task id in the subject
+	recorder := sendRequest(http.MethodPost, "/cloudevents", map[string]string{
+		"Ce-Specversion": "1.0",
+		"Ce-Id":          "1",
+		"Ce-Source":      "test",
+		"Ce-Type":        cloudEventTypeTaskUpdate,
+		"Ce-Subject":     "12345",
+		"Content-Type":   "application/json",
+	}, []byte(`{"status":"running","queue_id":"q1"}`))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var task TaskInfo
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &task))
+	require.Equal(t, TaskStatusRunning, task.Status)
+	require.Equal(t, "q1", task.QueueID)
+
+	// Structured mode from the KServe inference logger, and its redelivery
+	event, err := json.Marshal(gin.H{
+		"specversion": "1.0",
+		"id":          "12345",
+		"source":      "http://localhost:9081/",
+		"type":        cloudEventTypeKServeReply,
+		"data":        gin.H{"predictions": []int{1}},
+	})
+	require.NoError(t, err)
+	header := map[string]string{"Content-Type": cloudEventsContentType}
+	for i := 0; i < 2; i++ {
+		recorder = sendRequest(http.MethodPost, "/cloudevents", header, event)
+		require.Equal(t, http.StatusOK, recorder.Code)
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &task))
+		require.Equal(t, TaskStatusSucceeded, task.Status)
+		require.Equal(t, map[string]interface{}{"predictions": []interface{}{float64(1)}}, task.Outputs)
+		require.Equal(t, int64(3), task.Version)
+	}
+
+	// A terminal task cannot be moved into another status
+	event, err = json.Marshal(gin.H{
+		"specversion": "1.0",
+		"id":          "2",
+		"source":      "test",
+		"type":        cloudEventTypeTaskUpdate,
+		"taskid":      "12345",
+		"data":        gin.H{"status": "failed"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusConflict, sendRequest(http.MethodPost, "/cloudevents", header, event).Code)
+
+	event, err = json.Marshal(gin.H{"specversion": "1.0", "id": "3", "source": "test", "type": "unknown", "subject": "12345"})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadRequest, sendRequest(http.MethodPost, "/cloudevents", header, event).Code)
+
+	event, err = json.Marshal(gin.H{"specversion": "1.0", "id": "4", "source": "test", "type": cloudEventTypeKServeRequest})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNotFound, sendRequest(http.MethodPost, "/cloudevents", header, event).Code)
+
+	// A body over the limit is refused instead of being truncated
+	recorder = sendRequest(http.MethodPost, "/cloudevents", map[string]string{
+		"Ce-Specversion": "1.0",
+		"Ce-Id":          "5",
+		"Ce-Source":      "test",
+		"Ce-Type":        cloudEventTypeTaskUpdate,
+		"Ce-Subject":     "12345",
+		"Content-Type":   "application/json",
+	}, bytes.Repeat([]byte(" "), cloudEventsMaxBodySize+1))
+	require.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+	require.Contains(t, recorder.Body.String(), "body_too_large")
+}
+
+func TestEmitCloudEvent(t *testing.T) {
+	events := make(chan *CloudEvent, 10)
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		event, err := parseCloudEvent(r)
+		require.NoError(t, err)
+		events <- event
+	}))
+	defer sink.Close()
+
+	server := newTestServer(t, nil, storage.NewMemoryCache(), nil)
+	server.config.CloudEventsSink = sink.URL
+	receive := func() *CloudEvent {
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "no cloud event is sent")
+		}
+		return nil
+	}
+
+	task := &TaskInfo{ID: "12345", Status: TaskStatusPending, Version: 1}
+	server.publishTaskEvent(TaskEventCreated, nil, task)
+	event := receive()
+	require.Equal(t, cloudEventTypePrefix+TaskEventCreated, event.Type)
+	require.Equal(t, "12345-1", event.ID)
+	require.Equal(t, "12345", event.Subject)
+	require.Equal(t, cloudEventsDefaultSource, event.Source)
+
+	server.config.CloudEventsMode = CloudEventsModeStructured
+	previous := *task
+	task.Status = TaskStatusFailed
+	task.Version = 2
+	server.publishTaskEvent(TaskEventUpdated, &previous, task)
+	event = receive()
+	require.Equal(t, cloudEventTypePrefix+TaskStatusFailed, event.Type)
+	require.Equal(t, "12345-2", event.ID)
+	var data TaskInfo
+	require.NoError(t, json.Unmarshal(event.Data, &data))
+	require.Equal(t, *task, data)
+}
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	db "github.com/HyperGAI/serving-webhook/db/sqlc"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"time"
+)
+
+const webhookSecretSize = 32
+
+var errDeliveryNotFound = errors.New("webhook delivery not found")
+
+type DeliveryURI struct {
+	ID         string `uri:"id" binding:"required"`
+	DeliveryID int64  `uri:"delivery_id" binding:"required,min=1"`
+}
+
+// DeliveryAttempt is one attempt in the delivery log
+type DeliveryAttempt struct {
+	Attempt    int32     `json:"attempt"`
+	StatusCode int32     `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Delivery is a queued webhook callback of a task and its attempts
+type Delivery struct {
+	ID            int64             `json:"id"`
+	TaskID        string            `json:"task_id"`
+	URL           string            `json:"url"`
+	Event         string            `json:"event"`
+	Status        string            `json:"status"`
+	Attempts      int32             `json:"attempts"`
+	NextAttemptAt *time.Time        `json:"next_attempt_at,omitempty"`
+	LastError     string            `json:"last_error,omitempty"`
+	CreatedAt     time.Time         `json:"created_at"`
+	UpdatedAt     time.Time         `json:"updated_at"`
+	History       []DeliveryAttempt `json:"history"`
+}
+
+func deliveryFromRecord(record db.WebhookDelivery) Delivery {
+	delivery := Delivery{
+		ID:        record.ID,
+		TaskID:    record.TaskID,
+		URL:       record.Url,
+		Event:     record.Event,
+		Status:    record.Status,
+		Attempts:  record.Attempts,
+		LastError: record.LastError.String,
+		CreatedAt: record.CreatedAt,
+		UpdatedAt: record.UpdatedAt,
+		History:   make([]DeliveryAttempt, 0),
+	}
+	if record.Status == DeliveryStatusPending {
+		nextAttemptAt := record.NextAttemptAt
+		delivery.NextAttemptAt = &nextAttemptAt
+	}
+	return delivery
+}
+
+/*
+curl http://localhost:12000/task/<TASK_ID>/deliveries
+*/
+
+// ListDeliveries returns the webhook deliveries of a task with their attempts
+func (server *Server) ListDeliveries(ctx *gin.Context) {
+	var id URI
+	if err := ctx.BindUri(&id); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	records, err := server.database.ListWebhookDeliveriesByTask(ctx, id.ID)
+	if hasError(ctx, err) {
+		return
+	}
+	attempts, err := server.database.ListWebhookAttemptsByTask(ctx, id.ID)
+	if hasError(ctx, err) {
+		return
+	}
+
+	deliveries := make([]Delivery, 0, len(records))
+	index := make(map[int64]int, len(records))
+	for i, record := range records {
+		deliveries = append(deliveries, deliveryFromRecord(record))
+		index[record.ID] = i
+	}
+	for _, attempt := range attempts {
+		i, ok := index[attempt.DeliveryID]
+		if !ok {
+			continue
+		}
+		deliveries[i].History = append(deliveries[i].History, DeliveryAttempt{
+			Attempt:    attempt.Attempt,
+			StatusCode: attempt.StatusCode.Int32,
+			Error:      attempt.Error.String,
+			DurationMs: attempt.DurationMs,
+			CreatedAt:  attempt.CreatedAt,
+		})
+	}
+	ctx.JSON(http.StatusOK, gin.H{"deliveries": deliveries})
+}
+
+/*
+curl -X POST http://localhost:12000/task/<TASK_ID>/deliveries/<DELIVERY_ID>/redeliver
+*/
+
+// Redeliver queues a new delivery with the same payload as an existing one
+func (server *Server) Redeliver(ctx *gin.Context) {
+	var uri DeliveryURI
+	if err := ctx.BindUri(&uri); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	record, err := server.database.GetWebhookDelivery(ctx, uri.DeliveryID)
+	if err == nil && record.TaskID != uri.ID {
+		err = db.ErrRecordNotFound
+	}
+	if errors.Is(err, db.ErrRecordNotFound) {
+		err = fmt.Errorf("%w: %d of task %s", errDeliveryNotFound, uri.DeliveryID, uri.ID)
+	}
+	if hasError(ctx, err) {
+		return
+	}
+	record, err = server.database.CreateWebhookDelivery(ctx, db.CreateWebhookDeliveryParams{
+		TaskID:  record.TaskID,
+		UserID:  record.UserID,
+		Url:     record.Url,
+		Event:   record.Event,
+		Payload: record.Payload,
+	})
+	if hasError(ctx, err) {
+		return
+	}
+	server.wakeWebhookWorker()
+	ctx.JSON(http.StatusAccepted, deliveryFromRecord(record))
+}
+
+/*
+curl -X POST http://localhost:12000/webhook/secret -H "UID: <USER_ID>"
+*/
+
+// RotateWebhookSecret generates a new secret for signing the callbacks of the user
+// in the UID header. The secret is only returned once.
+func (server *Server) RotateWebhookSecret(ctx *gin.Context) {
+	userID := ctx.GetHeader("UID")
+	if userID == "" {
+		ctx.JSON(http.StatusBadRequest, errorResponse(errors.New("the UID header is required")))
+		return
+	}
+	data := make([]byte, webhookSecretSize)
+	if _, err := rand.Read(data); err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	secret, err := server.database.UpsertWebhookSecret(ctx, db.UpsertWebhookSecretParams{
+		UserID: userID,
+		Secret: hex.EncodeToString(data),
+	})
+	if hasError(ctx, err) {
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"user_id": secret.UserID, "secret": secret.Secret})
+}
@@ -0,0 +1,188 @@
+package api
+
+import (
+	"encoding/json"
+	mockdb "github.com/HyperGAI/serving-webhook/db/mock"
+	db "github.com/HyperGAI/serving-webhook/db/sqlc"
+	mockstore "github.com/HyperGAI/serving-webhook/storage/mock"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestListDeliveries(t *testing.T) {
+	deliveries := []db.WebhookDelivery{
+		{ID: 1, TaskID: "12345", Url: "https://example.com", Event: "succeeded", Status: DeliveryStatusFailed, Attempts: 2},
+		{ID: 2, TaskID: "12345", Url: "https://example.com", Event: "succeeded", Status: DeliveryStatusPending,
+			NextAttemptAt: time.Now()},
+	}
+	attempts := []db.WebhookAttempt{
+		{DeliveryID: 1, TaskID: "12345", Attempt: 1, Error: pgtype.Text{String: "timeout", Valid: true}},
+		{DeliveryID: 1, TaskID: "12345", Attempt: 2, StatusCode: pgtype.Int4{Int32: 500, Valid: true}},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	database := mockdb.NewMockStore(ctrl)
+	server := newTestServer(t, nil, mockstore.NewMockCache(ctrl), database)
+	database.EXPECT().
+		ListWebhookDeliveriesByTask(gomock.Any(), gomock.Eq("12345")).
+		Times(1).
+		Return(deliveries, nil)
+	database.EXPECT().
+		ListWebhookAttemptsByTask(gomock.Any(), gomock.Eq("12345")).
+		Times(1).
+		Return(attempts, nil)
+
+	request, err := http.NewRequest(http.MethodGet, "/task/12345/deliveries", nil)
+	require.NoError(t, err)
+	recorder := httptest.NewRecorder()
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var res struct {
+		Deliveries []Delivery `json:"deliveries"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &res))
+	require.Len(t, res.Deliveries, 2)
+	require.Len(t, res.Deliveries[0].History, 2)
+	require.Equal(t, "timeout", res.Deliveries[0].History[0].Error)
+	require.Equal(t, int32(500), res.Deliveries[0].History[1].StatusCode)
+	require.Nil(t, res.Deliveries[0].NextAttemptAt)
+	require.Empty(t, res.Deliveries[1].History)
+	require.NotNil(t, res.Deliveries[1].NextAttemptAt)
+}
+
+func TestRedeliver(t *testing.T) {
+	delivery := db.WebhookDelivery{
+		ID:      1,
+		TaskID:  "12345",
+		UserID:  pgtype.Text{String: "user", Valid: true},
+		Url:     "https://example.com",
+		Event:   "succeeded",
+		Payload: []byte(`{"id":"12345"}`),
+		Status:  DeliveryStatusFailed,
+	}
+
+	testCases := []struct {
+		name          string
+		url           string
+		buildStubs    func(database *mockdb.MockStore)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			url:  "/task/12345/deliveries/1/redeliver",
+			buildStubs: func(database *mockdb.MockStore) {
+				database.EXPECT().
+					GetWebhookDelivery(gomock.Any(), gomock.Eq(int64(1))).
+					Times(1).
+					Return(delivery, nil)
+				database.EXPECT().
+					CreateWebhookDelivery(gomock.Any(), gomock.Eq(db.CreateWebhookDeliveryParams{
+						TaskID:  delivery.TaskID,
+						UserID:  delivery.UserID,
+						Url:     delivery.Url,
+						Event:   delivery.Event,
+						Payload: delivery.Payload,
+					})).
+					Times(1).
+					Return(db.WebhookDelivery{ID: 2, TaskID: "12345", Status: DeliveryStatusPending}, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusAccepted, recorder.Code)
+				var res Delivery
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &res))
+				require.Equal(t, int64(2), res.ID)
+				require.Equal(t, DeliveryStatusPending, res.Status)
+			},
+		},
+		{
+			name: "Other task",
+			url:  "/task/67890/deliveries/1/redeliver",
+			buildStubs: func(database *mockdb.MockStore) {
+				database.EXPECT().
+					GetWebhookDelivery(gomock.Any(), gomock.Eq(int64(1))).
+					Times(1).
+					Return(delivery, nil)
+				database.EXPECT().CreateWebhookDelivery(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name: "Not found",
+			url:  "/task/12345/deliveries/3/redeliver",
+			buildStubs: func(database *mockdb.MockStore) {
+				database.EXPECT().
+					GetWebhookDelivery(gomock.Any(), gomock.Eq(int64(3))).
+					Times(1).
+					Return(db.WebhookDelivery{}, db.ErrRecordNotFound)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name: "Invalid ID",
+			url:  "/task/12345/deliveries/abc/redeliver",
+			buildStubs: func(database *mockdb.MockStore) {
+				database.EXPECT().GetWebhookDelivery(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			database := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(database)
+			server := newTestServer(t, nil, mockstore.NewMockCache(ctrl), database)
+
+			request, err := http.NewRequest(http.MethodPost, tc.url, nil)
+			require.NoError(t, err)
+			recorder := httptest.NewRecorder()
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func TestRotateWebhookSecret(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	database := mockdb.NewMockStore(ctrl)
+	server := newTestServer(t, nil, mockstore.NewMockCache(ctrl), database)
+
+	request, err := http.NewRequest(http.MethodPost, "/webhook/secret", nil)
+	require.NoError(t, err)
+	recorder := httptest.NewRecorder()
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	database.EXPECT().
+		UpsertWebhookSecret(gomock.Any(), gomock.Any()).
+		Times(1).
+		DoAndReturn(func(_ interface{}, arg db.UpsertWebhookSecretParams) (db.WebhookSecret, error) {
+			require.Equal(t, "user", arg.UserID)
+			require.Len(t, arg.Secret, 2*webhookSecretSize)
+			return db.WebhookSecret{UserID: arg.UserID, Secret: arg.Secret}, nil
+		})
+	request, err = http.NewRequest(http.MethodPost, "/webhook/secret", nil)
+	require.NoError(t, err)
+	request.Header.Set("UID", "user")
+	recorder = httptest.NewRecorder()
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Contains(t, recorder.Body.String(), `"user_id":"user"`)
+}
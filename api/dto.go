@@ -0,0 +1,68 @@
+package api
+
+import (
+	db "github.com/HyperGAI/serving-webhook/db/sqlc"
+	"time"
+)
+
+// TaskAPIVersion is the version of the task representation returned by the API
+const TaskAPIVersion = "v1"
+
+// TaskV1 is the public representation of a task, which is returned by every task
+// endpoint and sent in the events and the webhook callbacks. It is decoupled from
+// TaskInfo stored in redis and db.Task stored in the database, so that the storage
+// formats can change without breaking the clients. A change that isn't backward
+// compatible needs a new version.
+type TaskV1 struct {
+	APIVersion    string      `json:"api_version"`
+	ID            string      `json:"id"`
+	UserID        string      `json:"user_id"`
+	ModelName     string      `json:"model_name"`
+	ModelVersion  string      `json:"model_version"`
+	Status        string      `json:"status"`
+	RunningTime   string      `json:"running_time"`
+	CreatedAt     time.Time   `json:"created_at"`
+	UpdatedAt     *time.Time  `json:"updated_at,omitempty"`
+	Outputs       interface{} `json:"outputs"`
+	ErrorInfo     string      `json:"error_info"`
+	QueueNum      int         `json:"queue_num"`
+	QueueID       string      `json:"queue_id"`
+	Version       int64       `json:"version"`
+	CanceledBy    string      `json:"canceled_by"`
+	WebhookURL    string      `json:"webhook_url,omitempty"`
+	WebhookEvents []string    `json:"webhook_events,omitempty"`
+}
+
+// newTaskV1 converts the task info in redis to the public representation
+func newTaskV1(task *TaskInfo) TaskV1 {
+	res := TaskV1{
+		APIVersion:    TaskAPIVersion,
+		ID:            task.ID,
+		UserID:        task.UserID,
+		ModelName:     task.ModelName,
+		ModelVersion:  task.ModelVersion,
+		Status:        task.Status,
+		RunningTime:   task.RunningTime,
+		CreatedAt:     task.CreatedAt,
+		Outputs:       task.Outputs,
+		ErrorInfo:     task.ErrorInfo,
+		QueueNum:      task.QueueNum,
+		QueueID:       task.QueueID,
+		Version:       task.Version,
+		CanceledBy:    task.CanceledBy,
+		WebhookURL:    task.WebhookURL,
+		WebhookEvents: task.WebhookEvents,
+	}
+	// The tasks written to redis by older versions have no update time
+	if !task.UpdatedAt.IsZero() {
+		updatedAt := task.UpdatedAt
+		res.UpdatedAt = &updatedAt
+	}
+	return res
+}
+
+// taskV1FromRecord converts the task record in the database to the public representation
+func taskV1FromRecord(record db.Task) TaskV1 {
+	task := taskInfoFromRecord(record)
+	return newTaskV1(&task)
+}
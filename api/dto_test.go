@@ -0,0 +1,58 @@
+package api
+
+import (
+	"encoding/json"
+	db "github.com/HyperGAI/serving-webhook/db/sqlc"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestTaskV1(t *testing.T) {
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	updatedAt := createdAt.Add(time.Minute)
+	record := db.Task{
+		ID:           7,
+		TaskID:       "12345",
+		UserID:       pgtype.Text{String: "user", Valid: true},
+		ModelName:    "test_model",
+		ModelVersion: pgtype.Text{String: "v1", Valid: true},
+		CreatedAt:    createdAt,
+		UpdatedAt:    updatedAt,
+		RunningTime:  pgtype.Float8{Float64: 1.5, Valid: true},
+		Status:       pgtype.Text{String: TaskStatusSucceeded, Valid: true},
+		Outputs:      []byte(`{"output": "abc"}`),
+		QueueNum:     pgtype.Int4{Int32: 2, Valid: true},
+		Version:      3,
+	}
+	data, err := json.Marshal(taskV1FromRecord(record))
+	require.NoError(t, err)
+	// The record is flattened into the same fields as a task read from redis
+	require.JSONEq(t, `{
+		"api_version": "v1",
+		"id": "12345",
+		"user_id": "user",
+		"model_name": "test_model",
+		"model_version": "v1",
+		"status": "succeeded",
+		"running_time": "1.5s",
+		"created_at": "2024-01-02T03:04:05Z",
+		"updated_at": "2024-01-02T03:05:05Z",
+		"outputs": {"output": "abc"},
+		"error_info": "",
+		"queue_num": 2,
+		"queue_id": "",
+		"version": 3,
+		"canceled_by": ""
+	}`, string(data))
+
+	task := taskInfoFromRecord(record)
+	require.Equal(t, taskV1FromRecord(record), newTaskV1(&task))
+
+	// Tasks written to redis by older versions have no update time
+	task.UpdatedAt = time.Time{}
+	data, err = json.Marshal(newTaskV1(&task))
+	require.NoError(t, err)
+	require.NotContains(t, string(data), "updated_at")
+}
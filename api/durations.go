@@ -0,0 +1,61 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// modelDurations are durations configured for every model with per-model overrides,
+// e.g., the timeouts of the stale tasks. Zero disables the feature for a model.
+type modelDurations struct {
+	fallback time.Duration
+	models   map[string]time.Duration
+}
+
+// parseModelDurations reads the fallback duration, and the overrides in the format
+// of "model_a=30m,model_b=2h"
+func parseModelDurations(fallback string, overrides string) (modelDurations, error) {
+	durations := modelDurations{models: make(map[string]time.Duration)}
+	if fallback != "" {
+		duration, err := time.ParseDuration(fallback)
+		if err != nil {
+			return durations, err
+		}
+		durations.fallback = duration
+	}
+	for _, item := range strings.Split(overrides, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		model, value, found := strings.Cut(item, "=")
+		if !found {
+			return durations, fmt.Errorf("invalid model duration %q", item)
+		}
+		duration, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return durations, fmt.Errorf("invalid model duration %q: %w", item, err)
+		}
+		durations.models[strings.TrimSpace(model)] = duration
+	}
+	return durations, nil
+}
+
+func (durations modelDurations) get(modelName string) time.Duration {
+	if duration, ok := durations.models[modelName]; ok {
+		return duration
+	}
+	return durations.fallback
+}
+
+// min returns the shortest duration, or zero if every duration is zero
+func (durations modelDurations) min() time.Duration {
+	shortest := durations.fallback
+	for _, duration := range durations.models {
+		if duration > 0 && (shortest <= 0 || duration < shortest) {
+			shortest = duration
+		}
+	}
+	return shortest
+}
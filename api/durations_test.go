@@ -0,0 +1,36 @@
+package api
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestParseModelDurations(t *testing.T) {
+	durations, err := parseModelDurations("1h", "model_a=30m, model_b = 3h,model_c=0")
+	require.NoError(t, err)
+	require.Equal(t, 30*time.Minute, durations.get("model_a"))
+	require.Equal(t, 3*time.Hour, durations.get("model_b"))
+	require.Equal(t, time.Duration(0), durations.get("model_c"))
+	require.Equal(t, time.Hour, durations.get("other"))
+	require.Equal(t, 30*time.Minute, durations.min())
+
+	// Only some models can have a duration
+	durations, err = parseModelDurations("", "model_b=3h")
+	require.NoError(t, err)
+	require.Equal(t, time.Duration(0), durations.get("other"))
+	require.Equal(t, 3*time.Hour, durations.min())
+
+	durations, err = parseModelDurations("", "")
+	require.NoError(t, err)
+	require.Equal(t, time.Duration(0), durations.min())
+
+	for _, config := range [][2]string{
+		{"one hour", ""},
+		{"", "model_a"},
+		{"", "model_a=soon"},
+	} {
+		_, err = parseModelDurations(config[0], config[1])
+		require.Error(t, err)
+	}
+}
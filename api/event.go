@@ -0,0 +1,168 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	TaskEventCreated  = "created"
+	TaskEventUpdated  = "updated"
+	TaskEventSnapshot = "snapshot"
+
+	eventKeepAlive = 15 * time.Second
+
+	// TaskEventsChannel receives the events of all tasks
+	TaskEventsChannel = "task:events"
+)
+
+// TaskEvent is published to redis whenever a task is created or updated. The task is in
+// its public representation, so that the storage format doesn't leak into the streams.
+// Changes holds the JSON fields that differ from the previous version of the task.
+type TaskEvent struct {
+	Type    string                     `json:"type"`
+	Task    TaskV1                     `json:"task"`
+	Changes map[string]json.RawMessage `json:"changes,omitempty"`
+}
+
+// publishTaskEvent notifies the subscribers of a task, and queues the event for the event
+// sink if it is set. It is only used without a database, the changes in the database are
+// published by relayOutbox. previous is nil for a new task.
+func (server *Server) publishTaskEvent(eventType string, previous *TaskInfo, task *TaskInfo) {
+	server.broadcastTaskEvent(eventType, previous, task)
+	if server.sink == nil {
+		return
+	}
+	cloudEvent, err := server.newTaskCloudEvent(eventType, task)
+	if err != nil {
+		log.Error().Msgf("failed to create the cloud event of task %s: %v", task.ID, err)
+		return
+	}
+	server.queueSinkEvent(cloudEvent)
+}
+
+// broadcastTaskEvent notifies the subscribers of a task in redis, and sends the event
+// to K_SINK if it is set. A failed notification is only logged since the task has been saved.
+func (server *Server) broadcastTaskEvent(eventType string, previous *TaskInfo, task *TaskInfo) {
+	current := newTaskV1(task)
+	event := TaskEvent{Type: eventType, Task: current}
+	var old *TaskV1
+	if previous != nil {
+		v1 := newTaskV1(previous)
+		old = &v1
+	}
+	changes, err := diffTask(old, &current)
+	if err != nil {
+		log.Error().Msgf("failed to compare the versions of task %s: %v", task.ID, err)
+	}
+	event.Changes = changes
+	if err := server.cache.Publish(TaskEventsChannel, event); err != nil {
+		log.Error().Msgf("failed to publish the event of task %s: %v", task.ID, err)
+	}
+	if server.config.CloudEventsSink == "" {
+		return
+	}
+	cloudEvent, err := server.newTaskCloudEvent(eventType, task)
+	if err != nil {
+		log.Error().Msgf("failed to create the cloud event of task %s: %v", task.ID, err)
+		return
+	}
+	server.emitCloudEvent(cloudEvent)
+}
+
+// diffTask returns the JSON fields of task that are different from previous,
+// or all the fields if previous is nil
+func diffTask(previous *TaskV1, task *TaskV1) (map[string]json.RawMessage, error) {
+	current, err := taskFields(task)
+	if err != nil {
+		return nil, err
+	}
+	if previous == nil {
+		return current, nil
+	}
+	old, err := taskFields(previous)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range current {
+		if bytes.Equal(value, old[key]) {
+			delete(current, key)
+		}
+	}
+	return current, nil
+}
+
+func taskFields(task *TaskV1) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(task)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(data, &fields)
+	return fields, err
+}
+
+/*
+curl -N http://localhost:12000/task/<TASK_ID>/events
+*/
+
+// Events streams the status and output changes of a task as server-sent events.
+// The first event is the current task info, and the stream ends when the task finishes.
+func (server *Server) Events(ctx *gin.Context) {
+	var id URI
+	if err := ctx.BindUri(&id); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	// Register before reading the task so that no updates are missed. The events come
+	// from the subscription of the hub, which all the clients of this replica share.
+	subscriber := &taskSubscriber{
+		filter: newTaskFilter(),
+		events: make(chan TaskEvent, subscriberBufferSize),
+		done:   make(chan struct{}),
+	}
+	subscriber.filter.taskIDs[id.ID] = true
+	if err := server.hub.register(subscriber); err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	defer server.hub.unregister(subscriber)
+
+	task, err := server.getTask(ctx, id.ID)
+	if hasError(ctx, err) {
+		return
+	}
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("Connection", "keep-alive")
+	ctx.Header("X-Accel-Buffering", "no")
+	ctx.SSEvent(TaskEventSnapshot, newTaskV1(task))
+	if isTerminalStatus(task.Status) {
+		return
+	}
+	// Send the headers and the snapshot before waiting for updates
+	ctx.Writer.Flush()
+
+	ticker := time.NewTicker(eventKeepAlive)
+	defer ticker.Stop()
+	ctx.Stream(func(w io.Writer) bool {
+		select {
+		case event := <-subscriber.events:
+			ctx.SSEvent(event.Type, event.Task)
+			return !isTerminalStatus(event.Task.Status)
+		case <-subscriber.done:
+			// The client doesn't keep up, it can reconnect for a new snapshot
+			return false
+		case <-ticker.C:
+			// A comment line keeps proxies from closing an idle connection
+			_, err := w.Write([]byte(": keep-alive\n\n"))
+			return err == nil
+		case <-ctx.Request.Context().Done():
+			return false
+		}
+	})
+}
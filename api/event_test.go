@@ -0,0 +1,141 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"github.com/HyperGAI/serving-webhook/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type sseEvent struct {
+	Type string
+	Task TaskV1
+}
+
+func readEvent(t *testing.T, reader *bufio.Reader) sseEvent {
+	var event sseEvent
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "" && event.Type != "":
+			return event
+		case strings.HasPrefix(line, "event:"):
+			event.Type = strings.TrimPrefix(line, "event:")
+		case strings.HasPrefix(line, "data:"):
+			require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data:")), &event.Task))
+		}
+	}
+}
+
+func TestEvents(t *testing.T) {
+	server := newTestServer(t, nil, storage.NewMemoryCache(), nil)
+	httpServer := httptest.NewServer(server.router)
+	defer httpServer.Close()
+
+	sendRequest := func(method string, url string, body gin.H) int {
+		data, err := json.Marshal(body)
+		require.NoError(t, err)
+		request, err := http.NewRequest(method, httpServer.URL+url, bytes.NewReader(data))
+		require.NoError(t, err)
+		response, err := http.DefaultClient.Do(request)
+		require.NoError(t, err)
+		defer response.Body.Close()
+		return response.StatusCode
+	}
+
+	response, err := http.Get(httpServer.URL + "/task/12345/events")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNotFound, response.StatusCode)
+	response.Body.Close()
+
+	require.Equal(t, http.StatusOK, sendRequest(http.MethodPost, "/task", gin.H{
+		"id":         "12345",
+		"model_name": "test_model",
+	}))
+
+	response, err = http.Get(httpServer.URL + "/task/12345/events")
+	require.NoError(t, err)
+	defer response.Body.Close()
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	require.Contains(t, response.Header.Get("Content-Type"), "text/event-stream")
+	reader := bufio.NewReader(response.Body)
+
+	event := readEvent(t, reader)
+	require.Equal(t, TaskEventSnapshot, event.Type)
+	require.Equal(t, "12345", event.Task.ID)
+	require.Equal(t, TaskStatusPending, event.Task.Status)
+
+	require.Equal(t, http.StatusOK, sendRequest(http.MethodPut, "/task", gin.H{
+		"id":     "12345",
+		"status": TaskStatusRunning,
+	}))
+	event = readEvent(t, reader)
+	require.Equal(t, TaskEventUpdated, event.Type)
+	require.Equal(t, TaskStatusRunning, event.Task.Status)
+	require.Equal(t, TaskAPIVersion, event.Task.APIVersion)
+	// The stream is served from the shared subscription of the hub
+	server.hub.mutex.Lock()
+	require.NotNil(t, server.hub.subscription)
+	require.Len(t, server.hub.subscribers, 1)
+	server.hub.mutex.Unlock()
+
+	require.Equal(t, http.StatusOK, sendRequest(http.MethodPut, "/task", gin.H{
+		"id":      "12345",
+		"status":  TaskStatusSucceeded,
+		"outputs": gin.H{"url": "test.png"},
+	}))
+	event = readEvent(t, reader)
+	require.Equal(t, TaskEventUpdated, event.Type)
+	require.Equal(t, TaskStatusSucceeded, event.Task.Status)
+	require.Equal(t, int64(3), event.Task.Version)
+
+	// The stream ends once the task is finished
+	_, err = reader.ReadString('\n')
+	require.Error(t, err)
+	require.Eventually(t, func() bool {
+		server.hub.mutex.Lock()
+		defer server.hub.mutex.Unlock()
+		return server.hub.subscription == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// A finished task only gets the snapshot
+	response, err = http.Get(httpServer.URL + "/task/12345/events")
+	require.NoError(t, err)
+	defer response.Body.Close()
+	reader = bufio.NewReader(response.Body)
+	event = readEvent(t, reader)
+	require.Equal(t, TaskEventSnapshot, event.Type)
+	require.Equal(t, TaskStatusSucceeded, event.Task.Status)
+	_, err = reader.ReadString('\n')
+	require.Error(t, err)
+}
+
+func TestDiffTask(t *testing.T) {
+	task := newTaskV1(&TaskInfo{ID: "12345", ModelName: "test_model", Status: TaskStatusPending, Version: 1})
+	changes, err := diffTask(nil, &task)
+	require.NoError(t, err)
+	require.JSONEq(t, `"v1"`, string(changes["api_version"]))
+	require.JSONEq(t, `"12345"`, string(changes["id"]))
+	require.JSONEq(t, `"pending"`, string(changes["status"]))
+	require.Contains(t, changes, "outputs")
+
+	updated := task
+	updated.Status = TaskStatusSucceeded
+	updated.Outputs = map[string]interface{}{"url": "test.png"}
+	updated.Version = 2
+	changes, err = diffTask(&task, &updated)
+	require.NoError(t, err)
+	require.Len(t, changes, 3)
+	require.JSONEq(t, `"succeeded"`, string(changes["status"]))
+	require.JSONEq(t, `{"url": "test.png"}`, string(changes["outputs"]))
+	require.JSONEq(t, `2`, string(changes["version"]))
+}
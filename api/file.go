@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"io"
 	"mime/multipart"
 	"net/http"
 	"path/filepath"
@@ -32,6 +33,10 @@ func (server *Server) Upload(ctx *gin.Context) {
 
 	id := uuid.New()
 	ext := filepath.Ext(file.Filename)
+	if code, err := server.scanFile(src, id.String()+ext); err != nil {
+		ctx.JSON(code, errorResponse(err))
+		return
+	}
 	// location, err := server.store.Upload(src, id.String()+ext)
 	location, err := server.store.PutObject(src, id.String()+ext)
 	if err != nil {
@@ -110,6 +115,14 @@ func (server *Server) uploadSingleFile(file *multipart.FileHeader, index int) Up
 
 	id := uuid.New()
 	ext := filepath.Ext(file.Filename)
+	if code, err := server.scanFile(src, id.String()+ext); err != nil {
+		return UploadResult{
+			Index:     index,
+			Location:  "",
+			Error:     err,
+			ErrorCode: code,
+		}
+	}
 	// location, err := server.store.Upload(src, id.String()+ext)
 	location, err := server.store.PutObject(src, id.String()+ext)
 	if err != nil {
@@ -127,3 +140,25 @@ func (server *Server) uploadSingleFile(file *multipart.FileHeader, index int) Up
 		ErrorCode: 200,
 	}
 }
+
+// scanFile checks the file before it is uploaded with the public-read ACL.
+// Flagged files are rejected, and also kept privately under "quarantine/"
+// if SCANNER_ACTION is "quarantine".
+func (server *Server) scanFile(src multipart.File, fileKey string) (int, error) {
+	result, err := server.scanner.Scan(src)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if _, err = src.Seek(0, io.SeekStart); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if result.Infected {
+		if server.config.ScannerAction == "quarantine" {
+			if err = server.store.PutPrivateObject(src, "quarantine/"+fileKey); err != nil {
+				return http.StatusInternalServerError, err
+			}
+		}
+		return http.StatusUnprocessableEntity, fmt.Errorf("file is flagged by the scanner: %s", result.Signature)
+	}
+	return http.StatusOK, nil
+}
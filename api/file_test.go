@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"github.com/HyperGAI/serving-webhook/storage"
 	mockstore "github.com/HyperGAI/serving-webhook/storage/mock"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/mock/gomock"
@@ -153,3 +154,116 @@ func TestUpload(t *testing.T) {
 		})
 	}
 }
+
+func TestUploadScan(t *testing.T) {
+	testCases := []struct {
+		name          string
+		action        string
+		buildStubs    func(store *mockstore.MockStore, scanner *mockstore.MockScanner)
+		checkResponse func(recoder *httptest.ResponseRecorder)
+	}{
+		{
+			name:   "OK",
+			action: "reject",
+			buildStubs: func(store *mockstore.MockStore, scanner *mockstore.MockScanner) {
+				scanner.EXPECT().
+					Scan(gomock.Any()).
+					Times(1).
+					Return(&storage.ScanResult{Infected: false}, nil)
+				store.EXPECT().
+					PutObject(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return("test_url", nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:   "Rejected",
+			action: "reject",
+			buildStubs: func(store *mockstore.MockStore, scanner *mockstore.MockScanner) {
+				scanner.EXPECT().
+					Scan(gomock.Any()).
+					Times(1).
+					Return(&storage.ScanResult{Infected: true, Signature: "Eicar-Signature"}, nil)
+				store.EXPECT().
+					PutObject(gomock.Any(), gomock.Any()).
+					Times(0)
+				store.EXPECT().
+					PutPrivateObject(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+			},
+		},
+		{
+			name:   "Quarantined",
+			action: "quarantine",
+			buildStubs: func(store *mockstore.MockStore, scanner *mockstore.MockScanner) {
+				scanner.EXPECT().
+					Scan(gomock.Any()).
+					Times(1).
+					Return(&storage.ScanResult{Infected: true, Signature: "Eicar-Signature"}, nil)
+				store.EXPECT().
+					PutObject(gomock.Any(), gomock.Any()).
+					Times(0)
+				store.EXPECT().
+					PutPrivateObject(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+			},
+		},
+		{
+			name:   "Scanner failed",
+			action: "reject",
+			buildStubs: func(store *mockstore.MockStore, scanner *mockstore.MockScanner) {
+				scanner.EXPECT().
+					Scan(gomock.Any()).
+					Times(1).
+					Return(nil, errors.New("clamd error"))
+				store.EXPECT().
+					PutObject(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockstore.NewMockStore(ctrl)
+			scanner := mockstore.NewMockScanner(ctrl)
+			tc.buildStubs(store, scanner)
+
+			server := newTestServer(t, store, nil, nil)
+			server.scanner = scanner
+			server.config.ScannerAction = tc.action
+			recorder := httptest.NewRecorder()
+
+			requestBody, contentType, err := buildRequestBody(map[string]io.Reader{
+				"file": mustOpen("file_test.go"),
+			})
+			require.NoError(t, err)
+
+			request, err := http.NewRequest(
+				http.MethodPost, "/upload", requestBody)
+			require.NoError(t, err)
+			request.Header.Set("Content-Type", contentType)
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/HyperGAI/serving-webhook/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"net/http"
+)
+
+const (
+	idempotencyHeaderKey = "Idempotency-Key"
+	idempotencyKeyPrefix = "idempotency:"
+)
+
+// idempotentResponse is the response stored for an Idempotency-Key,
+// so that a retried request gets the original response
+type idempotentResponse struct {
+	Request    json.RawMessage `json:"request"`
+	StatusCode int             `json:"status_code"`
+	Body       json.RawMessage `json:"body"`
+}
+
+func idempotencyKey(ctx *gin.Context) string {
+	key := ctx.GetHeader(idempotencyHeaderKey)
+	if key == "" {
+		return ""
+	}
+	return idempotencyKeyPrefix + ctx.GetHeader("UID") + ":" + key
+}
+
+// replayResponse writes the stored response if the request has been handled before.
+// It returns true if the response is written.
+func (server *Server) replayResponse(ctx *gin.Context, key string, request interface{}) bool {
+	if key == "" {
+		return false
+	}
+	value, err := server.cache.GetKey(key)
+	if err != nil {
+		if !errors.Is(err, storage.ErrKeyNotFound) {
+			log.Error().Msgf("failed to read idempotency key %s: %v", key, err)
+		}
+		return false
+	}
+	var res idempotentResponse
+	if err = json.Unmarshal([]byte(value), &res); err != nil {
+		log.Error().Msgf("failed to unmarshal idempotency key %s: %v", key, err)
+		return false
+	}
+	data, err := json.Marshal(request)
+	if err != nil || string(data) != string(res.Request) {
+		err = errors.New("idempotency key is reused with a different request")
+		ctx.JSON(http.StatusUnprocessableEntity, errorCodeResponse("idempotency_key_reused", err))
+		return true
+	}
+	ctx.Data(res.StatusCode, "application/json; charset=utf-8", res.Body)
+	return true
+}
+
+// saveResponse stores the response of a request with an Idempotency-Key
+func (server *Server) saveResponse(key string, request interface{}, statusCode int, body interface{}) {
+	if key == "" {
+		return
+	}
+	req, err := json.Marshal(request)
+	if err != nil {
+		log.Error().Msgf("failed to marshal request: %v", err)
+		return
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		log.Error().Msgf("failed to marshal response: %v", err)
+		return
+	}
+	res := idempotentResponse{Request: req, StatusCode: statusCode, Body: data}
+	if err = server.cache.SetKey(key, res, server.KeyDuration()); err != nil {
+		log.Error().Msgf("failed to save idempotency key %s: %v", key, err)
+	}
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"github.com/HyperGAI/serving-webhook/scheduler"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"time"
+)
+
+// The names of the scheduled jobs
+const (
+	JobReaper        = "reaper"
+	JobRetention     = "retention"
+	JobUsageRollup   = "usage-rollup"
+	JobOutboxCleanup = "outbox-cleanup"
+)
+
+// NewScheduler creates the scheduler of the periodic maintenance jobs, which run on the
+// replica elected by the elector. The outbox relay and the webhook worker are not
+// scheduled, since every replica can run them by leasing the rows.
+func (server *Server) NewScheduler(elector scheduler.Elector) *scheduler.Scheduler {
+	jobs := scheduler.New(elector, server.cache, server.instanceID)
+	if server.timeouts.min() > 0 {
+		jobs.Register(scheduler.Job{Name: JobReaper, Interval: reaperInterval, Run: server.runReaper})
+	}
+	if server.retentionEnabled() {
+		jobs.Register(scheduler.Job{
+			Name:     JobRetention,
+			Interval: retentionInterval,
+			Retry:    retentionRetry,
+			Run:      server.runRetention,
+		})
+	} else if server.retention.min() > 0 {
+		log.Warn().Msg("the retention needs the database and the S3 bucket")
+	}
+	if server.database != nil {
+		jobs.Register(scheduler.Job{Name: JobUsageRollup, Interval: usageRollupInterval, Run: server.runUsageRollup})
+		jobs.Register(scheduler.Job{Name: JobOutboxCleanup, Interval: outboxCleanupInterval, Run: server.cleanupOutbox})
+	}
+	server.scheduler = jobs
+	return jobs
+}
+
+func (server *Server) runReaper(ctx context.Context) error {
+	count, err := server.Reap(ctx, time.Now())
+	if count > 0 {
+		log.Info().Msgf("timed out %d stale tasks", count)
+	}
+	return err
+}
+
+func (server *Server) runRetention(ctx context.Context) error {
+	result, err := server.ApplyRetention(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+	log.Info().
+		Int("archived", result.Archived).
+		Int64("deleted", result.Deleted).
+		Int("files", result.Files).
+		Msg("retention applied")
+	return nil
+}
+
+func (server *Server) runUsageRollup(ctx context.Context) error {
+	return server.rollupUsage(ctx, time.Now())
+}
+
+var errSchedulerDisabled = errors.New("the scheduler is not running")
+
+type JobsResponse struct {
+	InstanceID string                `json:"instance_id"`
+	Leader     bool                  `json:"leader"`
+	Jobs       []scheduler.JobStatus `json:"jobs"`
+}
+
+// ListJobs returns the last runs of the scheduled jobs, which any replica can report
+func (server *Server) ListJobs(ctx *gin.Context) {
+	if server.scheduler == nil {
+		ctx.JSON(http.StatusServiceUnavailable, errorResponse(errSchedulerDisabled))
+		return
+	}
+	jobs, err := server.scheduler.Jobs()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, JobsResponse{
+		InstanceID: server.scheduler.InstanceID(),
+		Leader:     server.scheduler.IsLeader(),
+		Jobs:       jobs,
+	})
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	mockdb "github.com/HyperGAI/serving-webhook/db/mock"
+	"github.com/HyperGAI/serving-webhook/scheduler"
+	"github.com/HyperGAI/serving-webhook/storage"
+	mockstore "github.com/HyperGAI/serving-webhook/storage/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func jobNames(t *testing.T, jobs *scheduler.Scheduler) []string {
+	statuses, err := jobs.Jobs()
+	require.NoError(t, err)
+	names := make([]string, 0, len(statuses))
+	for _, status := range statuses {
+		names = append(names, status.Name)
+	}
+	return names
+}
+
+func TestNewScheduler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Nothing to schedule without the database and the timeouts
+	server := newTestServer(t, nil, storage.NewMemoryCache(), nil)
+	require.Empty(t, jobNames(t, server.NewScheduler(scheduler.Standalone{})))
+
+	server.timeouts = modelDurations{fallback: time.Hour}
+	require.Equal(t, []string{JobReaper}, jobNames(t, server.NewScheduler(scheduler.Standalone{})))
+
+	server = newTestServer(t, mockstore.NewMockStore(ctrl), storage.NewMemoryCache(), mockdb.NewMockStore(ctrl))
+	server.timeouts = modelDurations{fallback: time.Hour}
+	server.retention = modelDurations{fallback: 30 * 24 * time.Hour}
+	require.Equal(t,
+		[]string{JobOutboxCleanup, JobReaper, JobRetention, JobUsageRollup},
+		jobNames(t, server.NewScheduler(scheduler.Standalone{})))
+}
+
+func TestListJobs(t *testing.T) {
+	cache := storage.NewMemoryCache()
+	server := newTestServer(t, nil, cache, nil)
+	server.timeouts = modelDurations{fallback: time.Hour}
+
+	listJobs := func() *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request, err := http.NewRequest(http.MethodGet, "/admin/jobs", nil)
+		require.NoError(t, err)
+		server.router.ServeHTTP(recorder, request)
+		return recorder
+	}
+	// The scheduler is not created
+	require.Equal(t, http.StatusServiceUnavailable, listJobs().Code)
+
+	jobs := server.NewScheduler(scheduler.Standalone{})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		jobs.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	require.Eventually(t, func() bool {
+		statuses, err := jobs.Jobs()
+		return err == nil && statuses[0].LastSuccessAt != nil && !statuses[0].Running
+	}, time.Second, 10*time.Millisecond)
+
+	recorder := listJobs()
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var res JobsResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &res))
+	require.Equal(t, server.instanceID, res.InstanceID)
+	require.True(t, res.Leader)
+	require.Len(t, res.Jobs, 1)
+	job := res.Jobs[0]
+	require.Equal(t, JobReaper, job.Name)
+	require.Equal(t, "1m0s", job.Interval)
+	require.Equal(t, server.instanceID, job.LastRunBy)
+	require.Empty(t, job.LastError)
+	require.NotNil(t, job.NextRunAt)
+	require.Equal(t, job.LastRunAt.Add(reaperInterval), *job.NextRunAt)
+}
@@ -0,0 +1,176 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	db "github.com/HyperGAI/serving-webhook/db/sqlc"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	defaultListLimit = 50
+	defaultListSort  = "-" + db.SortByCreatedAt
+)
+
+var errInvalidQuery = errors.New("invalid query")
+
+// ListTasksRequest is the query of GET /tasks. The times are in RFC 3339, the statuses
+// can be repeated or separated by commas, and sort is a column with an optional "-"
+// prefix for the descending order.
+type ListTasksRequest struct {
+	UserID        string    `form:"user_id"`
+	ModelName     string    `form:"model_name"`
+	ModelVersion  string    `form:"model_version"`
+	Statuses      []string  `form:"status"`
+	CreatedAfter  time.Time `form:"created_after"`
+	CreatedBefore time.Time `form:"created_before"`
+	UpdatedAfter  time.Time `form:"updated_after"`
+	UpdatedBefore time.Time `form:"updated_before"`
+	Sort          string    `form:"sort"`
+	Limit         int32     `form:"limit" binding:"omitempty,min=1,max=500"`
+	Cursor        string    `form:"cursor"`
+}
+
+// ListTasksResponse is a page of tasks, next_cursor is empty on the last page
+type ListTasksResponse struct {
+	Tasks      []TaskV1 `json:"tasks"`
+	NextCursor string   `json:"next_cursor,omitempty"`
+}
+
+// listCursor is the sort key of the last task of a page. It is encoded as an opaque
+// string, and only valid for the same sort order.
+type listCursor struct {
+	Sort string    `json:"s"`
+	Time time.Time `json:"t"`
+	ID   int64     `json:"i"`
+}
+
+func encodeCursor(sort string, record db.Task) string {
+	cursor := listCursor{Sort: sort, Time: record.CreatedAt, ID: record.ID}
+	if strings.TrimPrefix(sort, "-") == db.SortByUpdatedAt {
+		cursor.Time = record.UpdatedAt
+	}
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(value string, sort string) (*listCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", errInvalidQuery)
+	}
+	var cursor listCursor
+	if err = json.Unmarshal(data, &cursor); err != nil || cursor.ID == 0 {
+		return nil, fmt.Errorf("%w: malformed cursor", errInvalidQuery)
+	}
+	if cursor.Sort != sort {
+		return nil, fmt.Errorf("%w: the cursor is for sort=%s", errInvalidQuery, cursor.Sort)
+	}
+	return &cursor, nil
+}
+
+// parseStatuses validates the statuses in a query, which can be repeated or separated by commas
+func parseStatuses(values []string) ([]string, error) {
+	var statuses []string
+	for _, value := range values {
+		for _, status := range strings.Split(value, ",") {
+			status = strings.TrimSpace(status)
+			if status == "" {
+				continue
+			}
+			if err := validateStatus(status); err != nil {
+				return nil, err
+			}
+			statuses = append(statuses, status)
+		}
+	}
+	return statuses, nil
+}
+
+// listTasksParams validates the request and converts it to the parameters of db.ListTasks
+func listTasksParams(req *ListTasksRequest) (db.ListTasksParams, string, error) {
+	sort := req.Sort
+	if sort == "" {
+		sort = defaultListSort
+	}
+	params := db.ListTasksParams{
+		UserID:        req.UserID,
+		ModelName:     req.ModelName,
+		ModelVersion:  req.ModelVersion,
+		CreatedAfter:  req.CreatedAfter,
+		CreatedBefore: req.CreatedBefore,
+		UpdatedAfter:  req.UpdatedAfter,
+		UpdatedBefore: req.UpdatedBefore,
+		SortBy:        strings.TrimPrefix(sort, "-"),
+		Descending:    strings.HasPrefix(sort, "-"),
+		Limit:         req.Limit,
+	}
+	if params.SortBy != db.SortByCreatedAt && params.SortBy != db.SortByUpdatedAt {
+		return params, sort, fmt.Errorf("%w: cannot sort by %q", errInvalidQuery, req.Sort)
+	}
+	statuses, err := parseStatuses(req.Statuses)
+	if err != nil {
+		return params, sort, err
+	}
+	params.Statuses = statuses
+	if params.Limit == 0 {
+		params.Limit = defaultListLimit
+	}
+	if req.Cursor != "" {
+		cursor, err := decodeCursor(req.Cursor, sort)
+		if err != nil {
+			return params, sort, err
+		}
+		params.AfterTime = cursor.Time
+		params.AfterID = cursor.ID
+	}
+	return params, sort, nil
+}
+
+/*
+curl "http://localhost:12000/tasks?model_name=<MODEL_NAME>&status=failed,timed_out&created_after=2024-01-01T00:00:00Z&sort=-updated_at&limit=100"
+*/
+
+// ListTasks returns a page of the tasks in the database matching the filters
+func (server *Server) ListTasks(ctx *gin.Context) {
+	var req ListTasksRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	res, err := server.queryTasks(ctx, &req)
+	if hasError(ctx, err) {
+		return
+	}
+	ctx.JSON(http.StatusOK, res)
+}
+
+// queryTasks returns the page of tasks for the request
+func (server *Server) queryTasks(ctx *gin.Context, req *ListTasksRequest) (*ListTasksResponse, error) {
+	params, sort, err := listTasksParams(req)
+	if err != nil {
+		return nil, err
+	}
+	// Read one more task to know if there is a next page
+	limit := params.Limit
+	params.Limit += 1
+	records, err := server.database.ListTasks(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &ListTasksResponse{Tasks: make([]TaskV1, 0, len(records))}
+	if len(records) > int(limit) {
+		records = records[:limit]
+		res.NextCursor = encodeCursor(sort, records[len(records)-1])
+	}
+	for _, record := range records {
+		res.Tasks = append(res.Tasks, taskV1FromRecord(record))
+	}
+	return res, nil
+}
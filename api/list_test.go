@@ -0,0 +1,200 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	mockdb "github.com/HyperGAI/serving-webhook/db/mock"
+	db "github.com/HyperGAI/serving-webhook/db/sqlc"
+	mockstore "github.com/HyperGAI/serving-webhook/storage/mock"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestListTasks(t *testing.T) {
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	records := []db.Task{
+		{ID: 3, TaskID: "c", ModelName: "m", Status: pgtype.Text{String: "failed", Valid: true}, CreatedAt: createdAt},
+		{ID: 2, TaskID: "b", ModelName: "m", Status: pgtype.Text{String: "failed", Valid: true}, CreatedAt: createdAt},
+		{ID: 1, TaskID: "a", ModelName: "m", Status: pgtype.Text{String: "timed_out", Valid: true}, CreatedAt: createdAt},
+	}
+	cursor := encodeCursor("-created_at", records[1])
+
+	testCases := []struct {
+		name          string
+		query         string
+		buildStubs    func(database *mockdb.MockStore)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:  "OK",
+			query: "?user_id=u&model_name=m&model_version=v1&status=failed,timed_out&created_after=2024-01-01T00:00:00Z&limit=2",
+			buildStubs: func(database *mockdb.MockStore) {
+				database.EXPECT().
+					ListTasks(gomock.Any(), gomock.Eq(db.ListTasksParams{
+						UserID:       "u",
+						ModelName:    "m",
+						ModelVersion: "v1",
+						Statuses:     []string{"failed", "timed_out"},
+						CreatedAfter: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+						SortBy:       db.SortByCreatedAt,
+						Descending:   true,
+						Limit:        3,
+					})).
+					Times(1).
+					Return(records, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				var res ListTasksResponse
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &res))
+				require.Len(t, res.Tasks, 2)
+				require.Equal(t, "c", res.Tasks[0].ID)
+				require.Equal(t, "failed", res.Tasks[0].Status)
+				require.Equal(t, cursor, res.NextCursor)
+			},
+		},
+		{
+			name:  "Next page",
+			query: "?status=failed&status=timed_out&limit=2&cursor=" + cursor,
+			buildStubs: func(database *mockdb.MockStore) {
+				database.EXPECT().
+					ListTasks(gomock.Any(), gomock.Eq(db.ListTasksParams{
+						Statuses:   []string{"failed", "timed_out"},
+						SortBy:     db.SortByCreatedAt,
+						Descending: true,
+						AfterTime:  createdAt,
+						AfterID:    2,
+						Limit:      3,
+					})).
+					Times(1).
+					Return(records[2:], nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				var res ListTasksResponse
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &res))
+				require.Len(t, res.Tasks, 1)
+				require.Empty(t, res.NextCursor)
+			},
+		},
+		{
+			name:  "Sort by updated_at",
+			query: "?sort=updated_at&updated_before=2024-01-01T00:00:00%2B08:00",
+			buildStubs: func(database *mockdb.MockStore) {
+				database.EXPECT().
+					ListTasks(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ interface{}, arg db.ListTasksParams) ([]db.Task, error) {
+						require.Equal(t, db.SortByUpdatedAt, arg.SortBy)
+						require.False(t, arg.Descending)
+						require.True(t, arg.UpdatedBefore.Equal(time.Date(2023, 12, 31, 16, 0, 0, 0, time.UTC)))
+						require.Equal(t, int32(defaultListLimit+1), arg.Limit)
+						return []db.Task{}, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.JSONEq(t, `{"tasks": []}`, recorder.Body.String())
+			},
+		},
+		{
+			name:  "Invalid sort",
+			query: "?sort=running_time",
+			buildStubs: func(database *mockdb.MockStore) {
+				database.EXPECT().ListTasks(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:  "Invalid status",
+			query: "?status=done",
+			buildStubs: func(database *mockdb.MockStore) {
+				database.EXPECT().ListTasks(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:  "Invalid time",
+			query: "?created_after=yesterday",
+			buildStubs: func(database *mockdb.MockStore) {
+				database.EXPECT().ListTasks(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:  "Limit too large",
+			query: "?limit=1000",
+			buildStubs: func(database *mockdb.MockStore) {
+				database.EXPECT().ListTasks(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:  "Malformed cursor",
+			query: "?cursor=abc",
+			buildStubs: func(database *mockdb.MockStore) {
+				database.EXPECT().ListTasks(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:  "Cursor of another sort",
+			query: "?sort=updated_at&cursor=" + cursor,
+			buildStubs: func(database *mockdb.MockStore) {
+				database.EXPECT().ListTasks(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:  "Database error",
+			query: "",
+			buildStubs: func(database *mockdb.MockStore) {
+				database.EXPECT().
+					ListTasks(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil, errors.New("connection refused"))
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			database := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(database)
+
+			server := newTestServer(t, nil, mockstore.NewMockCache(ctrl), database)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodGet, "/tasks"+tc.query, nil)
+			require.NoError(t, err)
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
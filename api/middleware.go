@@ -10,10 +10,21 @@ import (
 
 const (
 	authorizationHeaderKey = "apikey"
+	adminContextKey        = "admin"
 )
 
+// authMiddleware accepts the API key or the admin API key, and marks the requests with
+// the admin API key as admin. Every request is an admin one if neither key is set.
 func authMiddleware(config utils.Config) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
+		if config.AdminAPIKey != "" && ctx.GetHeader(authorizationHeaderKey) == config.AdminAPIKey {
+			ctx.Set(adminContextKey, true)
+			ctx.Next()
+			return
+		}
+		if config.SecretAPIKey == "" && config.AdminAPIKey == "" {
+			ctx.Set(adminContextKey, true)
+		}
 		if config.SecretAPIKey != "" {
 			authorizationHeader := ctx.GetHeader(authorizationHeaderKey)
 
@@ -39,3 +50,8 @@ func authMiddleware(config utils.Config) gin.HandlerFunc {
 		ctx.Next()
 	}
 }
+
+// isAdmin returns whether the request is authorized by the admin API key
+func isAdmin(ctx *gin.Context) bool {
+	return ctx.GetBool(adminContextKey)
+}
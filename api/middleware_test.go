@@ -19,6 +19,7 @@ func addAuthorization(
 func TestAuthMiddleware(t *testing.T) {
 	config := utils.Config{
 		SecretAPIKey: "123456",
+		AdminAPIKey:  "654321",
 	}
 
 	testCases := []struct {
@@ -33,6 +34,17 @@ func TestAuthMiddleware(t *testing.T) {
 			},
 			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusOK, recorder.Code)
+				require.JSONEq(t, `{"admin": false}`, recorder.Body.String())
+			},
+		},
+		{
+			name: "Admin",
+			setupAuth: func(t *testing.T, request *http.Request) {
+				addAuthorization(request, "654321")
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.JSONEq(t, `{"admin": true}`, recorder.Body.String())
 			},
 		},
 		{
@@ -73,7 +85,7 @@ func TestAuthMiddleware(t *testing.T) {
 				authPath,
 				authMiddleware(config),
 				func(ctx *gin.Context) {
-					ctx.JSON(http.StatusOK, gin.H{})
+					ctx.JSON(http.StatusOK, gin.H{"admin": isAdmin(ctx)})
 				},
 			)
 
@@ -0,0 +1,318 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	db "github.com/HyperGAI/serving-webhook/db/sqlc"
+	"github.com/HyperGAI/serving-webhook/storage"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/rs/zerolog/log"
+	"time"
+)
+
+const (
+	outboxPollInterval    = time.Second
+	outboxBatchSize       = 100
+	outboxLease           = 30 * time.Second
+	outboxMaxAttempts     = 10
+	outboxRetention       = 24 * time.Hour
+	outboxCleanupInterval = time.Hour
+	reconcileBatchSize    = 500
+)
+
+// errStaleTask is returned by the update function of cacheTask if redis already
+// holds the same or a newer version of the task
+var errStaleTask = errors.New("stale task version")
+
+// writeOutbox records a change of a task in the outbox, and queues its webhook callback.
+// It must be called in the transaction of the change, so that the change, its events and
+// its callback are either all committed or all rolled back.
+func (server *Server) writeOutbox(
+	ctx context.Context,
+	q db.Querier,
+	event string,
+	previous *TaskInfo,
+	task *TaskInfo,
+) error {
+	data, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	var previousData []byte
+	previousStatus := ""
+	if previous != nil {
+		if previousData, err = json.Marshal(previous); err != nil {
+			return err
+		}
+		previousStatus = previous.Status
+	}
+	_, err = q.CreateTaskOutbox(ctx, db.CreateTaskOutboxParams{
+		TaskID:   task.ID,
+		Event:    event,
+		Task:     data,
+		Previous: previousData,
+	})
+	if err != nil {
+		return err
+	}
+	delivery, err := webhookDelivery(previousStatus, task)
+	if err != nil || delivery == nil {
+		return err
+	}
+	_, err = q.CreateWebhookDelivery(ctx, *delivery)
+	return err
+}
+
+// applyCommitted writes a committed change through to redis, so that it can be read
+// back right away, and wakes the workers. If the write fails, the relay applies the
+// change from the outbox later.
+func (server *Server) applyCommitted(task *TaskInfo) {
+	if err := server.cacheTask(task); err != nil {
+		log.Error().Msgf("failed to write task %s to redis: %v", task.ID, err)
+	}
+	server.wakeOutboxRelay()
+	server.wakeWebhookWorker()
+}
+
+// cacheTask writes the task info to redis unless redis holds the same or a newer
+// version, so that the changes can be applied more than once and out of order
+func (server *Server) cacheTask(task *TaskInfo) error {
+	duration := server.KeyDuration()
+	for i := 0; i < 2; i++ {
+		err := server.cache.UpdateKey(task.ID, func(value string) (interface{}, error) {
+			var current TaskInfo
+			if err := json.Unmarshal([]byte(value), &current); err == nil && current.Version >= task.Version {
+				return nil, errStaleTask
+			}
+			return task, nil
+		}, duration)
+		if errors.Is(err, errStaleTask) {
+			return nil
+		}
+		if !errors.Is(err, storage.ErrKeyNotFound) {
+			return err
+		}
+		created, err := server.cache.SetKeyNX(task.ID, task, duration)
+		if err != nil || created {
+			return err
+		}
+		// The key has been created concurrently, compare the versions again
+	}
+	return storage.ErrUpdateConflict
+}
+
+// currentVersion returns the version of a task record, or the version in redis if
+// it is ahead, which is the case for the tasks updated before the records had versions
+func (server *Server) currentVersion(task *TaskInfo) int64 {
+	value, err := server.cache.GetKey(task.ID)
+	if err != nil {
+		return task.Version
+	}
+	var cached TaskInfo
+	if err = json.Unmarshal([]byte(value), &cached); err != nil || cached.Version < task.Version {
+		return task.Version
+	}
+	return cached.Version
+}
+
+func (server *Server) wakeOutboxRelay() {
+	select {
+	case server.outboxWake <- struct{}{}:
+	default:
+	}
+}
+
+// RunOutboxRelay applies the changes in the outbox to redis and publishes their events
+// until the context is canceled. Every replica can run a relay, since the changes are
+// leased before relaying. The events are delivered at least once.
+func (server *Server) RunOutboxRelay(ctx context.Context) {
+	if server.database == nil {
+		return
+	}
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+	for {
+		for {
+			count, err := server.processOutbox(ctx)
+			if err != nil {
+				log.Error().Msgf("failed to process the task outbox: %v", err)
+			}
+			// Keep going while there are changes, since a batch holds only the
+			// earliest pending change of each task
+			if err != nil || count == 0 {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-server.outboxWake:
+		}
+	}
+}
+
+// processOutbox leases a batch of pending changes and relays them, it returns the
+// number of changes in the batch. The batch holds at most one change of a task, so
+// a change that fails holds back the later changes of its task until it is relayed
+// or moved aside after outboxMaxAttempts.
+func (server *Server) processOutbox(ctx context.Context) (int, error) {
+	records, err := server.database.ClaimTaskOutbox(ctx, db.ClaimTaskOutboxParams{
+		LeaseUntil: time.Now().Add(outboxLease),
+		MaxCount:   outboxBatchSize,
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, record := range records {
+		if err := server.relayOutbox(ctx, record); err != nil {
+			if errors.Is(err, errSinkUnavailable) {
+				// The rest of the batch is relayed again when the leases expire, an
+				// outage of the broker isn't counted as a failed attempt
+				return len(records), fmt.Errorf("failed to relay change %d of task %s: %w", record.ID, record.TaskID, err)
+			}
+			if err := server.failOutbox(ctx, record, err); err != nil {
+				return len(records), err
+			}
+			continue
+		}
+		if err := server.database.MarkTaskOutboxProcessed(ctx, record.ID); err != nil {
+			return len(records), err
+		}
+	}
+	return len(records), nil
+}
+
+// failOutbox records a failed relay of a change, which is relayed again when its lease
+// expires, or moved aside after outboxMaxAttempts
+func (server *Server) failOutbox(ctx context.Context, record db.TaskOutbox, relayErr error) error {
+	failed, err := server.database.FailTaskOutbox(ctx, db.FailTaskOutboxParams{
+		ID:          record.ID,
+		LastError:   pgtype.Text{String: relayErr.Error(), Valid: true},
+		MaxAttempts: outboxMaxAttempts,
+	})
+	if err != nil {
+		return err
+	}
+	if failed.FailedAt.Valid {
+		log.Error().Msgf("gave up relaying change %d of task %s after %d attempts: %v",
+			record.ID, record.TaskID, failed.Attempts, relayErr)
+	} else {
+		log.Error().Msgf("failed to relay change %d of task %s: %v", record.ID, record.TaskID, relayErr)
+	}
+	return nil
+}
+
+// cleanupOutbox deletes the relayed changes older than outboxRetention
+func (server *Server) cleanupOutbox(ctx context.Context) error {
+	return server.database.DeleteProcessedTaskOutbox(ctx, pgtype.Timestamptz{
+		Time:  time.Now().Add(-outboxRetention),
+		Valid: true,
+	})
+}
+
+// relayOutbox applies a change to redis and publishes its events. The event sink must
+// acknowledge the event before the subscribers in redis are notified, so that a change
+// that fails is retried without notifying them twice.
+func (server *Server) relayOutbox(ctx context.Context, record db.TaskOutbox) error {
+	var task TaskInfo
+	if err := json.Unmarshal(record.Task, &task); err != nil {
+		return err
+	}
+	var previous *TaskInfo
+	if record.Previous != nil {
+		previous = &TaskInfo{}
+		if err := json.Unmarshal(record.Previous, previous); err != nil {
+			return err
+		}
+	}
+	if err := server.cacheTask(&task); err != nil {
+		return err
+	}
+	if err := server.publishSinkEvent(ctx, record.Event, &task); err != nil {
+		return err
+	}
+	server.broadcastTaskEvent(record.Event, previous, &task)
+	return nil
+}
+
+// ReconcileResult counts the tasks checked by Reconcile
+type ReconcileResult struct {
+	Checked  int `json:"checked"`
+	Missing  int `json:"missing"`
+	Repaired int `json:"repaired"`
+}
+
+// Reconcile compares the task records updated since the given time with the task info
+// in redis, and writes the records to redis where they disagree. The expired keys are
+// only counted, since the tasks are read from the database when they are missing in redis.
+func (server *Server) Reconcile(ctx context.Context, since time.Time) (ReconcileResult, error) {
+	var result ReconcileResult
+	if server.database == nil || server.cache == nil {
+		return result, errors.New("reconciliation needs both redis and the database")
+	}
+	var afterID int64
+	for {
+		records, err := server.database.ListTasksUpdatedSince(ctx, db.ListTasksUpdatedSinceParams{
+			UpdatedSince: since,
+			AfterID:      afterID,
+			MaxCount:     reconcileBatchSize,
+		})
+		if err != nil {
+			return result, err
+		}
+		for _, record := range records {
+			result.Checked++
+			repaired, missing, err := server.reconcileTask(ctx, record)
+			if err != nil {
+				return result, fmt.Errorf("failed to reconcile task %s: %w", record.TaskID, err)
+			}
+			if repaired {
+				result.Repaired++
+			}
+			if missing {
+				result.Missing++
+			}
+			afterID = record.ID
+		}
+		if len(records) < reconcileBatchSize {
+			return result, nil
+		}
+	}
+}
+
+func (server *Server) reconcileTask(ctx context.Context, record db.Task) (repaired bool, missing bool, err error) {
+	value, err := server.cache.GetKey(record.TaskID)
+	if errors.Is(err, storage.ErrKeyNotFound) {
+		return false, true, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	task := taskInfoFromRecord(record)
+	var cached TaskInfo
+	if e := json.Unmarshal([]byte(value), &cached); e == nil &&
+		cached.Version == task.Version && cached.Status == task.Status {
+		return false, false, nil
+	}
+	if cached.Version >= task.Version {
+		// Move the record ahead of redis, otherwise the write is skipped as stale
+		version := cached.Version + 1
+		_, err = server.database.UpdateTask(ctx, db.UpdateTaskParams{
+			Version:         pgtype.Int8{Int64: version, Valid: true},
+			TaskID:          record.TaskID,
+			ExpectedVersion: pgtype.Int8{Int64: record.Version, Valid: true},
+		})
+		if errors.Is(err, db.ErrRecordNotFound) {
+			// The task has been updated meanwhile, which writes it to redis
+			return false, false, nil
+		}
+		if err != nil {
+			return false, false, err
+		}
+		task.Version = version
+	}
+	return true, false, server.cacheTask(&task)
+}
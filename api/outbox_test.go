@@ -0,0 +1,296 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	mockdb "github.com/HyperGAI/serving-webhook/db/mock"
+	db "github.com/HyperGAI/serving-webhook/db/sqlc"
+	"github.com/HyperGAI/serving-webhook/storage"
+	mockstore "github.com/HyperGAI/serving-webhook/storage/mock"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"testing"
+	"time"
+)
+
+func TestWriteOutbox(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	database := mockdb.NewMockStore(ctrl)
+	server := newTestServer(t, nil, storage.NewMemoryCache(), database)
+
+	previous := TaskInfo{ID: "12345", Status: TaskStatusRunning, Version: 1, WebhookURL: "https://example.com"}
+	task := previous
+	task.Status = TaskStatusSucceeded
+	task.Version = 2
+
+	database.EXPECT().
+		CreateTaskOutbox(gomock.Any(), gomock.Any()).
+		Times(1).
+		DoAndReturn(func(_ interface{}, arg db.CreateTaskOutboxParams) (db.TaskOutbox, error) {
+			require.Equal(t, "12345", arg.TaskID)
+			require.Equal(t, TaskEventUpdated, arg.Event)
+			var got TaskInfo
+			require.NoError(t, json.Unmarshal(arg.Task, &got))
+			require.Equal(t, task, got)
+			require.NoError(t, json.Unmarshal(arg.Previous, &got))
+			require.Equal(t, previous, got)
+			return db.TaskOutbox{ID: 1}, nil
+		})
+	database.EXPECT().
+		CreateWebhookDelivery(gomock.Any(), gomock.Any()).
+		Times(1).
+		DoAndReturn(func(_ interface{}, arg db.CreateWebhookDeliveryParams) (db.WebhookDelivery, error) {
+			require.Equal(t, TaskStatusSucceeded, arg.Event)
+			return db.WebhookDelivery{ID: 1}, nil
+		})
+	require.NoError(t, server.writeOutbox(context.Background(), database, TaskEventUpdated, &previous, &task))
+
+	// A new task without a subscribed status has no callback
+	database.EXPECT().
+		CreateTaskOutbox(gomock.Any(), gomock.Any()).
+		Times(1).
+		DoAndReturn(func(_ interface{}, arg db.CreateTaskOutboxParams) (db.TaskOutbox, error) {
+			require.Equal(t, TaskEventCreated, arg.Event)
+			require.Nil(t, arg.Previous)
+			return db.TaskOutbox{ID: 2}, nil
+		})
+	require.NoError(t, server.writeOutbox(context.Background(), database, TaskEventCreated, nil, &previous))
+}
+
+func outboxRecord(t *testing.T, id int64, event string, previous *TaskInfo, task TaskInfo) db.TaskOutbox {
+	data, err := json.Marshal(task)
+	require.NoError(t, err)
+	record := db.TaskOutbox{ID: id, TaskID: task.ID, Event: event, Task: data}
+	if previous != nil {
+		record.Previous, err = json.Marshal(previous)
+		require.NoError(t, err)
+	}
+	return record
+}
+
+func TestProcessOutbox(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cache := storage.NewMemoryCache()
+	database := mockdb.NewMockStore(ctrl)
+	server := newTestServer(t, nil, cache, database)
+
+	subscription, err := cache.Subscribe(TaskEventsChannel)
+	require.NoError(t, err)
+	defer subscription.Close()
+
+	created := TaskInfo{ID: "12345", ModelName: "test_model", Status: TaskStatusPending, Version: 1}
+	running := created
+	running.Status = TaskStatusRunning
+	running.Version = 2
+	// A batch holds the earliest pending change of each task, a change that fails
+	// is counted and relayed again when its lease expires
+	database.EXPECT().
+		ClaimTaskOutbox(gomock.Any(), gomock.Any()).
+		Times(1).
+		Return([]db.TaskOutbox{
+			outboxRecord(t, 1, TaskEventCreated, nil, created),
+			{ID: 3, TaskID: "broken", Event: TaskEventCreated, Task: []byte("{"), Attempts: 0},
+		}, nil)
+	database.EXPECT().MarkTaskOutboxProcessed(gomock.Any(), gomock.Eq(int64(1))).Times(1).Return(nil)
+	database.EXPECT().
+		FailTaskOutbox(gomock.Any(), gomock.Any()).
+		Times(1).
+		DoAndReturn(func(_ context.Context, arg db.FailTaskOutboxParams) (db.TaskOutbox, error) {
+			require.Equal(t, int64(3), arg.ID)
+			require.Equal(t, int32(outboxMaxAttempts), arg.MaxAttempts)
+			require.True(t, arg.LastError.Valid)
+			return db.TaskOutbox{ID: 3, TaskID: "broken", Attempts: 1}, nil
+		})
+	count, err := server.processOutbox(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+
+	// The later change of the task is claimed once the earlier one is relayed
+	database.EXPECT().
+		ClaimTaskOutbox(gomock.Any(), gomock.Any()).
+		Times(1).
+		Return([]db.TaskOutbox{outboxRecord(t, 2, TaskEventUpdated, &created, running)}, nil)
+	database.EXPECT().MarkTaskOutboxProcessed(gomock.Any(), gomock.Eq(int64(2))).Times(1).Return(nil)
+	count, err = server.processOutbox(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+
+	value, err := cache.GetKey("12345")
+	require.NoError(t, err)
+	var task TaskInfo
+	require.NoError(t, json.Unmarshal([]byte(value), &task))
+	require.Equal(t, running, task)
+
+	for _, expected := range []string{TaskEventCreated, TaskEventUpdated} {
+		var event TaskEvent
+		require.NoError(t, json.Unmarshal([]byte(<-subscription.Channel()), &event))
+		require.Equal(t, expected, event.Type)
+	}
+
+	// A change that keeps failing is moved aside
+	database.EXPECT().
+		ClaimTaskOutbox(gomock.Any(), gomock.Any()).
+		Times(1).
+		Return([]db.TaskOutbox{{ID: 3, TaskID: "broken", Event: TaskEventCreated, Task: []byte("{")}}, nil)
+	database.EXPECT().
+		FailTaskOutbox(gomock.Any(), gomock.Any()).
+		Times(1).
+		Return(db.TaskOutbox{
+			ID:       3,
+			TaskID:   "broken",
+			Attempts: outboxMaxAttempts,
+			FailedAt: pgtype.Timestamptz{Time: time.Now(), Valid: true},
+		}, nil)
+	database.EXPECT().MarkTaskOutboxProcessed(gomock.Any(), gomock.Any()).Times(0)
+	_, err = server.processOutbox(context.Background())
+	require.NoError(t, err)
+
+	// A change relayed again doesn't overwrite a newer version
+	database.EXPECT().
+		ClaimTaskOutbox(gomock.Any(), gomock.Any()).
+		Times(1).
+		Return([]db.TaskOutbox{outboxRecord(t, 1, TaskEventCreated, nil, created)}, nil)
+	database.EXPECT().MarkTaskOutboxProcessed(gomock.Any(), gomock.Eq(int64(1))).Times(1).Return(nil)
+	_, err = server.processOutbox(context.Background())
+	require.NoError(t, err)
+	value, err = cache.GetKey("12345")
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal([]byte(value), &task))
+	require.Equal(t, running, task)
+}
+
+func TestProcessOutboxSink(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cache := storage.NewMemoryCache()
+	database := mockdb.NewMockStore(ctrl)
+	sink := mockstore.NewMockEventSink(ctrl)
+	server := newTestServer(t, nil, cache, database)
+	server.sink = sink
+
+	subscription, err := cache.Subscribe(TaskEventsChannel)
+	require.NoError(t, err)
+	defer subscription.Close()
+
+	created := TaskInfo{ID: "12345", ModelName: "test_model", Status: TaskStatusPending, Version: 1}
+	other := created
+	other.ID = "67890"
+	records := []db.TaskOutbox{
+		outboxRecord(t, 1, TaskEventCreated, nil, created),
+		outboxRecord(t, 2, TaskEventCreated, nil, other),
+	}
+
+	// The changes are not marked as relayed until the broker acknowledges their events,
+	// and an outage of the broker isn't counted as a failed attempt
+	database.EXPECT().ClaimTaskOutbox(gomock.Any(), gomock.Any()).Times(1).Return(records, nil)
+	sink.EXPECT().Publish(gomock.Any(), gomock.Any()).Times(1).Return(errors.New("unavailable"))
+	database.EXPECT().MarkTaskOutboxProcessed(gomock.Any(), gomock.Any()).Times(0)
+	database.EXPECT().FailTaskOutbox(gomock.Any(), gomock.Any()).Times(0)
+	_, err = server.processOutbox(context.Background())
+	require.ErrorIs(t, err, errSinkUnavailable)
+	select {
+	case <-subscription.Channel():
+		require.FailNow(t, "the subscribers are notified before the broker acknowledges the event")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// The changes are relayed again after their leases expire
+	var published []string
+	database.EXPECT().ClaimTaskOutbox(gomock.Any(), gomock.Any()).Times(1).Return(records, nil)
+	sink.EXPECT().
+		Publish(gomock.Any(), gomock.Any()).
+		Times(2).
+		DoAndReturn(func(_ context.Context, message storage.SinkMessage) error {
+			published = append(published, message.ID)
+			return nil
+		})
+	gomock.InOrder(
+		database.EXPECT().MarkTaskOutboxProcessed(gomock.Any(), gomock.Eq(int64(1))).Times(1).Return(nil),
+		database.EXPECT().MarkTaskOutboxProcessed(gomock.Any(), gomock.Eq(int64(2))).Times(1).Return(nil),
+	)
+	count, err := server.processOutbox(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+	require.Equal(t, []string{"12345-1", "67890-1"}, published)
+	// Nothing is queued for the background publisher
+	require.Empty(t, server.sinkQueue)
+}
+
+func TestReconcile(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cache := storage.NewMemoryCache()
+	database := mockdb.NewMockStore(ctrl)
+	server := newTestServer(t, nil, cache, database)
+
+	newRecord := func(id int64, taskID string, status string, version int64) db.Task {
+		return db.Task{
+			ID:        id,
+			TaskID:    taskID,
+			ModelName: "test_model",
+			Status:    pgtype.Text{String: status, Valid: true},
+			Version:   version,
+		}
+	}
+	records := []db.Task{
+		// In sync
+		newRecord(1, "synced", TaskStatusRunning, 2),
+		// Redis is behind the record
+		newRecord(2, "behind", TaskStatusSucceeded, 3),
+		// Redis was updated before the record had a version
+		newRecord(3, "legacy", TaskStatusSucceeded, 1),
+		// The key has expired
+		newRecord(4, "expired", TaskStatusSucceeded, 1),
+	}
+	require.NoError(t, cache.SetKey("synced", TaskInfo{ID: "synced", Status: TaskStatusRunning, Version: 2}, 0))
+	require.NoError(t, cache.SetKey("behind", TaskInfo{ID: "behind", Status: TaskStatusRunning, Version: 2}, 0))
+	require.NoError(t, cache.SetKey("legacy", TaskInfo{ID: "legacy", Status: TaskStatusRunning, Version: 4}, 0))
+
+	since := time.Now().Add(-time.Hour)
+	database.EXPECT().
+		ListTasksUpdatedSince(gomock.Any(), gomock.Eq(db.ListTasksUpdatedSinceParams{
+			UpdatedSince: since,
+			AfterID:      0,
+			MaxCount:     reconcileBatchSize,
+		})).
+		Times(1).
+		Return(records, nil)
+	database.EXPECT().
+		UpdateTask(gomock.Any(), gomock.Eq(db.UpdateTaskParams{
+			Version:         pgtype.Int8{Int64: 5, Valid: true},
+			TaskID:          "legacy",
+			ExpectedVersion: pgtype.Int8{Int64: 1, Valid: true},
+		})).
+		Times(1).
+		Return(db.Task{}, nil)
+
+	result, err := server.Reconcile(context.Background(), since)
+	require.NoError(t, err)
+	require.Equal(t, ReconcileResult{Checked: 4, Missing: 1, Repaired: 2}, result)
+
+	for id, expected := range map[string]TaskInfo{
+		"behind": {Status: TaskStatusSucceeded, Version: 3},
+		"legacy": {Status: TaskStatusSucceeded, Version: 5},
+	} {
+		value, err := cache.GetKey(id)
+		require.NoError(t, err)
+		var task TaskInfo
+		require.NoError(t, json.Unmarshal([]byte(value), &task))
+		require.Equal(t, expected.Status, task.Status)
+		require.Equal(t, expected.Version, task.Version)
+	}
+	_, err = cache.GetKey("expired")
+	require.ErrorIs(t, err, storage.ErrKeyNotFound)
+
+	// The reconciliation stops at the first error
+	database.EXPECT().
+		ListTasksUpdatedSince(gomock.Any(), gomock.Any()).
+		Times(1).
+		Return(nil, errors.New("connection refused"))
+	_, err = server.Reconcile(context.Background(), since)
+	require.Error(t, err)
+}
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	db "github.com/HyperGAI/serving-webhook/db/sqlc"
+	"github.com/HyperGAI/serving-webhook/storage"
+	"github.com/rs/zerolog/log"
+	"time"
+)
+
+const (
+	reaperInterval  = time.Minute
+	reaperBatchSize = 100
+	// activeTasksKey is the sorted set of the pending and running tasks in redis,
+	// scored by their update time, which is only kept without a database
+	activeTasksKey = "tasks:active"
+)
+
+// The statuses of the tasks that are timed out without updates, a queued task may
+// legitimately wait for a long time
+var reapableStatuses = []string{TaskStatusPending, TaskStatusRunning}
+
+func isReapableStatus(status string) bool {
+	for _, s := range reapableStatuses {
+		if status == s {
+			return true
+		}
+	}
+	return false
+}
+
+// trackTask keeps the pending and running tasks in the active set of redis,
+// so that the reaper can find them without a database
+func (server *Server) trackTask(task *TaskInfo) {
+	if server.database != nil || server.timeouts.min() <= 0 {
+		return
+	}
+	var err error
+	if isReapableStatus(task.Status) {
+		err = server.cache.AddToSortedSet(activeTasksKey, task.ID, float64(task.UpdatedAt.Unix()))
+	} else {
+		err = server.cache.RemoveFromSortedSet(activeTasksKey, task.ID)
+	}
+	if err != nil {
+		log.Error().Msgf("failed to track task %s: %v", task.ID, err)
+	}
+}
+
+// Reap times out the pending and running tasks without updates for longer than the
+// timeouts of their models, and returns the number of the timed out tasks. The tasks
+// are read from the database if there is one, or from the active set in redis.
+func (server *Server) Reap(ctx context.Context, now time.Time) (int, error) {
+	shortest := server.timeouts.min()
+	if shortest <= 0 {
+		return 0, nil
+	}
+	if server.database != nil {
+		return server.reapRecords(ctx, now, now.Add(-shortest))
+	}
+	return server.reapCache(ctx, now, now.Add(-shortest))
+}
+
+func (server *Server) reapRecords(ctx context.Context, now time.Time, updatedBefore time.Time) (int, error) {
+	count := 0
+	var afterID int64
+	for {
+		records, err := server.database.ListStaleTasks(ctx, db.ListStaleTasksParams{
+			Statuses:      reapableStatuses,
+			UpdatedBefore: updatedBefore,
+			AfterID:       afterID,
+			MaxCount:      reaperBatchSize,
+		})
+		if err != nil {
+			return count, err
+		}
+		for _, record := range records {
+			afterID = record.ID
+			task := taskInfoFromRecord(record)
+			task.Version = server.currentVersion(&task)
+			timedOut, err := server.reapTask(ctx, &task, now)
+			if err != nil {
+				return count, err
+			}
+			if timedOut {
+				count++
+			}
+		}
+		if len(records) < reaperBatchSize {
+			return count, nil
+		}
+	}
+}
+
+func (server *Server) reapCache(ctx context.Context, now time.Time, updatedBefore time.Time) (int, error) {
+	count := 0
+	var offset int64
+	for {
+		ids, err := server.cache.RangeByScore(activeTasksKey, float64(updatedBefore.Unix()), offset, reaperBatchSize)
+		if err != nil {
+			return count, err
+		}
+		for _, id := range ids {
+			value, err := server.cache.GetKey(id)
+			if err != nil && !errors.Is(err, storage.ErrKeyNotFound) {
+				return count, err
+			}
+			var task TaskInfo
+			if err != nil || json.Unmarshal([]byte(value), &task) != nil || !isReapableStatus(task.Status) {
+				// The task has expired or is no longer active
+				if err = server.cache.RemoveFromSortedSet(activeTasksKey, id); err != nil {
+					return count, err
+				}
+				continue
+			}
+			timedOut, err := server.reapTask(ctx, &task, now)
+			if err != nil {
+				return count, err
+			}
+			if timedOut {
+				count++
+				continue
+			}
+			// The task stays in the set, skip it in the next page
+			offset++
+		}
+		if len(ids) < reaperBatchSize {
+			return count, nil
+		}
+	}
+}
+
+// reapTask times out the task if it has no update for longer than the timeout of its model.
+// The task is only updated if it hasn't changed since it was read, which is not an error.
+func (server *Server) reapTask(ctx context.Context, task *TaskInfo, now time.Time) (bool, error) {
+	timeout := server.timeouts.get(task.ModelName)
+	updatedAt := task.UpdatedAt
+	if updatedAt.IsZero() {
+		updatedAt = task.CreatedAt
+	}
+	if timeout <= 0 || now.Sub(updatedAt) < timeout {
+		return false, nil
+	}
+	_, err := server.updateTask(ctx, &UpdateRequest{
+		ID:        task.ID,
+		Status:    TaskStatusTimedOut,
+		ErrorInfo: fmt.Sprintf("the task was %s without an update for %s", task.Status, timeout),
+	}, task.ETag())
+	if errors.Is(err, errVersionMismatch) || errors.Is(err, errInvalidTransition) || errors.Is(err, errTaskNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to time out task %s: %w", task.ID, err)
+	}
+	return true, nil
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	mockdb "github.com/HyperGAI/serving-webhook/db/mock"
+	db "github.com/HyperGAI/serving-webhook/db/sqlc"
+	"github.com/HyperGAI/serving-webhook/storage"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"testing"
+	"time"
+)
+
+func TestReapCache(t *testing.T) {
+	cache := storage.NewMemoryCache()
+	server := newTestServer(t, nil, cache, nil)
+	server.timeouts = modelDurations{
+		fallback: time.Hour,
+		models:   map[string]time.Duration{"slow_model": 3 * time.Hour},
+	}
+	subscription, err := cache.Subscribe(TaskEventsChannel)
+	require.NoError(t, err)
+	defer subscription.Close()
+
+	now := time.Now()
+	tasks := []TaskInfo{
+		{ID: "stuck", ModelName: "test_model", Status: TaskStatusRunning, UpdatedAt: now.Add(-2 * time.Hour), Version: 3},
+		{ID: "fresh", ModelName: "test_model", Status: TaskStatusRunning, UpdatedAt: now.Add(-time.Minute), Version: 3},
+		{ID: "slow", ModelName: "slow_model", Status: TaskStatusPending, UpdatedAt: now.Add(-2 * time.Hour), Version: 1},
+		{ID: "done", ModelName: "test_model", Status: TaskStatusSucceeded, UpdatedAt: now.Add(-2 * time.Hour), Version: 4},
+	}
+	for i := range tasks {
+		require.NoError(t, cache.SetKey(tasks[i].ID, tasks[i], 0))
+		require.NoError(t, cache.AddToSortedSet(activeTasksKey, tasks[i].ID, float64(tasks[i].UpdatedAt.Unix())))
+	}
+	// The key of a task has expired
+	require.NoError(t, cache.AddToSortedSet(activeTasksKey, "expired", float64(now.Add(-2*time.Hour).Unix())))
+
+	count, err := server.Reap(context.Background(), now)
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+
+	value, err := cache.GetKey("stuck")
+	require.NoError(t, err)
+	var task TaskInfo
+	require.NoError(t, json.Unmarshal([]byte(value), &task))
+	require.Equal(t, TaskStatusTimedOut, task.Status)
+	require.Equal(t, int64(4), task.Version)
+	require.Contains(t, task.ErrorInfo, "running without an update for 1h0m0s")
+
+	var event TaskEvent
+	require.NoError(t, json.Unmarshal([]byte(<-subscription.Channel()), &event))
+	require.Equal(t, TaskEventUpdated, event.Type)
+	require.Equal(t, TaskStatusTimedOut, event.Task.Status)
+
+	// Only the tasks that can still time out are kept in the active set
+	members, err := cache.RangeByScore(activeTasksKey, float64(now.Unix()), 0, 10)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"fresh", "slow"}, members)
+
+	// The slow model times out later
+	count, err = server.Reap(context.Background(), now.Add(2*time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+}
+
+func TestReapRecords(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cache := storage.NewMemoryCache()
+	database := mockdb.NewMockStore(ctrl)
+	server := newTestServer(t, nil, cache, database)
+	server.timeouts = modelDurations{
+		fallback: time.Hour,
+		models:   map[string]time.Duration{"slow_model": 3 * time.Hour, "fast_model": 30 * time.Minute},
+	}
+
+	now := time.Now()
+	newRecord := func(id int64, taskID string, modelName string, updatedAt time.Time, version int64) db.Task {
+		return db.Task{
+			ID:        id,
+			TaskID:    taskID,
+			ModelName: modelName,
+			Status:    pgtype.Text{String: TaskStatusRunning, Valid: true},
+			UpdatedAt: updatedAt,
+			Version:   version,
+		}
+	}
+	stuck := newRecord(1, "stuck", "test_model", now.Add(-2*time.Hour), 2)
+	slow := newRecord(2, "slow", "slow_model", now.Add(-2*time.Hour), 2)
+	changed := newRecord(3, "changed", "test_model", now.Add(-2*time.Hour), 2)
+
+	database.EXPECT().
+		ListStaleTasks(gomock.Any(), gomock.Eq(db.ListStaleTasksParams{
+			Statuses:      reapableStatuses,
+			UpdatedBefore: now.Add(-30 * time.Minute),
+			AfterID:       0,
+			MaxCount:      reaperBatchSize,
+		})).
+		Times(1).
+		Return([]db.Task{stuck, slow, changed}, nil)
+	database.EXPECT().GetTaskById(gomock.Any(), gomock.Eq("stuck")).Times(1).Return(stuck, nil)
+	database.EXPECT().ExecTx(gomock.Any(), gomock.Any()).Times(1).Return(nil)
+	// The task has been updated after it was listed
+	updated := changed
+	updated.UpdatedAt = now
+	updated.Version = 3
+	database.EXPECT().GetTaskById(gomock.Any(), gomock.Eq("changed")).Times(1).Return(updated, nil)
+
+	count, err := server.Reap(context.Background(), now)
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+
+	value, err := cache.GetKey("stuck")
+	require.NoError(t, err)
+	var task TaskInfo
+	require.NoError(t, json.Unmarshal([]byte(value), &task))
+	require.Equal(t, TaskStatusTimedOut, task.Status)
+	require.Equal(t, int64(3), task.Version)
+	_, err = cache.GetKey("changed")
+	require.ErrorIs(t, err, storage.ErrKeyNotFound)
+}
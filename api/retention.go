@@ -0,0 +1,179 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	db "github.com/HyperGAI/serving-webhook/db/sqlc"
+	"github.com/HyperGAI/serving-webhook/storage"
+	"github.com/rs/zerolog/log"
+	"net/url"
+	"time"
+)
+
+const (
+	retentionInterval = 24 * time.Hour
+	// retentionRetry is the time until a failed retention is retried
+	retentionRetry     = time.Hour
+	retentionBatchSize = 500
+	archivePrefix      = "archive/tasks"
+)
+
+// RetentionResult counts the tasks and the files removed by ApplyRetention
+type RetentionResult struct {
+	Archived int   `json:"archived"`
+	Deleted  int64 `json:"deleted"`
+	Files    int   `json:"files"`
+}
+
+// retentionEnabled returns whether the old tasks are removed, which needs the database
+// and the store for the archives
+func (server *Server) retentionEnabled() bool {
+	return server.retention.min() > 0 && server.database != nil && server.store != nil
+}
+
+// ApplyRetention archives the tasks older than the retention ages of their models to the
+// store as gzipped NDJSON, and deletes them afterwards. With RETENTION_DELETE_OUTPUTS,
+// the output files of the deleted tasks in the bucket are also deleted.
+func (server *Server) ApplyRetention(ctx context.Context, now time.Time) (RetentionResult, error) {
+	var result RetentionResult
+	if !server.retentionEnabled() {
+		return result, errors.New("the retention is disabled")
+	}
+	models, err := server.database.ListExpiredTaskModels(ctx, now.Add(-server.retention.min()))
+	if err != nil {
+		return result, err
+	}
+	for _, model := range models {
+		age := server.retention.get(model)
+		if age <= 0 {
+			continue
+		}
+		if err = server.expireTasks(ctx, model, now.Add(-age), now, &result); err != nil {
+			return result, fmt.Errorf("failed to remove the tasks of model %s: %w", model, err)
+		}
+	}
+	return result, nil
+}
+
+// expireTasks archives and deletes the finished tasks of a model created before the given
+// time in batches, a batch is only deleted after its archive is stored. The webhook
+// deliveries and the outbox changes of the tasks are deleted along with them.
+func (server *Server) expireTasks(
+	ctx context.Context,
+	model string,
+	createdBefore time.Time,
+	now time.Time,
+	result *RetentionResult,
+) error {
+	var afterID int64
+	for {
+		records, err := server.database.ListTasksBeforeDate(ctx, db.ListTasksBeforeDateParams{
+			ModelName:     model,
+			CreatedBefore: createdBefore,
+			Statuses:      terminalStatuses,
+			AfterID:       afterID,
+			MaxCount:      retentionBatchSize,
+		})
+		if err != nil || len(records) == 0 {
+			return err
+		}
+		first, last := records[0].ID, records[len(records)-1].ID
+		key := fmt.Sprintf("%s/%s/%s/%d-%d.ndjson.gz",
+			archivePrefix, url.PathEscape(model), now.UTC().Format("2006-01-02"), first, last)
+		if err = server.archiveTasks(key, records); err != nil {
+			return err
+		}
+		result.Archived += len(records)
+
+		ids := make([]int64, len(records))
+		for i, record := range records {
+			ids[i] = record.ID
+		}
+		deleted, err := server.database.DeleteTaskBeforeDate(ctx, db.DeleteTaskBeforeDateParams{
+			ModelName:     model,
+			CreatedBefore: createdBefore,
+			Statuses:      terminalStatuses,
+			IDs:           ids,
+		})
+		if err != nil {
+			return err
+		}
+		result.Deleted += deleted
+		if server.config.RetentionDeleteOutputs {
+			result.Files += server.deleteOutputFiles(records)
+		}
+		if len(records) < retentionBatchSize {
+			return nil
+		}
+		afterID = last
+	}
+}
+
+// archiveTasks stores the tasks privately as gzipped NDJSON in their public representation
+func (server *Server) archiveTasks(key string, records []db.Task) error {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	encoder := json.NewEncoder(writer)
+	for _, record := range records {
+		if err := encoder.Encode(taskV1FromRecord(record)); err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return server.store.PutPrivateObject(&buf, key)
+}
+
+// deleteOutputFiles deletes the files in the bucket that the outputs of the tasks link to,
+// and returns the number of the deleted files. The failures are only logged, since the
+// tasks are already deleted.
+func (server *Server) deleteOutputFiles(records []db.Task) int {
+	count := 0
+	for _, record := range records {
+		if record.Outputs == nil {
+			continue
+		}
+		var outputs interface{}
+		if err := json.Unmarshal(record.Outputs, &outputs); err != nil {
+			continue
+		}
+		for _, location := range outputURLs(outputs) {
+			key, ok := storage.ObjectKey(server.config.AWSBucket, location)
+			if !ok {
+				continue
+			}
+			if err := server.store.DeleteObject(key); err != nil {
+				log.Error().Msgf("failed to delete output %s of task %s: %v", key, record.TaskID, err)
+				continue
+			}
+			count++
+		}
+	}
+	return count
+}
+
+// outputURLs returns the strings in the outputs of a task, which may be the URLs of files
+func outputURLs(outputs interface{}) []string {
+	switch value := outputs.(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		var urls []string
+		for _, item := range value {
+			urls = append(urls, outputURLs(item)...)
+		}
+		return urls
+	case map[string]interface{}:
+		var urls []string
+		for _, item := range value {
+			urls = append(urls, outputURLs(item)...)
+		}
+		return urls
+	}
+	return nil
+}
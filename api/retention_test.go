@@ -0,0 +1,143 @@
+package api
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	mockdb "github.com/HyperGAI/serving-webhook/db/mock"
+	db "github.com/HyperGAI/serving-webhook/db/sqlc"
+	"github.com/HyperGAI/serving-webhook/storage"
+	mockstore "github.com/HyperGAI/serving-webhook/storage/mock"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"io"
+	"testing"
+	"time"
+)
+
+func newRetentionServer(t *testing.T, ctrl *gomock.Controller) (*Server, *mockstore.MockStore, *mockdb.MockStore) {
+	store := mockstore.NewMockStore(ctrl)
+	database := mockdb.NewMockStore(ctrl)
+	server := newTestServer(t, store, storage.NewMemoryCache(), database)
+	server.retention = modelDurations{
+		fallback: 30 * 24 * time.Hour,
+		models:   map[string]time.Duration{"short": 24 * time.Hour, "keep": 0},
+	}
+	server.config.AWSBucket = "bucket"
+	server.config.RetentionDeleteOutputs = true
+	return server, store, database
+}
+
+func TestApplyRetention(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	server, store, database := newRetentionServer(t, ctrl)
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	records := []db.Task{
+		{
+			ID:        1,
+			TaskID:    "first",
+			ModelName: "short",
+			Status:    pgtype.Text{String: TaskStatusSucceeded, Valid: true},
+			Outputs: []byte(`{"images": ["https://bucket.s3.us-east-2.amazonaws.com/1234.png",
+				"https://example.com/5678.png"], "seed": 42}`),
+			Version: 3,
+		},
+		{
+			ID:        2,
+			TaskID:    "second",
+			ModelName: "short",
+			Status:    pgtype.Text{String: TaskStatusFailed, Valid: true},
+			Version:   2,
+		},
+	}
+
+	database.EXPECT().
+		ListExpiredTaskModels(gomock.Any(), gomock.Eq(now.Add(-24*time.Hour))).
+		Times(1).
+		Return([]string{"keep", "short", "test_model"}, nil)
+	database.EXPECT().
+		ListTasksBeforeDate(gomock.Any(), gomock.Eq(db.ListTasksBeforeDateParams{
+			ModelName:     "short",
+			CreatedBefore: now.Add(-24 * time.Hour),
+			Statuses:      terminalStatuses,
+			AfterID:       0,
+			MaxCount:      retentionBatchSize,
+		})).
+		Times(1).
+		Return(records, nil)
+	store.EXPECT().
+		PutPrivateObject(gomock.Any(), gomock.Eq("archive/tasks/short/2024-03-01/1-2.ndjson.gz")).
+		Times(1).
+		DoAndReturn(func(reader io.Reader, _ string) error {
+			gz, err := gzip.NewReader(reader)
+			require.NoError(t, err)
+			var ids []string
+			scanner := bufio.NewScanner(gz)
+			for scanner.Scan() {
+				var task TaskV1
+				require.NoError(t, json.Unmarshal(scanner.Bytes(), &task))
+				require.Equal(t, TaskAPIVersion, task.APIVersion)
+				ids = append(ids, task.ID)
+			}
+			require.Equal(t, []string{"first", "second"}, ids)
+			return nil
+		})
+	database.EXPECT().
+		DeleteTaskBeforeDate(gomock.Any(), gomock.Eq(db.DeleteTaskBeforeDateParams{
+			ModelName:     "short",
+			CreatedBefore: now.Add(-24 * time.Hour),
+			Statuses:      terminalStatuses,
+			IDs:           []int64{1, 2},
+		})).
+		Times(1).
+		Return(int64(2), nil)
+	// Only the files in the bucket are deleted
+	store.EXPECT().DeleteObject(gomock.Eq("1234.png")).Times(1).Return(nil)
+	database.EXPECT().
+		ListTasksBeforeDate(gomock.Any(), gomock.Eq(db.ListTasksBeforeDateParams{
+			ModelName:     "test_model",
+			CreatedBefore: now.Add(-30 * 24 * time.Hour),
+			Statuses:      terminalStatuses,
+			AfterID:       0,
+			MaxCount:      retentionBatchSize,
+		})).
+		Times(1).
+		Return([]db.Task{}, nil)
+
+	result, err := server.ApplyRetention(context.Background(), now)
+	require.NoError(t, err)
+	require.Equal(t, RetentionResult{Archived: 2, Deleted: 2, Files: 1}, result)
+}
+
+func TestApplyRetentionArchiveFailed(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	server, store, database := newRetentionServer(t, ctrl)
+
+	database.EXPECT().
+		ListExpiredTaskModels(gomock.Any(), gomock.Any()).
+		Times(1).
+		Return([]string{"short"}, nil)
+	database.EXPECT().
+		ListTasksBeforeDate(gomock.Any(), gomock.Any()).
+		Times(1).
+		Return([]db.Task{{ID: 1, TaskID: "first", ModelName: "short"}}, nil)
+	store.EXPECT().PutPrivateObject(gomock.Any(), gomock.Any()).Times(1).Return(errors.New("access denied"))
+	// The tasks are kept if they cannot be archived
+	database.EXPECT().DeleteTaskBeforeDate(gomock.Any(), gomock.Any()).Times(0)
+
+	_, err := server.ApplyRetention(context.Background(), time.Now())
+	require.Error(t, err)
+}
+
+func TestOutputURLs(t *testing.T) {
+	var outputs interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{"a": "x", "b": [1, "y", {"c": "z"}], "d": null}`), &outputs))
+	require.ElementsMatch(t, []string{"x", "y", "z"}, outputURLs(outputs))
+	require.Nil(t, outputURLs(nil))
+}
@@ -2,10 +2,14 @@ package api
 
 import (
 	db "github.com/HyperGAI/serving-webhook/db/sqlc"
+	"github.com/HyperGAI/serving-webhook/scheduler"
 	"github.com/HyperGAI/serving-webhook/storage"
 	"github.com/HyperGAI/serving-webhook/utils"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"net/http"
+	"os"
+	"sync/atomic"
 )
 
 type Server struct {
@@ -14,6 +18,29 @@ type Server struct {
 	store    storage.Store
 	cache    storage.Cache
 	database db.Store
+	scanner  storage.Scanner
+	hub      *taskHub
+	// webhookClient posts the task info to the webhooks of tasks
+	webhookClient *http.Client
+	// cloudEventClient sends the task events to K_SINK, which may be a cluster-internal broker
+	cloudEventClient *http.Client
+	// webhookWake notifies the webhook worker of new deliveries
+	webhookWake chan struct{}
+	// outboxWake notifies the outbox relay of committed changes
+	outboxWake chan struct{}
+	// sink receives the task events from sinkQueue, it is nil if EVENT_SINK is not set
+	sink      storage.EventSink
+	sinkQueue chan storage.SinkMessage
+	// sinkDropped counts the events dropped because sinkQueue was full
+	sinkDropped atomic.Int64
+	// timeouts are the per-model timeouts of the stale tasks
+	timeouts modelDurations
+	// retention are the per-model ages after which the tasks are archived and deleted
+	retention modelDurations
+	// instanceID identifies this replica, e.g., as the holder of a lock in redis
+	instanceID string
+	// scheduler runs the periodic jobs on the leader, it is nil until NewScheduler is called
+	scheduler *scheduler.Scheduler
 }
 
 func NewServer(
@@ -22,17 +49,57 @@ func NewServer(
 	cache storage.Cache,
 	database db.Store,
 ) (*Server, error) {
+	scanner, err := storage.NewScanner(config)
+	if err != nil {
+		return nil, err
+	}
+	webhookClient, err := newWebhookClient(config)
+	if err != nil {
+		return nil, err
+	}
+	sink, err := storage.NewEventSink(config)
+	if err != nil {
+		return nil, err
+	}
+	timeouts, err := parseModelDurations(config.TaskTimeout, config.TaskModelTimeouts)
+	if err != nil {
+		return nil, err
+	}
+	retention, err := parseModelDurations(config.RetentionAge, config.RetentionModelAges)
+	if err != nil {
+		return nil, err
+	}
 	server := Server{
-		config:   config,
-		router:   nil,
-		store:    store,
-		cache:    cache,
-		database: database,
+		config:           config,
+		router:           nil,
+		store:            store,
+		cache:            cache,
+		database:         database,
+		scanner:          scanner,
+		hub:              newTaskHub(cache),
+		webhookClient:    webhookClient,
+		cloudEventClient: &http.Client{Timeout: webhookClient.Timeout},
+		webhookWake:      make(chan struct{}, 1),
+		outboxWake:       make(chan struct{}, 1),
+		sink:             sink,
+		sinkQueue:        make(chan storage.SinkMessage, sinkQueueSize),
+		timeouts:         timeouts,
+		retention:        retention,
+		instanceID:       newInstanceID(),
 	}
 	server.setupRouter()
 	return &server, nil
 }
 
+// newInstanceID returns the host name with a random suffix, since a pod may be restarted
+func newInstanceID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return hostname + "-" + uuid.NewString()[:8]
+}
+
 func (server *Server) setupRouter() {
 	router := gin.Default()
 	router.MaxMultipartMemory = 32 << 20 // 32 MiB
@@ -41,6 +108,8 @@ func (server *Server) setupRouter() {
 	router.GET("/ready", server.checkHealth)
 
 	taskRoutes := router.Group("/").Use(authMiddleware(server.config))
+	taskRoutes.GET("/admin/jobs", server.ListJobs)
+	taskRoutes.GET("/admin/sink", server.SinkStats)
 	if server.store != nil {
 		taskRoutes.POST("/upload", server.Upload)
 		taskRoutes.POST("/upload_batch", server.UploadBatch)
@@ -49,8 +118,22 @@ func (server *Server) setupRouter() {
 		taskRoutes.POST("/task", server.Create)
 		taskRoutes.GET("/task/:id", server.Get)
 		taskRoutes.PUT("/task", server.Update)
+		taskRoutes.POST("/task/:id/cancel", server.Cancel)
+		taskRoutes.GET("/task/:id/events", server.Events)
+		taskRoutes.GET("/task/subscribe", server.Subscribe)
 		// If database is not set, it will return an empty list
 		taskRoutes.GET("/task/modelstatus", server.GetTaskByModelStatus)
+		if server.database != nil {
+			taskRoutes.GET("/tasks", server.ListTasks)
+			taskRoutes.GET("/users/:uid/tasks", server.UserTasks)
+			taskRoutes.GET("/me/tasks", server.MyTasks)
+			taskRoutes.GET("/stats", server.Stats)
+			taskRoutes.GET("/usage/export", server.ExportUsage)
+			taskRoutes.GET("/task/:id/deliveries", server.ListDeliveries)
+			taskRoutes.POST("/task/:id/deliveries/:delivery_id/redeliver", server.Redeliver)
+			taskRoutes.POST("/webhook/secret", server.RotateWebhookSecret)
+		}
+		taskRoutes.POST("/cloudevents", server.IngestCloudEvent)
 	}
 	server.router = router
 }
@@ -70,3 +153,8 @@ func (server *Server) checkHealth(ctx *gin.Context) {
 func errorResponse(err error) gin.H {
 	return gin.H{"error": err.Error()}
 }
+
+// errorCodeResponse adds a machine-readable code to the error body
+func errorCodeResponse(code string, err error) gin.H {
+	return gin.H{"error": err.Error(), "code": code}
+}
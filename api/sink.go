@@ -0,0 +1,170 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/HyperGAI/serving-webhook/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"time"
+)
+
+const (
+	sinkQueueSize      = 10000
+	sinkPublishTimeout = 10 * time.Second
+	sinkRetryBase      = 100 * time.Millisecond
+	sinkRetryMax       = 30 * time.Second
+	sinkDrainTimeout   = 10 * time.Second
+)
+
+var (
+	errSinkDisabled    = errors.New("the event sink is not set")
+	errSinkUnavailable = errors.New("the event sink is unavailable")
+)
+
+// queueSinkEvent queues a structured cloud event for the event sink without a database.
+// It never blocks the request: if the queue of sinkQueueSize events is full, e.g., while the broker is down,
+// the event is dropped and counted in sinkDropped.
+func (server *Server) queueSinkEvent(event *CloudEvent) {
+	if server.sink == nil {
+		return
+	}
+	message, err := newSinkMessage(event)
+	if err != nil {
+		log.Error().Msgf("failed to marshal cloud event %s: %v", event.ID, err)
+		return
+	}
+	select {
+	case server.sinkQueue <- message:
+	default:
+		dropped := server.sinkDropped.Add(1)
+		log.Error().Msgf("the event sink queue is full, event %s is dropped (%d in total)", event.ID, dropped)
+	}
+}
+
+// publishSinkEvent publishes the event of a change relayed from the outbox to the event
+// sink, and returns once the broker acknowledges it. The change is only marked as relayed
+// after that, so the event is delivered at least once even if the replica crashes.
+func (server *Server) publishSinkEvent(ctx context.Context, eventType string, task *TaskInfo) error {
+	if server.sink == nil {
+		return nil
+	}
+	event, err := server.newTaskCloudEvent(eventType, task)
+	if err != nil {
+		return err
+	}
+	message, err := newSinkMessage(event)
+	if err != nil {
+		return err
+	}
+	publishCtx, cancel := context.WithTimeout(ctx, sinkPublishTimeout)
+	defer cancel()
+	if err = server.sink.Publish(publishCtx, message); err != nil {
+		return fmt.Errorf("%w: %v", errSinkUnavailable, err)
+	}
+	return nil
+}
+
+func newSinkMessage(event *CloudEvent) (storage.SinkMessage, error) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return storage.SinkMessage{}, err
+	}
+	return storage.SinkMessage{ID: event.ID, Key: event.Subject, Data: data}, nil
+}
+
+// SinkStatsResponse reports the queue of the event sink on this replica
+type SinkStatsResponse struct {
+	Queued   int   `json:"queued"`
+	Capacity int   `json:"capacity"`
+	Dropped  int64 `json:"dropped"`
+}
+
+// SinkStats returns the number of the queued events, and the number of the events
+// dropped because the queue was full since this replica started
+func (server *Server) SinkStats(ctx *gin.Context) {
+	if server.sink == nil {
+		ctx.JSON(http.StatusServiceUnavailable, errorResponse(errSinkDisabled))
+		return
+	}
+	ctx.JSON(http.StatusOK, SinkStatsResponse{
+		Queued:   len(server.sinkQueue),
+		Capacity: cap(server.sinkQueue),
+		Dropped:  server.sinkDropped.Load(),
+	})
+}
+
+// RunEventSink publishes the queued events in order until the context is canceled,
+// retrying each event with exponential backoff until the broker acknowledges it.
+// The remaining events are flushed before closing the sink.
+func (server *Server) RunEventSink(ctx context.Context) {
+	if server.sink == nil {
+		return
+	}
+	defer func() {
+		if err := server.sink.Close(); err != nil {
+			log.Error().Msgf("failed to close the event sink: %v", err)
+		}
+	}()
+	for {
+		select {
+		case message := <-server.sinkQueue:
+			if !server.publishSinkMessage(ctx, message) {
+				// The shutdown interrupted the retries, so the message goes before the queued ones
+				server.drainEventSink(message)
+				return
+			}
+		case <-ctx.Done():
+			server.drainEventSink()
+			return
+		}
+	}
+}
+
+// publishSinkMessage retries a message until the broker acknowledges it, and returns
+// false if the context is canceled first
+func (server *Server) publishSinkMessage(ctx context.Context, message storage.SinkMessage) bool {
+	delay := sinkRetryBase
+	for {
+		publishCtx, cancel := context.WithTimeout(context.Background(), sinkPublishTimeout)
+		err := server.sink.Publish(publishCtx, message)
+		cancel()
+		if err == nil {
+			return true
+		}
+		log.Error().Msgf("failed to publish event %s, retry in %s: %v", message.ID, delay, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return false
+		}
+		delay *= 2
+		if delay > sinkRetryMax {
+			delay = sinkRetryMax
+		}
+	}
+}
+
+// drainEventSink tries to publish the pending and the queued events once during shutdown
+func (server *Server) drainEventSink(pending ...storage.SinkMessage) {
+	ctx, cancel := context.WithTimeout(context.Background(), sinkDrainTimeout)
+	defer cancel()
+	for _, message := range pending {
+		if err := server.sink.Publish(ctx, message); err != nil {
+			log.Error().Msgf("failed to publish event %s during shutdown: %v", message.ID, err)
+		}
+	}
+	for {
+		select {
+		case message := <-server.sinkQueue:
+			if err := server.sink.Publish(ctx, message); err != nil {
+				log.Error().Msgf("failed to publish event %s during shutdown: %v", message.ID, err)
+			}
+		default:
+			return
+		}
+	}
+}
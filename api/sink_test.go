@@ -0,0 +1,140 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/HyperGAI/serving-webhook/storage"
+	mockstore "github.com/HyperGAI/serving-webhook/storage/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestEventSink(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	sink := mockstore.NewMockEventSink(ctrl)
+	server := newTestServer(t, nil, storage.NewMemoryCache(), nil)
+	server.sink = sink
+
+	published := make(chan storage.SinkMessage, 10)
+	record := func(_ context.Context, message storage.SinkMessage) error {
+		published <- message
+		return nil
+	}
+	// The first event is retried until the broker acknowledges it
+	gomock.InOrder(
+		sink.EXPECT().Publish(gomock.Any(), gomock.Any()).Times(2).Return(errors.New("unavailable")),
+		sink.EXPECT().Publish(gomock.Any(), gomock.Any()).Times(3).DoAndReturn(record),
+	)
+	sink.EXPECT().Close().Times(1).Return(nil)
+
+	task := &TaskInfo{ID: "12345", Status: TaskStatusPending, Version: 1}
+	server.publishTaskEvent(TaskEventCreated, nil, task)
+	previous := *task
+	task.Status, task.Version = TaskStatusRunning, 2
+	server.publishTaskEvent(TaskEventUpdated, &previous, task)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		server.RunEventSink(ctx)
+	}()
+
+	receive := func() CloudEvent {
+		select {
+		case message := <-published:
+			var event CloudEvent
+			require.NoError(t, json.Unmarshal(message.Data, &event))
+			require.Equal(t, event.ID, message.ID)
+			require.Equal(t, "12345", message.Key)
+			return event
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "no event is published")
+		}
+		return CloudEvent{}
+	}
+	event := receive()
+	require.Equal(t, "12345-1", event.ID)
+	require.Equal(t, cloudEventTypePrefix+TaskEventCreated, event.Type)
+	event = receive()
+	require.Equal(t, "12345-2", event.ID)
+
+	// The sink is closed on shutdown, and the queued events are flushed
+	cancel()
+	<-done
+	previous = *task
+	task.Status, task.Version = TaskStatusSucceeded, 3
+	server.publishTaskEvent(TaskEventUpdated, &previous, task)
+	server.drainEventSink()
+	event = receive()
+	require.Equal(t, cloudEventTypePrefix+TaskStatusSucceeded, event.Type)
+}
+
+func TestEventSinkShutdown(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	sink := mockstore.NewMockEventSink(ctrl)
+	server := newTestServer(t, nil, storage.NewMemoryCache(), nil)
+	server.sink = sink
+
+	ctx, cancel := context.WithCancel(context.Background())
+	published := make(chan storage.SinkMessage, 10)
+	// The broker is down until the shutdown, then the message being retried is
+	// published before the queued one
+	gomock.InOrder(
+		sink.EXPECT().Publish(gomock.Any(), gomock.Any()).Times(1).
+			DoAndReturn(func(context.Context, storage.SinkMessage) error {
+				cancel()
+				return errors.New("unavailable")
+			}),
+		sink.EXPECT().Publish(gomock.Any(), gomock.Any()).Times(2).
+			DoAndReturn(func(_ context.Context, message storage.SinkMessage) error {
+				published <- message
+				return nil
+			}),
+	)
+	sink.EXPECT().Close().Times(1).Return(nil)
+
+	task := &TaskInfo{ID: "12345", Status: TaskStatusPending, Version: 1}
+	server.publishTaskEvent(TaskEventCreated, nil, task)
+	previous := *task
+	task.Status, task.Version = TaskStatusRunning, 2
+	server.publishTaskEvent(TaskEventUpdated, &previous, task)
+
+	server.RunEventSink(ctx)
+	require.Len(t, published, 2)
+	require.Equal(t, "12345-1", (<-published).ID)
+	require.Equal(t, "12345-2", (<-published).ID)
+}
+
+func TestSinkQueueFull(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	server := newTestServer(t, nil, storage.NewMemoryCache(), nil)
+	server.sink = mockstore.NewMockEventSink(ctrl)
+	server.sinkQueue = make(chan storage.SinkMessage, 1)
+
+	// The request is not blocked when the queue is full, the event is dropped and counted
+	start := time.Now()
+	task := &TaskInfo{ID: "12345", Status: TaskStatusPending, Version: 1}
+	server.publishTaskEvent(TaskEventCreated, nil, task)
+	previous := *task
+	task.Status, task.Version = TaskStatusRunning, 2
+	server.publishTaskEvent(TaskEventUpdated, &previous, task)
+	require.Less(t, time.Since(start), time.Second)
+
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodGet, "/admin/sink", nil)
+	require.NoError(t, err)
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var res SinkStatsResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &res))
+	require.Equal(t, SinkStatsResponse{Queued: 1, Capacity: 1, Dropped: 1}, res)
+}
@@ -0,0 +1,177 @@
+package api
+
+import (
+	"fmt"
+	db "github.com/HyperGAI/serving-webhook/db/sqlc"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgtype"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultStatsWindow = 24 * time.Hour
+	maxStatsWindow     = 90 * 24 * time.Hour
+	defaultStatsUsers  = 100
+)
+
+// StatsRequest selects the tasks created in [since, until). Without since, the window
+// is the duration before until, which defaults to now.
+type StatsRequest struct {
+	Since     time.Time `form:"since"`
+	Until     time.Time `form:"until"`
+	Window    string    `form:"window"`
+	ModelName string    `form:"model_name"`
+	Users     int32     `form:"users" binding:"omitempty,min=1,max=1000"`
+}
+
+// RunningTimeStats are the percentiles of the running time of the succeeded tasks in seconds
+type RunningTimeStats struct {
+	P50 float64 `json:"p50"`
+	P95 float64 `json:"p95"`
+	P99 float64 `json:"p99"`
+}
+
+type ModelStats struct {
+	ModelName string `json:"model_name"`
+	Total     int64  `json:"total"`
+	Succeeded int64  `json:"succeeded"`
+	// Failed counts the failed and timed out tasks
+	Failed int64 `json:"failed"`
+	// FailureRate is the share of the failed tasks in the succeeded and failed tasks
+	FailureRate float64 `json:"failure_rate"`
+	// Throughput is the number of succeeded tasks per hour
+	Throughput  float64          `json:"throughput"`
+	RunningTime RunningTimeStats `json:"running_time"`
+}
+
+type UserStats struct {
+	UserID    string `json:"user_id"`
+	Total     int64  `json:"total"`
+	Succeeded int64  `json:"succeeded"`
+	// RunningTime is the total running time of the tasks in seconds
+	RunningTime float64 `json:"running_time"`
+}
+
+type StatsResponse struct {
+	Since  time.Time        `json:"since"`
+	Until  time.Time        `json:"until"`
+	Counts map[string]int64 `json:"counts"`
+	Models []ModelStats     `json:"models"`
+	// Users are the users with the longest total running time
+	Users []UserStats `json:"users"`
+}
+
+// statsWindow validates the time window of the request
+func statsWindow(req *StatsRequest) (time.Time, time.Time, error) {
+	until := req.Until
+	if until.IsZero() {
+		until = time.Now()
+	}
+	since := req.Since
+	if since.IsZero() {
+		window := defaultStatsWindow
+		if req.Window != "" {
+			duration, err := time.ParseDuration(req.Window)
+			if err != nil || duration <= 0 {
+				return since, until, fmt.Errorf("%w: invalid window %q", errInvalidQuery, req.Window)
+			}
+			window = duration
+		}
+		since = until.Add(-window)
+	}
+	if !since.Before(until) {
+		return since, until, fmt.Errorf("%w: since must be before until", errInvalidQuery)
+	}
+	if until.Sub(since) > maxStatsWindow {
+		return since, until, fmt.Errorf("%w: the window is longer than %s", errInvalidQuery, maxStatsWindow)
+	}
+	return since, until, nil
+}
+
+/*
+curl "http://localhost:12000/stats?window=24h&model_name=<MODEL_NAME>"
+*/
+
+// Stats returns the aggregates of the tasks created in a time window
+func (server *Server) Stats(ctx *gin.Context) {
+	var req StatsRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	since, until, err := statsWindow(&req)
+	if hasError(ctx, err) {
+		return
+	}
+	modelName := pgtype.Text{String: req.ModelName, Valid: req.ModelName != ""}
+	users := req.Users
+	if users == 0 {
+		users = defaultStatsUsers
+	}
+
+	counts, err := server.database.CountTasksByStatus(ctx, db.CountTasksByStatusParams{
+		Since:     since,
+		Until:     until,
+		ModelName: modelName,
+	})
+	if hasError(ctx, err) {
+		return
+	}
+	models, err := server.database.GetModelStats(ctx, db.GetModelStatsParams{
+		Since:     since,
+		Until:     until,
+		ModelName: modelName,
+	})
+	if hasError(ctx, err) {
+		return
+	}
+	userStats, err := server.database.GetUserStats(ctx, db.GetUserStatsParams{
+		Since:     since,
+		Until:     until,
+		ModelName: modelName,
+		MaxCount:  users,
+	})
+	if hasError(ctx, err) {
+		return
+	}
+
+	res := StatsResponse{
+		Since:  since,
+		Until:  until,
+		Counts: make(map[string]int64, len(counts)),
+		Models: make([]ModelStats, 0, len(models)),
+		Users:  make([]UserStats, 0, len(userStats)),
+	}
+	for _, row := range counts {
+		res.Counts[row.Status.String] += row.Count
+	}
+	hours := until.Sub(since).Hours()
+	for _, row := range models {
+		stats := ModelStats{
+			ModelName:  row.ModelName,
+			Total:      row.Total,
+			Succeeded:  row.Succeeded,
+			Failed:     row.Failed,
+			Throughput: float64(row.Succeeded) / hours,
+			RunningTime: RunningTimeStats{
+				P50: row.P50,
+				P95: row.P95,
+				P99: row.P99,
+			},
+		}
+		if finished := row.Succeeded + row.Failed; finished > 0 {
+			stats.FailureRate = float64(row.Failed) / float64(finished)
+		}
+		res.Models = append(res.Models, stats)
+	}
+	for _, row := range userStats {
+		res.Users = append(res.Users, UserStats{
+			UserID:      row.UserID,
+			Total:       row.Total,
+			Succeeded:   row.Succeeded,
+			RunningTime: row.RunningTime,
+		})
+	}
+	ctx.JSON(http.StatusOK, res)
+}
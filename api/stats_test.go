@@ -0,0 +1,206 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	mockdb "github.com/HyperGAI/serving-webhook/db/mock"
+	db "github.com/HyperGAI/serving-webhook/db/sqlc"
+	mockstore "github.com/HyperGAI/serving-webhook/storage/mock"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	since := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	until := since.Add(10 * time.Hour)
+	model := pgtype.Text{String: "test_model", Valid: true}
+
+	testCases := []struct {
+		name          string
+		query         string
+		buildStubs    func(database *mockdb.MockStore)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:  "OK",
+			query: "?since=2024-01-01T00:00:00Z&until=2024-01-01T10:00:00Z&model_name=test_model&users=5",
+			buildStubs: func(database *mockdb.MockStore) {
+				database.EXPECT().
+					CountTasksByStatus(gomock.Any(), gomock.Eq(db.CountTasksByStatusParams{
+						Since:     since,
+						Until:     until,
+						ModelName: model,
+					})).
+					Times(1).
+					Return([]db.CountTasksByStatusRow{
+						{Status: pgtype.Text{String: "succeeded", Valid: true}, Count: 30},
+						{Status: pgtype.Text{String: "failed", Valid: true}, Count: 6},
+						{Status: pgtype.Text{String: "timed_out", Valid: true}, Count: 4},
+					}, nil)
+				database.EXPECT().
+					GetModelStats(gomock.Any(), gomock.Eq(db.GetModelStatsParams{
+						Since:     since,
+						Until:     until,
+						ModelName: model,
+					})).
+					Times(1).
+					Return([]db.GetModelStatsRow{
+						{ModelName: "test_model", Total: 40, Succeeded: 30, Failed: 10, P50: 1.5, P95: 4, P99: 9},
+					}, nil)
+				database.EXPECT().
+					GetUserStats(gomock.Any(), gomock.Eq(db.GetUserStatsParams{
+						Since:     since,
+						Until:     until,
+						ModelName: model,
+						MaxCount:  5,
+					})).
+					Times(1).
+					Return([]db.GetUserStatsRow{
+						{UserID: "alice", Total: 25, Succeeded: 20, RunningTime: 50},
+						{UserID: "", Total: 15, Succeeded: 10, RunningTime: 20},
+					}, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				var res StatsResponse
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &res))
+				require.True(t, since.Equal(res.Since))
+				require.True(t, until.Equal(res.Until))
+				require.Equal(t, map[string]int64{"succeeded": 30, "failed": 6, "timed_out": 4}, res.Counts)
+				require.Equal(t, []ModelStats{{
+					ModelName:   "test_model",
+					Total:       40,
+					Succeeded:   30,
+					Failed:      10,
+					FailureRate: 0.25,
+					Throughput:  3,
+					RunningTime: RunningTimeStats{P50: 1.5, P95: 4, P99: 9},
+				}}, res.Models)
+				require.Len(t, res.Users, 2)
+				require.Equal(t, UserStats{UserID: "alice", Total: 25, Succeeded: 20, RunningTime: 50}, res.Users[0])
+			},
+		},
+		{
+			name:  "Default window",
+			query: "",
+			buildStubs: func(database *mockdb.MockStore) {
+				database.EXPECT().
+					CountTasksByStatus(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ interface{}, arg db.CountTasksByStatusParams) ([]db.CountTasksByStatusRow, error) {
+						require.Equal(t, defaultStatsWindow, arg.Until.Sub(arg.Since))
+						require.WithinDuration(t, time.Now(), arg.Until, time.Minute)
+						require.False(t, arg.ModelName.Valid)
+						return []db.CountTasksByStatusRow{}, nil
+					})
+				database.EXPECT().
+					GetModelStats(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return([]db.GetModelStatsRow{{ModelName: "idle"}}, nil)
+				database.EXPECT().
+					GetUserStats(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ interface{}, arg db.GetUserStatsParams) ([]db.GetUserStatsRow, error) {
+						require.Equal(t, int32(defaultStatsUsers), arg.MaxCount)
+						return []db.GetUserStatsRow{}, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				var res StatsResponse
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &res))
+				// A model without finished tasks has no failure rate
+				require.Equal(t, []ModelStats{{ModelName: "idle"}}, res.Models)
+				require.Empty(t, res.Users)
+			},
+		},
+		{
+			name:  "Window",
+			query: "?window=1h&until=2024-01-01T10:00:00Z",
+			buildStubs: func(database *mockdb.MockStore) {
+				database.EXPECT().
+					CountTasksByStatus(gomock.Any(), gomock.Eq(db.CountTasksByStatusParams{
+						Since: until.Add(-time.Hour),
+						Until: until,
+					})).
+					Times(1).
+					Return([]db.CountTasksByStatusRow{}, nil)
+				database.EXPECT().GetModelStats(gomock.Any(), gomock.Any()).Times(1).Return([]db.GetModelStatsRow{}, nil)
+				database.EXPECT().GetUserStats(gomock.Any(), gomock.Any()).Times(1).Return([]db.GetUserStatsRow{}, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:  "Invalid window",
+			query: "?window=-1h",
+			buildStubs: func(database *mockdb.MockStore) {
+				database.EXPECT().CountTasksByStatus(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:  "Since after until",
+			query: "?since=2024-01-02T00:00:00Z&until=2024-01-01T00:00:00Z",
+			buildStubs: func(database *mockdb.MockStore) {
+				database.EXPECT().CountTasksByStatus(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:  "Window too long",
+			query: "?window=10000h",
+			buildStubs: func(database *mockdb.MockStore) {
+				database.EXPECT().CountTasksByStatus(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:  "Database error",
+			query: "",
+			buildStubs: func(database *mockdb.MockStore) {
+				database.EXPECT().CountTasksByStatus(gomock.Any(), gomock.Any()).Times(1).Return([]db.CountTasksByStatusRow{}, nil)
+				database.EXPECT().
+					GetModelStats(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil, errors.New("connection refused"))
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			database := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(database)
+
+			server := newTestServer(t, nil, mockstore.NewMockCache(ctrl), database)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodGet, "/stats"+tc.query, nil)
+			require.NoError(t, err)
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+)
+
+// The lifecycle of a task: pending -> queued -> running -> succeeded/failed/canceled/timed_out.
+// A task can skip intermediate states but never moves backwards, and the terminal
+// states are immutable.
+const (
+	TaskStatusPending   = "pending"
+	TaskStatusQueued    = "queued"
+	TaskStatusRunning   = "running"
+	TaskStatusSucceeded = "succeeded"
+	TaskStatusFailed    = "failed"
+	TaskStatusCanceled  = "canceled"
+	TaskStatusTimedOut  = "timed_out"
+)
+
+var taskStatusStage = map[string]int{
+	TaskStatusPending:   0,
+	TaskStatusQueued:    1,
+	TaskStatusRunning:   2,
+	TaskStatusSucceeded: 3,
+	TaskStatusFailed:    3,
+	TaskStatusCanceled:  3,
+	TaskStatusTimedOut:  3,
+}
+
+// terminalStatuses are the statuses that a task never leaves
+var terminalStatuses = []string{
+	TaskStatusSucceeded,
+	TaskStatusFailed,
+	TaskStatusCanceled,
+	TaskStatusTimedOut,
+}
+
+var (
+	errInvalidStatus     = errors.New("invalid task status")
+	errInvalidTransition = errors.New("invalid status transition")
+)
+
+func isValidStatus(status string) bool {
+	_, ok := taskStatusStage[status]
+	return ok
+}
+
+func isTerminalStatus(status string) bool {
+	return taskStatusStage[status] == taskStatusStage[TaskStatusSucceeded]
+}
+
+func validateStatus(status string) error {
+	if !isValidStatus(status) {
+		return fmt.Errorf("%w: %q", errInvalidStatus, status)
+	}
+	return nil
+}
+
+// checkTransition verifies that a task in status "from" can be updated to status "to".
+// An empty "to" means the status is unchanged, which is only allowed for unfinished tasks.
+func checkTransition(from string, to string) error {
+	if isTerminalStatus(from) {
+		return fmt.Errorf("%w: task is already %s", errInvalidTransition, from)
+	}
+	if to == "" {
+		return nil
+	}
+	if err := validateStatus(to); err != nil {
+		return err
+	}
+	// Records created before the lifecycle was enforced may have an unknown status
+	if isValidStatus(from) && taskStatusStage[to] < taskStatusStage[from] {
+		return fmt.Errorf("%w: from %s to %s", errInvalidTransition, from, to)
+	}
+	return nil
+}
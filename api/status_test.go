@@ -0,0 +1,43 @@
+package api
+
+import (
+	"github.com/stretchr/testify/require"
+	"slices"
+	"testing"
+)
+
+func TestCheckTransition(t *testing.T) {
+	testCases := []struct {
+		from string
+		to   string
+		err  error
+	}{
+		{from: TaskStatusPending, to: TaskStatusQueued},
+		{from: TaskStatusPending, to: TaskStatusSucceeded},
+		{from: TaskStatusQueued, to: TaskStatusRunning},
+		{from: TaskStatusRunning, to: TaskStatusRunning},
+		{from: TaskStatusRunning, to: TaskStatusTimedOut},
+		{from: TaskStatusRunning, to: ""},
+		{from: "", to: TaskStatusRunning},
+		{from: TaskStatusRunning, to: TaskStatusPending, err: errInvalidTransition},
+		{from: TaskStatusSucceeded, to: TaskStatusPending, err: errInvalidTransition},
+		{from: TaskStatusFailed, to: TaskStatusFailed, err: errInvalidTransition},
+		{from: TaskStatusCanceled, to: "", err: errInvalidTransition},
+		{from: TaskStatusPending, to: "done", err: errInvalidStatus},
+	}
+
+	for _, tc := range testCases {
+		err := checkTransition(tc.from, tc.to)
+		if tc.err == nil {
+			require.NoError(t, err, "%s -> %s", tc.from, tc.to)
+		} else {
+			require.ErrorIs(t, err, tc.err, "%s -> %s", tc.from, tc.to)
+		}
+	}
+}
+
+func TestTerminalStatuses(t *testing.T) {
+	for status := range taskStatusStage {
+		require.Equal(t, isTerminalStatus(status), slices.Contains(terminalStatuses, status), status)
+	}
+}
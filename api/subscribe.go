@@ -0,0 +1,371 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/HyperGAI/serving-webhook/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	ActionSubscribe   = "subscribe"
+	ActionUnsubscribe = "unsubscribe"
+
+	subscriberBufferSize = 64
+	subscriberReadLimit  = 64 << 10 // 64 KiB
+	subscriberPingPeriod = 30 * time.Second
+	subscriberWriteWait  = 10 * time.Second
+)
+
+var errSubscriptionForbidden = errors.New("the subscription needs the admin API key")
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// The connection is authorized by the API key instead of the origin
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// SubscribeRequest is sent by a websocket client to change its subscriptions
+type SubscribeRequest struct {
+	Action     string   `json:"action"`
+	TaskIDs    []string `json:"task_ids"`
+	UserIDs    []string `json:"user_ids"`
+	ModelNames []string `json:"model_names"`
+}
+
+// TaskDiff is sent to a websocket client for every event of the subscribed tasks.
+// Changes holds all the fields for a snapshot or a new task, and only the changed
+// fields for an updated task.
+type TaskDiff struct {
+	Type    string                     `json:"type"`
+	ID      string                     `json:"id"`
+	Version int64                      `json:"version"`
+	Changes map[string]json.RawMessage `json:"changes,omitempty"`
+	Error   string                     `json:"error,omitempty"`
+}
+
+// taskFilter is the set of task ids, users and models that a client subscribes to
+type taskFilter struct {
+	taskIDs    map[string]bool
+	userIDs    map[string]bool
+	modelNames map[string]bool
+}
+
+func newTaskFilter() taskFilter {
+	return taskFilter{
+		taskIDs:    make(map[string]bool),
+		userIDs:    make(map[string]bool),
+		modelNames: make(map[string]bool),
+	}
+}
+
+func (filter *taskFilter) update(req *SubscribeRequest) {
+	set := func(items map[string]bool, keys []string) {
+		for _, key := range keys {
+			if req.Action == ActionUnsubscribe {
+				delete(items, key)
+			} else {
+				items[key] = true
+			}
+		}
+	}
+	set(filter.taskIDs, req.TaskIDs)
+	set(filter.userIDs, req.UserIDs)
+	set(filter.modelNames, req.ModelNames)
+}
+
+// authorizeSubscription checks that a caller without the admin API key only subscribes
+// to its own tasks, which are the ones created with the same UID header
+func authorizeSubscription(ctx *gin.Context, req *SubscribeRequest) error {
+	if req.Action != ActionSubscribe || isAdmin(ctx) {
+		return nil
+	}
+	uid := ctx.GetHeader("UID")
+	for _, userID := range req.UserIDs {
+		if userID != uid {
+			return fmt.Errorf("%w: cannot subscribe to the tasks of user %q", errSubscriptionForbidden, userID)
+		}
+	}
+	if len(req.ModelNames) > 0 {
+		return fmt.Errorf("%w: cannot subscribe to models", errSubscriptionForbidden)
+	}
+	return nil
+}
+
+func (filter *taskFilter) match(task *TaskV1) bool {
+	return filter.taskIDs[task.ID] ||
+		(task.UserID != "" && filter.userIDs[task.UserID]) ||
+		filter.modelNames[task.ModelName]
+}
+
+// taskSubscriber is a websocket or a server-sent events client registered in the hub.
+// A websocket client receives the diffs from send, and a server-sent events client
+// receives the whole events from events.
+type taskSubscriber struct {
+	mutex  sync.Mutex
+	filter taskFilter
+	send   chan TaskDiff
+	events chan TaskEvent
+	// done is closed when the hub drops a subscriber that doesn't keep up
+	done chan struct{}
+	once sync.Once
+}
+
+func (subscriber *taskSubscriber) stop() {
+	subscriber.once.Do(func() { close(subscriber.done) })
+}
+
+// deliver passes an event to the subscriber without blocking, and returns false if
+// the buffer of the subscriber is full
+func (subscriber *taskSubscriber) deliver(event *TaskEvent, diff TaskDiff) bool {
+	if subscriber.events != nil {
+		select {
+		case subscriber.events <- *event:
+			return true
+		default:
+			return false
+		}
+	}
+	select {
+	case subscriber.send <- diff:
+		return true
+	default:
+		return false
+	}
+}
+
+// taskHub shares one redis subscription of TaskEventsChannel among the websocket
+// and the server-sent events clients of this replica. It subscribes when the first client joins and
+// unsubscribes when the last one leaves.
+type taskHub struct {
+	cache        storage.Cache
+	mutex        sync.Mutex
+	subscribers  map[*taskSubscriber]struct{}
+	subscription storage.Subscription
+}
+
+func newTaskHub(cache storage.Cache) *taskHub {
+	return &taskHub{
+		cache:       cache,
+		subscribers: make(map[*taskSubscriber]struct{}),
+	}
+}
+
+func (hub *taskHub) register(subscriber *taskSubscriber) error {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	if hub.subscription == nil {
+		subscription, err := hub.cache.Subscribe(TaskEventsChannel)
+		if err != nil {
+			return err
+		}
+		hub.subscription = subscription
+		go hub.run(subscription)
+	}
+	hub.subscribers[subscriber] = struct{}{}
+	return nil
+}
+
+func (hub *taskHub) unregister(subscriber *taskSubscriber) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	delete(hub.subscribers, subscriber)
+	if len(hub.subscribers) == 0 && hub.subscription != nil {
+		if err := hub.subscription.Close(); err != nil {
+			log.Error().Msgf("failed to close the subscription of %s: %v", TaskEventsChannel, err)
+		}
+		hub.subscription = nil
+	}
+}
+
+// run forwards the events to the matching subscribers until the subscription is closed
+func (hub *taskHub) run(subscription storage.Subscription) {
+	for message := range subscription.Channel() {
+		var event TaskEvent
+		if err := json.Unmarshal([]byte(message), &event); err != nil {
+			log.Error().Msgf("failed to unmarshal a task event: %v", err)
+			continue
+		}
+		diff := TaskDiff{
+			Type:    event.Type,
+			ID:      event.Task.ID,
+			Version: event.Task.Version,
+			Changes: event.Changes,
+		}
+		hub.mutex.Lock()
+		if hub.subscription != subscription {
+			// The subscription has been replaced after the last client left
+			hub.mutex.Unlock()
+			continue
+		}
+		for subscriber := range hub.subscribers {
+			subscriber.mutex.Lock()
+			matched := subscriber.filter.match(&event.Task)
+			subscriber.mutex.Unlock()
+			if !matched {
+				continue
+			}
+			if !subscriber.deliver(&event, diff) {
+				// Drop the client instead of blocking the other subscribers
+				subscriber.stop()
+			}
+		}
+		hub.mutex.Unlock()
+	}
+}
+
+/*
+ws://localhost:12000/task/subscribe?task_id=<TASK_ID>&user_id=<USER_ID>&model_name=<MODEL_NAME>
+{"action": "subscribe", "task_ids": ["<TASK_ID>"], "user_ids": [], "model_names": []}
+*/
+
+// Subscribe upgrades the request to a websocket, which receives the diffs of the tasks
+// matching any of the subscribed task ids, user ids or model names. The initial
+// subscriptions can be set in the query, and changed by sending SubscribeRequest messages.
+// Without the admin API key, a client can only subscribe to its own user id.
+func (server *Server) Subscribe(ctx *gin.Context) {
+	initial := &SubscribeRequest{
+		Action:     ActionSubscribe,
+		TaskIDs:    ctx.QueryArray("task_id"),
+		UserIDs:    ctx.QueryArray("user_id"),
+		ModelNames: ctx.QueryArray("model_name"),
+	}
+	if err := authorizeSubscription(ctx, initial); err != nil {
+		ctx.JSON(http.StatusForbidden, errorResponse(err))
+		return
+	}
+	conn, err := upgrader.Upgrade(ctx.Writer, ctx.Request, nil)
+	if err != nil {
+		// The upgrader has written the error response
+		log.Error().Msgf("failed to upgrade to websocket: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	subscriber := &taskSubscriber{
+		filter: newTaskFilter(),
+		send:   make(chan TaskDiff, subscriberBufferSize),
+		done:   make(chan struct{}),
+	}
+	if err = server.hub.register(subscriber); err != nil {
+		log.Error().Msgf("failed to subscribe to task events: %v", err)
+		_ = conn.WriteJSON(TaskDiff{Type: "error", Error: err.Error()})
+		return
+	}
+	defer server.hub.unregister(subscriber)
+
+	readerDone := make(chan struct{})
+	go func() {
+		defer close(readerDone)
+		server.readSubscriptions(ctx, conn, subscriber, initial)
+	}()
+	// The reader uses the gin context, so wait for it before returning
+	defer func() {
+		subscriber.stop()
+		_ = conn.Close()
+		<-readerDone
+	}()
+
+	ticker := time.NewTicker(subscriberPingPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case diff := <-subscriber.send:
+			_ = conn.SetWriteDeadline(time.Now().Add(subscriberWriteWait))
+			if err := conn.WriteJSON(diff); err != nil {
+				return
+			}
+		case <-ticker.C:
+			deadline := time.Now().Add(subscriberWriteWait)
+			if err := conn.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+				return
+			}
+		case <-subscriber.done:
+			return
+		}
+	}
+}
+
+// readSubscriptions applies the initial subscriptions and the ones sent by the client,
+// and stops the subscriber when the connection is closed
+func (server *Server) readSubscriptions(
+	ctx *gin.Context,
+	conn *websocket.Conn,
+	subscriber *taskSubscriber,
+	initial *SubscribeRequest,
+) {
+	defer subscriber.stop()
+	server.applySubscription(ctx, subscriber, initial)
+
+	conn.SetReadLimit(subscriberReadLimit)
+	_ = conn.SetReadDeadline(time.Now().Add(2 * subscriberPingPeriod))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(2 * subscriberPingPeriod))
+	})
+	for {
+		var req SubscribeRequest
+		if err := conn.ReadJSON(&req); err != nil {
+			var syntaxError *json.SyntaxError
+			var typeError *json.UnmarshalTypeError
+			if !errors.As(err, &syntaxError) && !errors.As(err, &typeError) {
+				return
+			}
+			server.sendDiff(subscriber, TaskDiff{Type: "error", Error: err.Error()})
+			continue
+		}
+		if req.Action != ActionSubscribe && req.Action != ActionUnsubscribe {
+			server.sendDiff(subscriber, TaskDiff{Type: "error", Error: "unknown action: " + req.Action})
+			continue
+		}
+		server.applySubscription(ctx, subscriber, &req)
+	}
+}
+
+// applySubscription updates the filter of the subscriber, and sends the snapshots
+// of the newly subscribed task ids. A request that the caller isn't authorized for
+// is rejected as a whole.
+func (server *Server) applySubscription(ctx *gin.Context, subscriber *taskSubscriber, req *SubscribeRequest) {
+	if err := authorizeSubscription(ctx, req); err != nil {
+		server.sendDiff(subscriber, TaskDiff{Type: "error", Error: err.Error()})
+		return
+	}
+	subscriber.mutex.Lock()
+	subscriber.filter.update(req)
+	subscriber.mutex.Unlock()
+	if req.Action != ActionSubscribe {
+		return
+	}
+	for _, id := range req.TaskIDs {
+		task, err := server.getTask(ctx, id)
+		if err != nil {
+			server.sendDiff(subscriber, TaskDiff{Type: "error", ID: id, Error: err.Error()})
+			continue
+		}
+		snapshot := newTaskV1(task)
+		changes, err := diffTask(nil, &snapshot)
+		if err != nil {
+			server.sendDiff(subscriber, TaskDiff{Type: "error", ID: id, Error: err.Error()})
+			continue
+		}
+		server.sendDiff(subscriber, TaskDiff{
+			Type:    TaskEventSnapshot,
+			ID:      task.ID,
+			Version: task.Version,
+			Changes: changes,
+		})
+	}
+}
+
+func (server *Server) sendDiff(subscriber *taskSubscriber, diff TaskDiff) {
+	select {
+	case subscriber.send <- diff:
+	case <-subscriber.done:
+	}
+}
@@ -0,0 +1,182 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/HyperGAI/serving-webhook/storage"
+	"github.com/HyperGAI/serving-webhook/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSubscribe(t *testing.T) {
+	server := newTestServer(t, nil, storage.NewMemoryCache(), nil)
+	httpServer := httptest.NewServer(server.router)
+	defer httpServer.Close()
+
+	sendRequest := func(method string, uid string, body gin.H) {
+		data, err := json.Marshal(body)
+		require.NoError(t, err)
+		request, err := http.NewRequest(method, httpServer.URL+"/task", bytes.NewReader(data))
+		require.NoError(t, err)
+		request.Header.Set("UID", uid)
+		response, err := http.DefaultClient.Do(request)
+		require.NoError(t, err)
+		defer response.Body.Close()
+		require.Equal(t, http.StatusOK, response.StatusCode)
+	}
+	sendRequest(http.MethodPost, "bob", gin.H{"id": "1", "model_name": "model_a"})
+
+	url := "ws" + strings.TrimPrefix(httpServer.URL, "http") + "/task/subscribe?task_id=1&task_id=404&model_name=model_b"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	readDiff := func() TaskDiff {
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		var diff TaskDiff
+		require.NoError(t, conn.ReadJSON(&diff))
+		return diff
+	}
+
+	diff := readDiff()
+	require.Equal(t, TaskEventSnapshot, diff.Type)
+	require.Equal(t, "1", diff.ID)
+	require.Equal(t, int64(1), diff.Version)
+	require.JSONEq(t, `"model_a"`, string(diff.Changes["model_name"]))
+	require.JSONEq(t, `"bob"`, string(diff.Changes["user_id"]))
+	require.JSONEq(t, `"v1"`, string(diff.Changes["api_version"]))
+
+	diff = readDiff()
+	require.Equal(t, "error", diff.Type)
+	require.Equal(t, "404", diff.ID)
+
+	// Tasks of other models are not sent
+	sendRequest(http.MethodPost, "bob", gin.H{"id": "2", "model_name": "model_c"})
+	sendRequest(http.MethodPost, "bob", gin.H{"id": "3", "model_name": "model_b"})
+	diff = readDiff()
+	require.Equal(t, TaskEventCreated, diff.Type)
+	require.Equal(t, "3", diff.ID)
+	require.JSONEq(t, `"pending"`, string(diff.Changes["status"]))
+	require.JSONEq(t, `"v1"`, string(diff.Changes["api_version"]))
+
+	// Only the changed fields are sent for an update
+	sendRequest(http.MethodPut, "bob", gin.H{"id": "1", "status": TaskStatusRunning})
+	diff = readDiff()
+	require.Equal(t, TaskEventUpdated, diff.Type)
+	require.Equal(t, "1", diff.ID)
+	require.Equal(t, int64(2), diff.Version)
+	require.Len(t, diff.Changes, 3)
+	require.JSONEq(t, `"running"`, string(diff.Changes["status"]))
+	require.JSONEq(t, `2`, string(diff.Changes["version"]))
+	require.Contains(t, diff.Changes, "updated_at")
+
+	// Subscribe to a user and unsubscribe from a model, the snapshot of
+	// task 1 confirms that the subscriptions are applied
+	require.NoError(t, conn.WriteJSON(SubscribeRequest{Action: ActionSubscribe, TaskIDs: []string{"1"}, UserIDs: []string{"alice"}}))
+	require.Equal(t, TaskEventSnapshot, readDiff().Type)
+	require.NoError(t, conn.WriteJSON(SubscribeRequest{Action: ActionUnsubscribe, ModelNames: []string{"model_b"}}))
+	require.NoError(t, conn.WriteJSON(SubscribeRequest{Action: ActionSubscribe, TaskIDs: []string{"1"}}))
+	require.Equal(t, TaskEventSnapshot, readDiff().Type)
+
+	sendRequest(http.MethodPut, "bob", gin.H{"id": "3", "status": TaskStatusRunning})
+	sendRequest(http.MethodPost, "alice", gin.H{"id": "4", "model_name": "model_c"})
+	diff = readDiff()
+	require.Equal(t, TaskEventCreated, diff.Type)
+	require.Equal(t, "4", diff.ID)
+
+	require.NoError(t, conn.WriteJSON(gin.H{"action": "unknown"}))
+	diff = readDiff()
+	require.Equal(t, "error", diff.Type)
+	require.Contains(t, diff.Error, "unknown action")
+
+	// The hub unsubscribes from redis after the last client leaves
+	require.NoError(t, conn.Close())
+	require.Eventually(t, func() bool {
+		server.hub.mutex.Lock()
+		defer server.hub.mutex.Unlock()
+		return server.hub.subscription == nil
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestSubscribeAuthorization(t *testing.T) {
+	config := utils.Config{SecretAPIKey: "123456", AdminAPIKey: "654321"}
+	server, err := NewServer(config, nil, storage.NewMemoryCache(), nil)
+	require.NoError(t, err)
+	httpServer := httptest.NewServer(server.router)
+	defer httpServer.Close()
+	baseURL := "ws" + strings.TrimPrefix(httpServer.URL, "http") + "/task/subscribe"
+
+	dial := func(query string, apiKey string, uid string) (*websocket.Conn, *http.Response, error) {
+		header := http.Header{}
+		header.Set(authorizationHeaderKey, apiKey)
+		header.Set("UID", uid)
+		return websocket.DefaultDialer.Dial(baseURL+query, header)
+	}
+
+	testCases := []struct {
+		name   string
+		query  string
+		apiKey string
+		status int
+	}{
+		{name: "Own user", query: "?user_id=bob", apiKey: "123456", status: http.StatusSwitchingProtocols},
+		{name: "Other user", query: "?user_id=alice", apiKey: "123456", status: http.StatusForbidden},
+		{name: "Model", query: "?model_name=model_a", apiKey: "123456", status: http.StatusForbidden},
+		{name: "Admin other user", query: "?user_id=alice", apiKey: "654321", status: http.StatusSwitchingProtocols},
+		{name: "Admin model", query: "?model_name=model_a", apiKey: "654321", status: http.StatusSwitchingProtocols},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			conn, response, err := dial(tc.query, tc.apiKey, "bob")
+			require.NotNil(t, response)
+			require.Equal(t, tc.status, response.StatusCode)
+			if err == nil {
+				require.NoError(t, conn.Close())
+			}
+		})
+	}
+
+	// The subscriptions sent later are authorized as well
+	conn, _, err := dial("", "123456", "bob")
+	require.NoError(t, err)
+	defer conn.Close()
+	readDiff := func() TaskDiff {
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		var diff TaskDiff
+		require.NoError(t, conn.ReadJSON(&diff))
+		return diff
+	}
+	require.NoError(t, conn.WriteJSON(SubscribeRequest{Action: ActionSubscribe, UserIDs: []string{"bob", "alice"}}))
+	diff := readDiff()
+	require.Equal(t, "error", diff.Type)
+	require.Contains(t, diff.Error, "alice")
+	require.NoError(t, conn.WriteJSON(SubscribeRequest{Action: ActionSubscribe, ModelNames: []string{"model_a"}}))
+	diff = readDiff()
+	require.Equal(t, "error", diff.Type)
+	require.Contains(t, diff.Error, "models")
+	// Unsubscribing doesn't need the admin API key
+	require.NoError(t, conn.WriteJSON(SubscribeRequest{Action: ActionUnsubscribe, UserIDs: []string{"alice"}}))
+	require.NoError(t, conn.WriteJSON(SubscribeRequest{Action: ActionSubscribe, UserIDs: []string{"bob"}}))
+	require.Eventually(t, func() bool {
+		server.hub.mutex.Lock()
+		defer server.hub.mutex.Unlock()
+		for subscriber := range server.hub.subscribers {
+			subscriber.mutex.Lock()
+			userIDs := subscriber.filter.userIDs
+			subscribed := len(userIDs) == 1 && userIDs["bob"]
+			subscriber.mutex.Unlock()
+			if subscribed {
+				return true
+			}
+		}
+		return false
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -1,9 +1,12 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	db "github.com/HyperGAI/serving-webhook/db/sqlc"
+	"github.com/HyperGAI/serving-webhook/storage"
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/rs/zerolog/log"
@@ -15,15 +18,22 @@ import (
 
 type TaskInfo struct {
 	ID           string      `json:"id"`
+	UserID       string      `json:"user_id"`
 	ModelName    string      `json:"model_name"`
 	ModelVersion string      `json:"model_version"`
 	Status       string      `json:"status"`
 	RunningTime  string      `json:"running_time"`
 	CreatedAt    time.Time   `json:"created_at"`
+	UpdatedAt    time.Time   `json:"updated_at"`
 	Outputs      interface{} `json:"outputs"`
 	ErrorInfo    string      `json:"error_info"`
 	QueueNum     int         `json:"queue_num"`
 	QueueID      string      `json:"queue_id"`
+	Version      int64       `json:"version"`
+	CanceledBy   string      `json:"canceled_by"`
+	// WebhookURL is notified when the task moves into one of the WebhookEvents
+	WebhookURL    string   `json:"webhook_url,omitempty"`
+	WebhookEvents []string `json:"webhook_events,omitempty"`
 }
 
 type CreateRequest struct {
@@ -32,27 +42,59 @@ type CreateRequest struct {
 	ModelVersion string `json:"model_version"`
 	QueueNum     int    `json:"queue_num"`
 	Status       string `json:"status"`
+	// WebhookEvents defaults to the terminal statuses
+	WebhookURL    string   `json:"webhook_url"`
+	WebhookEvents []string `json:"webhook_events"`
 }
 
 type UpdateRequest struct {
-	ID           string      `json:"id" binding:"required"`
-	Status       string      `json:"status"`
-	RunningTime  string      `json:"running_time"`
-	Outputs      interface{} `json:"outputs"`
-	ErrorInfo    string      `json:"error_info"`
-	QueueID      string      `json:"queue_id"`
-	DatabaseOnly bool        `json:"database_only"`
+	ID          string      `json:"id" binding:"required"`
+	Status      string      `json:"status"`
+	RunningTime string      `json:"running_time"`
+	Outputs     interface{} `json:"outputs"`
+	ErrorInfo   string      `json:"error_info"`
+	QueueID     string      `json:"queue_id"`
+	// DatabaseOnly is kept for compatibility, since every update is written to
+	// the database first if there is one, and then to redis by the outbox
+	DatabaseOnly bool `json:"database_only"`
+	// CanceledBy is only set by the cancel API
+	CanceledBy string `json:"-"`
 }
 
 type URI struct {
 	ID string `json:"id" uri:"id"`
 }
 
+// GetTaskFromDBRequest is read from the query string, or the JSON body for compatibility
 type GetTaskFromDBRequest struct {
-	ModelName string `json:"model_name" binding:"required"`
-	Status    string `json:"status" binding:"required"`
+	ModelName string `json:"model_name" form:"model_name"`
+	Status    string `json:"status" form:"status"`
+	Limit     int32  `json:"limit" form:"limit" binding:"omitempty,min=1,max=500"`
+	Cursor    string `json:"cursor" form:"cursor"`
+}
+
+// ETag returns the version of the task info as a strong entity tag
+func (task *TaskInfo) ETag() string {
+	return fmt.Sprintf("%q", strconv.FormatInt(task.Version, 10))
+}
+
+// matchETag checks an If-Match header, which may contain "*" or a list of entity tags.
+// If-Match uses the strong comparison, so weak entity tags never match.
+func matchETag(header string, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
 }
 
+var errVersionMismatch = errors.New("task version mismatch")
+
+// maxRecordRetries bounds the attempts of updateRecord when the record is updated concurrently
+const maxRecordRetries = 10
+
 func (server *Server) KeyDuration() time.Duration {
 	duration, _ := time.ParseDuration(server.config.RedisKeyDuration)
 	return duration
@@ -64,55 +106,129 @@ func (server *Server) Create(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, errorResponse(err))
 		return
 	}
-	status := "pending"
+	key := idempotencyKey(ctx)
+	if server.replayResponse(ctx, key, req) {
+		return
+	}
+	status := TaskStatusPending
 	if req.Status != "" {
+		if hasError(ctx, validateStatus(req.Status)) {
+			return
+		}
 		status = req.Status
 	}
+	if hasError(ctx, validateWebhook(req.WebhookURL, req.WebhookEvents)) {
+		return
+	}
+	userID := ctx.Request.Header.Get("UID")
+	now := time.Now()
 	task := &TaskInfo{
-		ID:           req.ID,
-		ModelName:    req.ModelName,
-		ModelVersion: req.ModelVersion,
-		Status:       status,
-		RunningTime:  "",
-		CreatedAt:    time.Now(),
-		Outputs:      nil,
-		ErrorInfo:    "",
-		QueueNum:     req.QueueNum,
-		QueueID:      "",
-	}
-	duration := server.KeyDuration()
+		ID:            req.ID,
+		UserID:        userID,
+		ModelName:     req.ModelName,
+		ModelVersion:  req.ModelVersion,
+		Status:        status,
+		RunningTime:   "",
+		CreatedAt:     now,
+		UpdatedAt:     now,
+		Outputs:       nil,
+		ErrorInfo:     "",
+		QueueNum:      req.QueueNum,
+		QueueID:       "",
+		Version:       1,
+		WebhookURL:    req.WebhookURL,
+		WebhookEvents: req.WebhookEvents,
+	}
+	var err error
 	if server.database != nil {
-		// Create a task record in both database and redis
-		userID := ctx.Request.Header.Get("UID")
-		err := server.database.ExecTx(ctx, func(q *db.Queries) error {
+		// Create the task record and its outbox entry in one transaction,
+		// the relay applies the entry to redis and publishes its events
+		err = server.database.ExecTx(ctx, func(q *db.Queries) error {
 			_, e := q.CreateTask(ctx, db.CreateTaskParams{
-				TaskID:      task.ID,
-				UserID:      pgtype.Text{String: userID, Valid: true},
-				ModelName:   task.ModelName,
-				RunningTime: pgtype.Float8{Float64: 0, Valid: true},
-				Status:      pgtype.Text{String: task.Status, Valid: true},
+				TaskID:        task.ID,
+				UserID:        pgtype.Text{String: userID, Valid: true},
+				ModelName:     task.ModelName,
+				ModelVersion:  pgtype.Text{String: task.ModelVersion, Valid: task.ModelVersion != ""},
+				RunningTime:   pgtype.Float8{Float64: 0, Valid: true},
+				Status:        pgtype.Text{String: task.Status, Valid: true},
+				QueueNum:      pgtype.Int4{Int32: int32(task.QueueNum), Valid: true},
+				WebhookUrl:    pgtype.Text{String: task.WebhookURL, Valid: task.WebhookURL != ""},
+				WebhookEvents: task.WebhookEvents,
 			})
 			if e != nil {
+				if db.ErrorCode(e) == db.UniqueViolation {
+					return errTaskExists
+				}
 				return e
 			}
-			if e := server.cache.SetKey(task.ID, task, duration); e != nil {
-				return e
-			}
-			return nil
+			return server.writeOutbox(ctx, q, TaskEventCreated, nil, task)
 		})
-		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, errorResponse(err))
-			return
-		}
 	} else {
 		// Create a task record in redis
-		err := server.cache.SetKey(task.ID, task, duration)
-		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, errorResponse(err))
-			return
+		created, e := server.cache.SetKeyNX(task.ID, task, server.KeyDuration())
+		if e == nil && !created {
+			e = errTaskExists
 		}
+		err = e
+	}
+	created := err == nil
+	if errors.Is(err, errTaskExists) {
+		err = server.checkDuplicate(ctx, task)
+	}
+	if hasError(ctx, err) {
+		return
+	}
+	if created && server.database != nil {
+		server.applyCommitted(task)
+	} else if created {
+		server.trackTask(task)
+		server.publishTaskEvent(TaskEventCreated, nil, task)
+		server.notifyWebhook("", task)
+	}
+	res := gin.H{"id": task.ID}
+	server.saveResponse(key, req, http.StatusOK, res)
+	ctx.JSON(http.StatusOK, res)
+}
+
+// checkDuplicate returns nil if the existing task is created by the same user with the
+// same payload, i.e., the request is a retry, otherwise it returns errTaskExists. The
+// initial status is only compared until the task is updated, since it is not kept.
+func (server *Server) checkDuplicate(ctx *gin.Context, task *TaskInfo) error {
+	existing, err := server.getTask(ctx, task.ID)
+	if err != nil {
+		if errors.Is(err, errTaskNotFound) {
+			return fmt.Errorf("%w: %s", errTaskExists, task.ID)
+		}
+		return err
+	}
+	if existing.UserID != task.UserID ||
+		existing.ModelName != task.ModelName ||
+		existing.ModelVersion != task.ModelVersion ||
+		existing.QueueNum != task.QueueNum ||
+		(existing.Version == 1 && existing.Status != task.Status) ||
+		existing.WebhookURL != task.WebhookURL ||
+		!sameStrings(existing.WebhookEvents, task.WebhookEvents) {
+		return fmt.Errorf("%w: %s", errTaskExists, task.ID)
 	}
-	ctx.JSON(http.StatusOK, gin.H{"id": task.ID})
+	return nil
+}
+
+// sameStrings checks if two lists have the same strings regardless of their order
+func sameStrings(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	counts := make(map[string]int, len(a))
+	for _, s := range a {
+		counts[s]++
+	}
+	for _, s := range b {
+		if counts[s] == 0 {
+			return false
+		}
+		counts[s]--
+	}
+	return true
 }
 
 func (server *Server) Get(ctx *gin.Context) {
@@ -121,19 +237,12 @@ func (server *Server) Get(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, errorResponse(err))
 		return
 	}
-	value, err := server.cache.GetKey(id.ID)
-	if err != nil {
-		ctx.JSON(http.StatusBadRequest, errorResponse(err))
-		return
-	}
-
-	var task TaskInfo
-	err = json.Unmarshal([]byte(value), &task)
-	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+	task, err := server.getTask(ctx, id.ID)
+	if hasError(ctx, err) {
 		return
 	}
-	ctx.JSON(http.StatusOK, task)
+	ctx.Header("ETag", task.ETag())
+	ctx.JSON(http.StatusOK, newTaskV1(task))
 }
 
 func (server *Server) Update(ctx *gin.Context) {
@@ -142,23 +251,64 @@ func (server *Server) Update(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, errorResponse(err))
 		return
 	}
+	if req.Status != "" && hasError(ctx, validateStatus(req.Status)) {
+		return
+	}
 
-	var task TaskInfo
-	if !req.DatabaseOnly {
-		value, err := server.cache.GetKey(req.ID)
+	task, err := server.updateTask(ctx, &req, ctx.GetHeader("If-Match"))
+	if hasError(ctx, err) {
+		return
+	}
+	ctx.Header("ETag", task.ETag())
+	ctx.JSON(http.StatusOK, newTaskV1(task))
+}
+
+// updateTask applies the update request to the task record in the database if there is one,
+// or to the task info in redis otherwise. If ifMatch is not empty, it must match the current
+// version of the task.
+func (server *Server) updateTask(ctx context.Context, req *UpdateRequest, ifMatch string) (*TaskInfo, error) {
+	if server.database != nil {
+		task, err := server.updateRecord(ctx, req, ifMatch)
 		if err != nil {
-			ctx.JSON(http.StatusBadRequest, errorResponse(err))
-			return
+			return nil, err
 		}
-		err = json.Unmarshal([]byte(value), &task)
-		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, errorResponse(err))
-			return
+		server.applyCommitted(task)
+		return task, nil
+	}
+
+	// Read, modify and write the task info atomically in redis
+	var previous, task TaskInfo
+	err := server.cache.UpdateKey(req.ID, func(value string) (interface{}, error) {
+		task = TaskInfo{}
+		if err := json.Unmarshal([]byte(value), &task); err != nil {
+			return nil, err
 		}
-	} else {
-		task.ID = req.ID
+		if ifMatch != "" && !matchETag(ifMatch, task.ETag()) {
+			return nil, fmt.Errorf("%w: the current version is %s", errVersionMismatch, task.ETag())
+		}
+		if err := checkTransition(task.Status, req.Status); err != nil {
+			return nil, err
+		}
+		previous = task
+		applyUpdate(&task, req)
+		task.Version += 1
+		task.UpdatedAt = time.Now()
+		return task, nil
+	}, server.KeyDuration())
+	if errors.Is(err, storage.ErrKeyNotFound) {
+		err = fmt.Errorf("%w: %s", errTaskNotFound, req.ID)
+	}
+	if err != nil {
+		return nil, err
 	}
+	server.trackTask(&task)
+	server.publishTaskEvent(TaskEventUpdated, &previous, &task)
+	server.notifyWebhook(previous.Status, &task)
+	return &task, nil
+}
 
+// applyUpdate merges the fields set in the update request into the task info
+func applyUpdate(task *TaskInfo, req *UpdateRequest) {
 	if req.Status != "" {
 		task.Status = req.Status
 	}
@@ -174,77 +324,252 @@ func (server *Server) Update(ctx *gin.Context) {
 	if req.QueueID != "" {
 		task.QueueID = req.QueueID
 	}
-	duration := server.KeyDuration()
+	if req.CanceledBy != "" {
+		task.CanceledBy = req.CanceledBy
+	}
+}
 
-	if server.database != nil {
-		// Update the task record in both database and redis
-		var runningTime float64 = 0
-		if req.RunningTime != "" {
-			f := strings.Replace(req.RunningTime, "s", "", -1)
-			if s, err := strconv.ParseFloat(f, 64); err == nil {
-				runningTime = s
-			} else {
-				log.Error().Msgf("cannot convert %s to float64", f)
+// errRecordChanged is returned in the transaction of updateRecord if the task record
+// has been updated since it was read
+var errRecordChanged = errors.New("task record changed")
+
+// updateRecord applies the update request to the task record, and writes the change to
+// the outbox in the same transaction. The record is only updated if its version hasn't
+// changed since it was read, otherwise it is read and checked again.
+func (server *Server) updateRecord(ctx context.Context, req *UpdateRequest, ifMatch string) (*TaskInfo, error) {
+	var runningTime float64 = 0
+	if req.RunningTime != "" {
+		if s, err := parseRunningTime(req.RunningTime); err == nil {
+			runningTime = s
+		} else {
+			log.Error().Msgf("cannot convert %s to float64", req.RunningTime)
+		}
+	}
+	var outputs []byte = nil
+	if req.Outputs != nil {
+		data, err := json.Marshal(req.Outputs)
+		if err != nil {
+			return nil, err
+		}
+		outputs = data
+	}
+
+	for i := 0; i < maxRecordRetries; i++ {
+		record, err := server.database.GetTaskById(ctx, req.ID)
+		if err != nil {
+			if errors.Is(err, db.ErrRecordNotFound) {
+				return nil, fmt.Errorf("%w: %s", errTaskNotFound, req.ID)
 			}
+			return nil, err
+		}
+		task := taskInfoFromRecord(record)
+		task.Version = server.currentVersion(&task)
+		if ifMatch != "" && !matchETag(ifMatch, task.ETag()) {
+			return nil, fmt.Errorf("%w: the current version is %s", errVersionMismatch, task.ETag())
+		}
+		if err = checkTransition(task.Status, req.Status); err != nil {
+			return nil, err
 		}
-		err := server.database.ExecTx(ctx, func(q *db.Queries) error {
+		previous := task
+		applyUpdate(&task, req)
+		task.Version += 1
+		task.UpdatedAt = time.Now()
+
+		err = server.database.ExecTx(ctx, func(q *db.Queries) error {
 			_, e := q.UpdateTask(ctx, db.UpdateTaskParams{
-				RunningTime: pgtype.Float8{Float64: runningTime, Valid: req.RunningTime != ""},
-				Status:      pgtype.Text{String: task.Status, Valid: req.Status != ""},
-				UpdatedAt:   pgtype.Timestamptz{Time: time.Now(), Valid: true},
-				TaskID:      task.ID,
+				RunningTime:     pgtype.Float8{Float64: runningTime, Valid: req.RunningTime != ""},
+				Status:          pgtype.Text{String: req.Status, Valid: req.Status != ""},
+				Outputs:         outputs,
+				ErrorInfo:       pgtype.Text{String: req.ErrorInfo, Valid: req.ErrorInfo != ""},
+				QueueID:         pgtype.Text{String: req.QueueID, Valid: req.QueueID != ""},
+				CanceledBy:      pgtype.Text{String: req.CanceledBy, Valid: req.CanceledBy != ""},
+				UpdatedAt:       pgtype.Timestamptz{Time: task.UpdatedAt, Valid: true},
+				Version:         pgtype.Int8{Int64: task.Version, Valid: true},
+				TaskID:          req.ID,
+				ExpectedVersion: pgtype.Int8{Int64: record.Version, Valid: true},
 			})
+			if errors.Is(e, db.ErrRecordNotFound) {
+				return errRecordChanged
+			}
 			if e != nil {
 				return e
 			}
-			if !req.DatabaseOnly {
-				if e := server.cache.SetKey(task.ID, task, duration); e != nil {
-					return e
-				}
+			if e = server.writeOutbox(ctx, q, TaskEventUpdated, &previous, &task); e != nil {
+				return e
 			}
-			return nil
+			return server.recordUsage(ctx, q, &previous, &task)
 		})
-		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, errorResponse(err))
-			return
+		if errors.Is(err, errRecordChanged) {
+			continue
 		}
-	} else {
-		// Update the task record in redis
-		err := server.cache.SetKey(task.ID, task, duration)
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, errorResponse(err))
-			return
+			return nil, err
 		}
+		return &task, nil
 	}
-	ctx.JSON(http.StatusOK, task)
+	return nil, storage.ErrUpdateConflict
 }
 
+/*
+curl "http://localhost:12000/task/modelstatus?model_name=<MODEL_NAME>&status=pending&limit=100"
+*/
+
+// GetTaskByModelStatus returns a page of the tasks of a model in a status, which is
+// a shortcut of ListTasks. Without a database, the page is always empty.
 func (server *Server) GetTaskByModelStatus(ctx *gin.Context) {
-	if server.database != nil {
-		var req GetTaskFromDBRequest
+	var req GetTaskFromDBRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	if req.ModelName == "" && req.Status == "" && ctx.Request.ContentLength > 0 {
+		// Older clients send the parameters in the body of the GET request
 		if err := ctx.ShouldBindJSON(&req); err != nil {
 			ctx.JSON(http.StatusBadRequest, errorResponse(err))
 			return
 		}
-		tasks, err := server.database.GetTasksByModelNameAndStatus(ctx, db.GetTasksByModelNameAndStatusParams{
-			ModelName: req.ModelName,
-			Status:    pgtype.Text{String: req.Status, Valid: true},
-		})
-		if hasError(ctx, err) {
-			log.Error().Msgf("failed to find records with model=%s and status=%s", req.ModelName, req.Status)
-			return
+	}
+	if req.ModelName == "" || req.Status == "" {
+		hasError(ctx, fmt.Errorf("%w: model_name and status are required", errInvalidQuery))
+		return
+	}
+	if hasError(ctx, validateStatus(req.Status)) {
+		return
+	}
+	if server.database == nil {
+		ctx.JSON(http.StatusOK, ListTasksResponse{Tasks: make([]TaskV1, 0)})
+		return
+	}
+	res, err := server.queryTasks(ctx, &ListTasksRequest{
+		ModelName: req.ModelName,
+		Statuses:  []string{req.Status},
+		Limit:     req.Limit,
+		Cursor:    req.Cursor,
+	})
+	if hasError(ctx, err) {
+		return
+	}
+	ctx.JSON(http.StatusOK, res)
+}
+
+// getTask reads the task info from redis. If the key has expired,
+// it falls back to the task record in the database, and writes the record
+// back to redis if REDIS_REPOPULATE is enabled.
+func (server *Server) getTask(ctx *gin.Context, id string) (*TaskInfo, error) {
+	value, err := server.cache.GetKey(id)
+	if err != nil {
+		if !errors.Is(err, storage.ErrKeyNotFound) {
+			return nil, err
 		}
-		ctx.JSON(http.StatusOK, tasks)
-	} else {
-		tasks := make([]db.Task, 0)
-		ctx.JSON(http.StatusOK, tasks)
+		if server.database == nil {
+			return nil, fmt.Errorf("%w: %s", errTaskNotFound, id)
+		}
+		task, e := server.getTaskFromDB(ctx, id)
+		if e != nil {
+			return nil, e
+		}
+		if server.config.RedisRepopulate {
+			if e := server.cache.SetKey(task.ID, task, server.KeyDuration()); e != nil {
+				log.Error().Msgf("failed to repopulate task %s: %v", task.ID, e)
+			}
+		}
+		return task, nil
+	}
+
+	var task TaskInfo
+	if err = json.Unmarshal([]byte(value), &task); err != nil {
+		return nil, err
 	}
+	return &task, nil
 }
 
-func hasError(ctx *gin.Context, err error) bool {
+func (server *Server) getTaskFromDB(ctx *gin.Context, id string) (*TaskInfo, error) {
+	record, err := server.database.GetTaskById(ctx, id)
 	if err != nil {
 		if errors.Is(err, db.ErrRecordNotFound) {
-			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return nil, fmt.Errorf("%w: %s", errTaskNotFound, id)
+		}
+		return nil, err
+	}
+	task := taskInfoFromRecord(record)
+	return &task, nil
+}
+
+func taskInfoFromRecord(record db.Task) TaskInfo {
+	task := TaskInfo{
+		ID:            record.TaskID,
+		UserID:        record.UserID.String,
+		ModelName:     record.ModelName,
+		ModelVersion:  record.ModelVersion.String,
+		Status:        record.Status.String,
+		CreatedAt:     record.CreatedAt,
+		UpdatedAt:     record.UpdatedAt,
+		ErrorInfo:     record.ErrorInfo.String,
+		QueueNum:      int(record.QueueNum.Int32),
+		QueueID:       record.QueueID.String,
+		CanceledBy:    record.CanceledBy.String,
+		WebhookURL:    record.WebhookUrl.String,
+		WebhookEvents: record.WebhookEvents,
+		Version:       record.Version,
+	}
+	if record.RunningTime.Valid {
+		task.RunningTime = strconv.FormatFloat(record.RunningTime.Float64, 'f', -1, 64) + "s"
+	}
+	if record.Outputs != nil {
+		if err := json.Unmarshal(record.Outputs, &task.Outputs); err != nil {
+			log.Error().Msgf("cannot unmarshal the outputs of task %s: %v", record.TaskID, err)
+		}
+	}
+	return task
+}
+
+var (
+	errTaskNotFound = errors.New("task not found")
+	errTaskExists   = errors.New("task already exists with a different payload")
+)
+
+func hasError(ctx *gin.Context, err error) bool {
+	if err != nil {
+		if errors.Is(err, db.ErrRecordNotFound) || errors.Is(err, errTaskNotFound) ||
+			errors.Is(err, errDeliveryNotFound) {
+			ctx.JSON(http.StatusNotFound, errorCodeResponse("not_found", err))
+			return true
+		}
+		if errors.Is(err, errTaskExists) {
+			ctx.JSON(http.StatusConflict, errorCodeResponse("task_exists", err))
+			return true
+		}
+		if errors.Is(err, errInvalidStatus) {
+			ctx.JSON(http.StatusBadRequest, errorCodeResponse("invalid_status", err))
+			return true
+		}
+		if errors.Is(err, errInvalidQuery) {
+			ctx.JSON(http.StatusBadRequest, errorCodeResponse("invalid_query", err))
+			return true
+		}
+		if errors.Is(err, errInvalidWebhook) {
+			ctx.JSON(http.StatusBadRequest, errorCodeResponse("invalid_webhook", err))
+			return true
+		}
+		if errors.Is(err, errInvalidCloudEvent) {
+			ctx.JSON(http.StatusBadRequest, errorCodeResponse("invalid_cloud_event", err))
+			return true
+		}
+		if errors.Is(err, errInvalidTransition) {
+			ctx.JSON(http.StatusConflict, errorCodeResponse("invalid_transition", err))
+			return true
+		}
+		if errors.Is(err, errVersionMismatch) {
+			ctx.JSON(http.StatusPreconditionFailed, errorCodeResponse("version_mismatch", err))
+			return true
+		}
+		if errors.Is(err, storage.ErrUpdateConflict) {
+			ctx.JSON(http.StatusConflict, errorCodeResponse("update_conflict", err))
+			return true
+		}
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			ctx.JSON(http.StatusRequestEntityTooLarge, errorCodeResponse("body_too_large", err))
 			return true
 		}
 		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	mockdb "github.com/HyperGAI/serving-webhook/db/mock"
 	db "github.com/HyperGAI/serving-webhook/db/sqlc"
+	"github.com/HyperGAI/serving-webhook/storage"
 	mockstore "github.com/HyperGAI/serving-webhook/storage/mock"
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v5/pgtype"
@@ -15,6 +16,7 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"sync"
 	"testing"
 	"time"
 )
@@ -35,7 +37,11 @@ func TestCreate(t *testing.T) {
 			},
 			buildStubs: func(cache *mockstore.MockCache) {
 				cache.EXPECT().
-					SetKey(gomock.Eq("12345"), gomock.Any(), gomock.Any()).
+					SetKeyNX(gomock.Eq("12345"), gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(true, nil)
+				cache.EXPECT().
+					Publish(gomock.Eq(TaskEventsChannel), gomock.Any()).
 					Times(1).
 					Return(nil)
 			},
@@ -53,9 +59,9 @@ func TestCreate(t *testing.T) {
 			},
 			buildStubs: func(cache *mockstore.MockCache) {
 				cache.EXPECT().
-					SetKey(gomock.Eq("12345"), gomock.Any(), gomock.Any()).
+					SetKeyNX(gomock.Eq("12345"), gomock.Any(), gomock.Any()).
 					Times(1).
-					Return(nil)
+					Return(true, nil)
 			},
 			checkResponse: func(recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusOK, recorder.Code)
@@ -70,14 +76,61 @@ func TestCreate(t *testing.T) {
 			},
 			buildStubs: func(cache *mockstore.MockCache) {
 				cache.EXPECT().
-					SetKey(gomock.Eq("12345"), gomock.Any(), gomock.Any()).
+					SetKeyNX(gomock.Eq("12345"), gomock.Any(), gomock.Any()).
 					Times(1).
-					Return(errors.New("redis error"))
+					Return(false, errors.New("redis error"))
 			},
 			checkResponse: func(recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusInternalServerError, recorder.Code)
 			},
 		},
+		{
+			name: "Duplicate with the same payload",
+			body: gin.H{
+				"id":            "12345",
+				"model_name":    "test_model",
+				"model_version": "v1",
+			},
+			buildStubs: func(cache *mockstore.MockCache) {
+				data, _ := json.Marshal(TaskInfo{ID: "12345", ModelName: "test_model", ModelVersion: "v1"})
+				cache.EXPECT().
+					SetKeyNX(gomock.Eq("12345"), gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(false, nil)
+				cache.EXPECT().
+					GetKey(gomock.Eq("12345")).
+					Times(1).
+					Return(string(data), nil)
+				cache.EXPECT().
+					Publish(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "Duplicate with a different payload",
+			body: gin.H{
+				"id":            "12345",
+				"model_name":    "test_model",
+				"model_version": "v1",
+			},
+			buildStubs: func(cache *mockstore.MockCache) {
+				data, _ := json.Marshal(TaskInfo{ID: "12345", ModelName: "other_model", ModelVersion: "v1"})
+				cache.EXPECT().
+					SetKeyNX(gomock.Eq("12345"), gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(false, nil)
+				cache.EXPECT().
+					GetKey(gomock.Eq("12345")).
+					Times(1).
+					Return(string(data), nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusConflict, recorder.Code)
+			},
+		},
 	}
 
 	for i := range testCases {
@@ -89,6 +142,7 @@ func TestCreate(t *testing.T) {
 
 			cache := mockstore.NewMockCache(ctrl)
 			tc.buildStubs(cache)
+			cache.EXPECT().Publish(gomock.Any(), gomock.Any()).AnyTimes().Return(nil)
 
 			server := newTestServer(t, nil, cache, nil)
 			recorder := httptest.NewRecorder()
@@ -106,6 +160,147 @@ func TestCreate(t *testing.T) {
 	}
 }
 
+func TestCreateDuplicate(t *testing.T) {
+	original := gin.H{
+		"id":             "12345",
+		"model_name":     "test_model",
+		"model_version":  "v1",
+		"queue_num":      2,
+		"webhook_url":    "https://example.com/callback",
+		"webhook_events": []string{TaskStatusSucceeded, TaskStatusFailed},
+	}
+	with := func(key string, value interface{}) gin.H {
+		body := gin.H{}
+		for k, v := range original {
+			body[k] = v
+		}
+		body[key] = value
+		return body
+	}
+	without := func(keys ...string) gin.H {
+		body := gin.H{}
+		for k, v := range original {
+			body[k] = v
+		}
+		for _, key := range keys {
+			delete(body, key)
+		}
+		return body
+	}
+
+	testCases := []struct {
+		name       string
+		uid        string
+		body       gin.H
+		update     bool
+		statusCode int
+	}{
+		{name: "Retry", uid: "bob", body: original, statusCode: http.StatusOK},
+		{
+			name:       "Webhook events in another order",
+			uid:        "bob",
+			body:       with("webhook_events", []string{TaskStatusFailed, TaskStatusSucceeded}),
+			statusCode: http.StatusOK,
+		},
+		{name: "Another user", uid: "alice", body: original, statusCode: http.StatusConflict},
+		{name: "Without user", uid: "", body: original, statusCode: http.StatusConflict},
+		{name: "Another model", uid: "bob", body: with("model_name", "other_model"), statusCode: http.StatusConflict},
+		{name: "Another queue", uid: "bob", body: with("queue_num", 3), statusCode: http.StatusConflict},
+		{name: "Another status", uid: "bob", body: with("status", TaskStatusQueued), statusCode: http.StatusConflict},
+		{
+			name:       "Another status after an update",
+			uid:        "bob",
+			body:       original,
+			update:     true,
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "Another webhook",
+			uid:        "bob",
+			body:       with("webhook_url", "https://example.com/other"),
+			statusCode: http.StatusConflict,
+		},
+		{
+			name:       "Another webhook event",
+			uid:        "bob",
+			body:       with("webhook_events", []string{TaskStatusSucceeded}),
+			statusCode: http.StatusConflict,
+		},
+		{
+			name:       "Without webhook",
+			uid:        "bob",
+			body:       without("webhook_url", "webhook_events"),
+			statusCode: http.StatusConflict,
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			server := newTestServer(t, nil, storage.NewMemoryCache(), nil)
+			sendRequest := func(method string, uid string, body gin.H) int {
+				data, err := json.Marshal(body)
+				require.NoError(t, err)
+				request, err := http.NewRequest(method, "/task", bytes.NewReader(data))
+				require.NoError(t, err)
+				request.Header.Set("UID", uid)
+				recorder := httptest.NewRecorder()
+				server.router.ServeHTTP(recorder, request)
+				return recorder.Code
+			}
+			require.Equal(t, http.StatusOK, sendRequest(http.MethodPost, "bob", original))
+			if tc.update {
+				require.Equal(t, http.StatusOK, sendRequest(http.MethodPut, "bob", gin.H{"id": "12345", "status": TaskStatusRunning}))
+			}
+			require.Equal(t, tc.statusCode, sendRequest(http.MethodPost, tc.uid, tc.body))
+		})
+	}
+}
+
+func TestCreateIdempotency(t *testing.T) {
+	cache := storage.NewMemoryCache()
+	server := newTestServer(t, nil, cache, nil)
+
+	sendRequest := func(body gin.H, key string) *httptest.ResponseRecorder {
+		data, err := json.Marshal(body)
+		require.NoError(t, err)
+		request, err := http.NewRequest(http.MethodPost, "/task", bytes.NewReader(data))
+		require.NoError(t, err)
+		if key != "" {
+			request.Header.Set(idempotencyHeaderKey, key)
+		}
+		recorder := httptest.NewRecorder()
+		server.router.ServeHTTP(recorder, request)
+		return recorder
+	}
+	body := gin.H{"id": "12345", "model_name": "test_model"}
+
+	recorder := sendRequest(body, "key-1")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	first := recorder.Body.String()
+
+	// The task is updated, but the retried request still gets the original response
+	require.NoError(t, cache.UpdateKey("12345", func(value string) (interface{}, error) {
+		return TaskInfo{ID: "12345", ModelName: "test_model", Status: "running"}, nil
+	}, time.Minute))
+	recorder = sendRequest(body, "key-1")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, first, recorder.Body.String())
+	value, err := cache.GetKey("12345")
+	require.NoError(t, err)
+	require.Contains(t, value, "running")
+
+	recorder = sendRequest(gin.H{"id": "12345", "model_name": "other_model"}, "key-1")
+	require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+
+	recorder = sendRequest(gin.H{"id": "12345", "model_name": "other_model"}, "")
+	require.Equal(t, http.StatusConflict, recorder.Code)
+
+	recorder = sendRequest(body, "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+}
+
 func requireBodyMatchTask(t *testing.T, body *bytes.Buffer, task TaskInfo) {
 	data, err := io.ReadAll(body)
 	require.NoError(t, err)
@@ -172,10 +367,25 @@ func TestGet(t *testing.T) {
 				cache.EXPECT().
 					GetKey(gomock.Eq("12345")).
 					Times(1).
-					Return("", errors.New("not found"))
+					Return("", storage.ErrKeyNotFound)
 			},
 			checkResponse: func(recorder *httptest.ResponseRecorder) {
-				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name: "Redis failed",
+			body: gin.H{
+				"id": "12345",
+			},
+			buildStubs: func(cache *mockstore.MockCache) {
+				cache.EXPECT().
+					GetKey(gomock.Eq("12345")).
+					Times(1).
+					Return("", errors.New("redis error"))
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
 			},
 		},
 	}
@@ -189,6 +399,7 @@ func TestGet(t *testing.T) {
 
 			cache := mockstore.NewMockCache(ctrl)
 			tc.buildStubs(cache)
+			cache.EXPECT().Publish(gomock.Any(), gomock.Any()).AnyTimes().Return(nil)
 
 			server := newTestServer(t, nil, cache, nil)
 			recorder := httptest.NewRecorder()
@@ -203,6 +414,154 @@ func TestGet(t *testing.T) {
 	}
 }
 
+func TestGetWithDB(t *testing.T) {
+	createdAt := time.Now().UTC().Truncate(time.Second)
+	record := db.Task{
+		ID:           1,
+		TaskID:       "12345",
+		UserID:       pgtype.Text{String: "user", Valid: true},
+		ModelName:    "test_model",
+		CreatedAt:    createdAt,
+		UpdatedAt:    createdAt,
+		RunningTime:  pgtype.Float8{Float64: 5.5, Valid: true},
+		Status:       pgtype.Text{String: "succeeded", Valid: true},
+		ModelVersion: pgtype.Text{String: "v1", Valid: true},
+		Outputs:      []byte(`{"output": "abc"}`),
+		ErrorInfo:    pgtype.Text{String: "empty", Valid: true},
+		QueueNum:     pgtype.Int4{Int32: 2, Valid: true},
+		QueueID:      pgtype.Text{String: "1234", Valid: true},
+	}
+	output := TaskInfo{
+		ID:           "12345",
+		ModelName:    "test_model",
+		ModelVersion: "v1",
+		Status:       "succeeded",
+		RunningTime:  "5.5s",
+		CreatedAt:    createdAt,
+		Outputs:      map[string]string{"output": "abc"},
+		ErrorInfo:    "empty",
+		QueueNum:     2,
+		QueueID:      "1234",
+	}
+
+	testCases := []struct {
+		name          string
+		repopulate    bool
+		buildStubs    func(cache *mockstore.MockCache, database *mockdb.MockStore)
+		checkResponse func(recoder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "Fallback to database",
+			buildStubs: func(cache *mockstore.MockCache, database *mockdb.MockStore) {
+				cache.EXPECT().
+					GetKey(gomock.Eq("12345")).
+					Times(1).
+					Return("", storage.ErrKeyNotFound)
+				cache.EXPECT().
+					SetKey(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0)
+				database.EXPECT().
+					GetTaskById(gomock.Any(), gomock.Eq("12345")).
+					Times(1).
+					Return(record, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				requireBodyMatchTask(t, recorder.Body, output)
+			},
+		},
+		{
+			name:       "Fallback and repopulate",
+			repopulate: true,
+			buildStubs: func(cache *mockstore.MockCache, database *mockdb.MockStore) {
+				cache.EXPECT().
+					GetKey(gomock.Eq("12345")).
+					Times(1).
+					Return("", storage.ErrKeyNotFound)
+				cache.EXPECT().
+					SetKey(gomock.Eq("12345"), gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil)
+				database.EXPECT().
+					GetTaskById(gomock.Any(), gomock.Eq("12345")).
+					Times(1).
+					Return(record, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				requireBodyMatchTask(t, recorder.Body, output)
+			},
+		},
+		{
+			name: "Task not found",
+			buildStubs: func(cache *mockstore.MockCache, database *mockdb.MockStore) {
+				cache.EXPECT().
+					GetKey(gomock.Eq("12345")).
+					Times(1).
+					Return("", storage.ErrKeyNotFound)
+				database.EXPECT().
+					GetTaskById(gomock.Any(), gomock.Eq("12345")).
+					Times(1).
+					Return(db.Task{}, db.ErrRecordNotFound)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+				var res map[string]string
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &res))
+				require.Equal(t, "not_found", res["code"])
+			},
+		},
+		{
+			name: "Database failed",
+			buildStubs: func(cache *mockstore.MockCache, database *mockdb.MockStore) {
+				cache.EXPECT().
+					GetKey(gomock.Eq("12345")).
+					Times(1).
+					Return("", storage.ErrKeyNotFound)
+				database.EXPECT().
+					GetTaskById(gomock.Any(), gomock.Eq("12345")).
+					Times(1).
+					Return(db.Task{}, errors.New("db error"))
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			cache := mockstore.NewMockCache(ctrl)
+			database := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(cache, database)
+			cache.EXPECT().Publish(gomock.Any(), gomock.Any()).AnyTimes().Return(nil)
+
+			server := newTestServer(t, nil, cache, database)
+			server.config.RedisRepopulate = tc.repopulate
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodGet, "/task/12345", nil)
+			require.NoError(t, err)
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+// updateKeyWith makes the mocked UpdateKey call the update function with the given value
+func updateKeyWith(value string) func(string, storage.UpdateFunc, time.Duration) error {
+	return func(key string, fn storage.UpdateFunc, expiration time.Duration) error {
+		_, err := fn(value)
+		return err
+	}
+}
+
 func TestUpdate(t *testing.T) {
 	arg := TaskInfo{
 		ID:           "12345",
@@ -231,6 +590,7 @@ func TestUpdate(t *testing.T) {
 	testCases := []struct {
 		name          string
 		body          gin.H
+		ifMatch       string
 		buildStubs    func(cache *mockstore.MockCache)
 		checkResponse func(recoder *httptest.ResponseRecorder)
 	}{
@@ -247,19 +607,82 @@ func TestUpdate(t *testing.T) {
 			buildStubs: func(cache *mockstore.MockCache) {
 				data, _ := json.Marshal(arg)
 				cache.EXPECT().
-					GetKey(gomock.Eq("12345")).
+					UpdateKey(gomock.Eq("12345"), gomock.Any(), gomock.Any()).
 					Times(1).
-					Return(string(data), nil)
+					DoAndReturn(updateKeyWith(string(data)))
 				cache.EXPECT().
-					SetKey(gomock.Any(), gomock.Any(), gomock.Any()).
+					Publish(gomock.Eq(TaskEventsChannel), gomock.Any()).
 					Times(1).
-					Return(nil)
+					DoAndReturn(func(channel string, message interface{}) error {
+						event := message.(TaskEvent)
+						require.Equal(t, TaskEventUpdated, event.Type)
+						require.Equal(t, "succeeded", event.Task.Status)
+						return nil
+					})
 			},
 			checkResponse: func(recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, `"1"`, recorder.Header().Get("ETag"))
 				requireBodyMatchTask(t, recorder.Body, output)
 			},
 		},
+		{
+			name: "OK If-Match",
+			body: gin.H{
+				"id":           "12345",
+				"status":       "succeeded",
+				"running_time": "5s",
+				"outputs":      map[string]string{"output": "abc"},
+				"error_info":   "empty",
+				"queue_id":     "1234",
+			},
+			ifMatch: `"0"`,
+			buildStubs: func(cache *mockstore.MockCache) {
+				data, _ := json.Marshal(arg)
+				cache.EXPECT().
+					UpdateKey(gomock.Eq("12345"), gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(updateKeyWith(string(data)))
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				requireBodyMatchTask(t, recorder.Body, output)
+			},
+		},
+		{
+			name: "Version mismatch",
+			body: gin.H{
+				"id":     "12345",
+				"status": "running",
+			},
+			ifMatch: `"3"`,
+			buildStubs: func(cache *mockstore.MockCache) {
+				data, _ := json.Marshal(arg)
+				cache.EXPECT().
+					UpdateKey(gomock.Eq("12345"), gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(updateKeyWith(string(data)))
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusPreconditionFailed, recorder.Code)
+			},
+		},
+		{
+			name: "Update conflict",
+			body: gin.H{
+				"id":     "12345",
+				"status": "running",
+			},
+			buildStubs: func(cache *mockstore.MockCache) {
+				cache.EXPECT().
+					UpdateKey(gomock.Eq("12345"), gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(storage.ErrUpdateConflict)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusConflict, recorder.Code)
+			},
+		},
 		{
 			name: "Task not found",
 			body: gin.H{
@@ -270,14 +693,46 @@ func TestUpdate(t *testing.T) {
 			},
 			buildStubs: func(cache *mockstore.MockCache) {
 				cache.EXPECT().
-					GetKey(gomock.Eq("12345")).
+					UpdateKey(gomock.Eq("12345"), gomock.Any(), gomock.Any()).
 					Times(1).
-					Return("", errors.New("not found"))
+					Return(storage.ErrKeyNotFound)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name: "Invalid status",
+			body: gin.H{
+				"id":     "12345",
+				"status": "done",
+			},
+			buildStubs: func(cache *mockstore.MockCache) {
+				cache.EXPECT().
+					UpdateKey(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0)
 			},
 			checkResponse: func(recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusBadRequest, recorder.Code)
 			},
 		},
+		{
+			name: "Invalid transition",
+			body: gin.H{
+				"id":     "12345",
+				"status": "pending",
+			},
+			buildStubs: func(cache *mockstore.MockCache) {
+				data, _ := json.Marshal(output)
+				cache.EXPECT().
+					UpdateKey(gomock.Eq("12345"), gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(updateKeyWith(string(data)))
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusConflict, recorder.Code)
+			},
+		},
 		{
 			name: "Unmarshal error",
 			body: gin.H{
@@ -288,9 +743,9 @@ func TestUpdate(t *testing.T) {
 			},
 			buildStubs: func(cache *mockstore.MockCache) {
 				cache.EXPECT().
-					GetKey(gomock.Eq("12345")).
+					UpdateKey(gomock.Eq("12345"), gomock.Any(), gomock.Any()).
 					Times(1).
-					Return("abc", nil)
+					DoAndReturn(updateKeyWith("abc"))
 			},
 			checkResponse: func(recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusInternalServerError, recorder.Code)
@@ -307,6 +762,7 @@ func TestUpdate(t *testing.T) {
 
 			cache := mockstore.NewMockCache(ctrl)
 			tc.buildStubs(cache)
+			cache.EXPECT().Publish(gomock.Any(), gomock.Any()).AnyTimes().Return(nil)
 
 			server := newTestServer(t, nil, cache, nil)
 			recorder := httptest.NewRecorder()
@@ -317,6 +773,9 @@ func TestUpdate(t *testing.T) {
 			request, err := http.NewRequest(
 				http.MethodPut, "/task", bytes.NewReader(data))
 			require.NoError(t, err)
+			if tc.ifMatch != "" {
+				request.Header.Set("If-Match", tc.ifMatch)
+			}
 
 			server.router.ServeHTTP(recorder, request)
 			tc.checkResponse(recorder)
@@ -339,12 +798,18 @@ func TestCreateWithDB(t *testing.T) {
 				"model_version": "v1",
 			},
 			buildStubs: func(cache *mockstore.MockCache, database *mockdb.MockStore) {
-				cache.EXPECT().
-					SetKey(gomock.Any(), gomock.Any(), gomock.Any()).
-					Times(0)
 				database.EXPECT().ExecTx(gomock.Any(), gomock.Any()).
 					Times(1).
 					Return(nil)
+				// The committed task is written through to redis
+				cache.EXPECT().
+					UpdateKey(gomock.Eq("12345"), gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(storage.ErrKeyNotFound)
+				cache.EXPECT().
+					SetKeyNX(gomock.Eq("12345"), gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(true, nil)
 			},
 			checkResponse: func(recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusOK, recorder.Code)
@@ -359,7 +824,7 @@ func TestCreateWithDB(t *testing.T) {
 			},
 			buildStubs: func(cache *mockstore.MockCache, database *mockdb.MockStore) {
 				cache.EXPECT().
-					SetKey(gomock.Any(), gomock.Any(), gomock.Any()).
+					SetKeyNX(gomock.Any(), gomock.Any(), gomock.Any()).
 					Times(0)
 				database.EXPECT().ExecTx(gomock.Any(), gomock.Any()).
 					Times(1).
@@ -369,6 +834,30 @@ func TestCreateWithDB(t *testing.T) {
 				require.Equal(t, http.StatusInternalServerError, recorder.Code)
 			},
 		},
+		{
+			name: "Duplicate in database",
+			body: gin.H{
+				"id":            "12345",
+				"model_name":    "test_model",
+				"model_version": "v1",
+			},
+			buildStubs: func(cache *mockstore.MockCache, database *mockdb.MockStore) {
+				database.EXPECT().ExecTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(errTaskExists)
+				cache.EXPECT().
+					GetKey(gomock.Eq("12345")).
+					Times(1).
+					Return("", storage.ErrKeyNotFound)
+				database.EXPECT().
+					GetTaskById(gomock.Any(), gomock.Eq("12345")).
+					Times(1).
+					Return(db.Task{TaskID: "12345", ModelName: "other_model"}, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusConflict, recorder.Code)
+			},
+		},
 	}
 
 	for i := range testCases {
@@ -381,6 +870,7 @@ func TestCreateWithDB(t *testing.T) {
 			cache := mockstore.NewMockCache(ctrl)
 			database := mockdb.NewMockStore(ctrl)
 			tc.buildStubs(cache, database)
+			cache.EXPECT().Publish(gomock.Any(), gomock.Any()).AnyTimes().Return(nil)
 
 			server := newTestServer(t, nil, cache, database)
 			recorder := httptest.NewRecorder()
@@ -399,16 +889,21 @@ func TestCreateWithDB(t *testing.T) {
 }
 
 func TestUpdateWithDB(t *testing.T) {
-	arg := TaskInfo{
+	record := db.Task{
+		TaskID:       "12345",
+		ModelName:    "test_model",
+		ModelVersion: pgtype.Text{String: "v1", Valid: true},
+		Status:       pgtype.Text{String: "pending", Valid: true},
+		QueueNum:     pgtype.Int4{Int32: 1, Valid: true},
+		Version:      1,
+	}
+	cached := TaskInfo{
 		ID:           "12345",
 		ModelName:    "test_model",
 		ModelVersion: "v1",
 		Status:       "pending",
-		RunningTime:  "",
-		CreatedAt:    time.Time{},
-		Outputs:      nil,
-		ErrorInfo:    "",
 		QueueNum:     1,
+		Version:      1,
 	}
 	output := TaskInfo{
 		ID:           "12345",
@@ -422,6 +917,27 @@ func TestUpdateWithDB(t *testing.T) {
 		QueueNum:     1,
 		QueueID:      "1234",
 	}
+	body := gin.H{
+		"id":           "12345",
+		"status":       "succeeded",
+		"running_time": "5s",
+		"outputs":      map[string]string{"output": "abc"},
+		"error_info":   "empty",
+		"queue_id":     "1234",
+	}
+	// writeThrough expects the updated task to be written to redis
+	writeThrough := func(cache *mockstore.MockCache, version int64) {
+		data, _ := json.Marshal(cached)
+		cache.EXPECT().
+			UpdateKey(gomock.Eq("12345"), gomock.Any(), gomock.Any()).
+			Times(1).
+			DoAndReturn(func(key string, fn storage.UpdateFunc, expiration time.Duration) error {
+				value, err := fn(string(data))
+				require.NoError(t, err)
+				require.Equal(t, version, value.(*TaskInfo).Version)
+				return nil
+			})
+	}
 
 	testCases := []struct {
 		name          string
@@ -431,78 +947,193 @@ func TestUpdateWithDB(t *testing.T) {
 	}{
 		{
 			name: "OK",
-			body: gin.H{
-				"id":           "12345",
-				"status":       "succeeded",
-				"running_time": "5s",
-				"outputs":      map[string]string{"output": "abc"},
-				"error_info":   "empty",
-				"queue_id":     "1234",
-			},
+			body: body,
 			buildStubs: func(cache *mockstore.MockCache, database *mockdb.MockStore) {
-				data, _ := json.Marshal(arg)
+				data, _ := json.Marshal(cached)
+				database.EXPECT().
+					GetTaskById(gomock.Any(), gomock.Eq("12345")).
+					Times(1).
+					Return(record, nil)
 				cache.EXPECT().
 					GetKey(gomock.Eq("12345")).
 					Times(1).
 					Return(string(data), nil)
-				cache.EXPECT().
-					SetKey(gomock.Any(), gomock.Any(), gomock.Any()).
-					Times(0)
 				database.EXPECT().ExecTx(gomock.Any(), gomock.Any()).
 					Times(1).
 					Return(nil)
+				writeThrough(cache, 2)
 			},
 			checkResponse: func(recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusOK, recorder.Code)
 				requireBodyMatchTask(t, recorder.Body, output)
+				require.Equal(t, `"2"`, recorder.Header().Get("ETag"))
 			},
 		},
 		{
 			name: "OK DatabaseOnly",
 			body: gin.H{
 				"id":            "12345",
-				"status":        "succeeded",
-				"running_time":  "5s",
-				"outputs":       map[string]string{"output": "abc"},
-				"error_info":    "empty",
-				"queue_id":      "1234",
+				"status":        "running",
 				"database_only": true,
 			},
 			buildStubs: func(cache *mockstore.MockCache, database *mockdb.MockStore) {
+				database.EXPECT().
+					GetTaskById(gomock.Any(), gomock.Eq("12345")).
+					Times(1).
+					Return(record, nil)
 				cache.EXPECT().
 					GetKey(gomock.Eq("12345")).
-					Times(0)
+					Times(1).
+					Return("", storage.ErrKeyNotFound)
+				database.EXPECT().ExecTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil)
 				cache.EXPECT().
-					SetKey(gomock.Any(), gomock.Any(), gomock.Any()).
-					Times(0)
+					UpdateKey(gomock.Eq("12345"), gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(storage.ErrKeyNotFound)
+				cache.EXPECT().
+					SetKeyNX(gomock.Eq("12345"), gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(true, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				requireBodyMatchTask(t, recorder.Body, TaskInfo{
+					ID:           "12345",
+					ModelName:    "test_model",
+					ModelVersion: "v1",
+					Status:       "running",
+					QueueNum:     1,
+				})
+			},
+		},
+		{
+			name: "OK Redis ahead",
+			body: body,
+			buildStubs: func(cache *mockstore.MockCache, database *mockdb.MockStore) {
+				// The task was updated in redis before the record had a version
+				ahead := cached
+				ahead.Version = 5
+				data, _ := json.Marshal(ahead)
+				database.EXPECT().
+					GetTaskById(gomock.Any(), gomock.Eq("12345")).
+					Times(1).
+					Return(record, nil)
+				cache.EXPECT().
+					GetKey(gomock.Eq("12345")).
+					Times(1).
+					Return(string(data), nil)
 				database.EXPECT().ExecTx(gomock.Any(), gomock.Any()).
 					Times(1).
 					Return(nil)
+				writeThrough(cache, 6)
 			},
 			checkResponse: func(recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, `"6"`, recorder.Header().Get("ETag"))
 			},
 		},
 		{
-			name: "Task not found",
+			name: "OK Redis unavailable",
+			body: body,
+			buildStubs: func(cache *mockstore.MockCache, database *mockdb.MockStore) {
+				database.EXPECT().
+					GetTaskById(gomock.Any(), gomock.Eq("12345")).
+					Times(1).
+					Return(record, nil)
+				cache.EXPECT().
+					GetKey(gomock.Eq("12345")).
+					Times(1).
+					Return("", errors.New("connection refused"))
+				database.EXPECT().ExecTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil)
+				// The relay writes the change from the outbox later
+				cache.EXPECT().
+					UpdateKey(gomock.Eq("12345"), gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(errors.New("connection refused"))
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				requireBodyMatchTask(t, recorder.Body, output)
+			},
+		},
+		{
+			name: "Concurrent update",
+			body: body,
+			buildStubs: func(cache *mockstore.MockCache, database *mockdb.MockStore) {
+				data, _ := json.Marshal(cached)
+				database.EXPECT().
+					GetTaskById(gomock.Any(), gomock.Eq("12345")).
+					Times(2).
+					Return(record, nil)
+				cache.EXPECT().
+					GetKey(gomock.Eq("12345")).
+					Times(2).
+					Return(string(data), nil)
+				gomock.InOrder(
+					database.EXPECT().ExecTx(gomock.Any(), gomock.Any()).
+						Times(1).
+						Return(errRecordChanged),
+					database.EXPECT().ExecTx(gomock.Any(), gomock.Any()).
+						Times(1).
+						Return(nil),
+				)
+				writeThrough(cache, 2)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				requireBodyMatchTask(t, recorder.Body, output)
+			},
+		},
+		{
+			name: "Too many concurrent updates",
+			body: body,
+			buildStubs: func(cache *mockstore.MockCache, database *mockdb.MockStore) {
+				database.EXPECT().
+					GetTaskById(gomock.Any(), gomock.Eq("12345")).
+					Times(maxRecordRetries).
+					Return(record, nil)
+				cache.EXPECT().
+					GetKey(gomock.Eq("12345")).
+					Times(maxRecordRetries).
+					Return("", storage.ErrKeyNotFound)
+				database.EXPECT().ExecTx(gomock.Any(), gomock.Any()).
+					Times(maxRecordRetries).
+					Return(errRecordChanged)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusConflict, recorder.Code)
+			},
+		},
+		{
+			name: "Invalid transition",
 			body: gin.H{
-				"id":           "12345",
-				"status":       "failed",
-				"running_time": "5s",
-				"outputs":      map[string]string{"output": "abc"},
+				"id":     "12345",
+				"status": "running",
 			},
 			buildStubs: func(cache *mockstore.MockCache, database *mockdb.MockStore) {
+				succeeded := record
+				succeeded.Status = pgtype.Text{String: "succeeded", Valid: true}
+				database.EXPECT().
+					GetTaskById(gomock.Any(), gomock.Eq("12345")).
+					Times(1).
+					Return(succeeded, nil)
 				cache.EXPECT().
 					GetKey(gomock.Eq("12345")).
 					Times(1).
-					Return("", errors.New("not found"))
+					Return("", storage.ErrKeyNotFound)
+				database.EXPECT().ExecTx(gomock.Any(), gomock.Any()).
+					Times(0)
 			},
 			checkResponse: func(recorder *httptest.ResponseRecorder) {
-				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				require.Equal(t, http.StatusConflict, recorder.Code)
 			},
 		},
 		{
-			name: "Unmarshal error",
+			name: "Task not found",
 			body: gin.H{
 				"id":           "12345",
 				"status":       "failed",
@@ -510,10 +1141,35 @@ func TestUpdateWithDB(t *testing.T) {
 				"outputs":      map[string]string{"output": "abc"},
 			},
 			buildStubs: func(cache *mockstore.MockCache, database *mockdb.MockStore) {
+				database.EXPECT().
+					GetTaskById(gomock.Any(), gomock.Eq("12345")).
+					Times(1).
+					Return(db.Task{}, db.ErrRecordNotFound)
+				database.EXPECT().ExecTx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name: "Update failed",
+			body: body,
+			buildStubs: func(cache *mockstore.MockCache, database *mockdb.MockStore) {
+				database.EXPECT().
+					GetTaskById(gomock.Any(), gomock.Eq("12345")).
+					Times(1).
+					Return(record, nil)
 				cache.EXPECT().
 					GetKey(gomock.Eq("12345")).
 					Times(1).
-					Return("abc", nil)
+					Return("", storage.ErrKeyNotFound)
+				database.EXPECT().ExecTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(errors.New("update error"))
+				cache.EXPECT().
+					UpdateKey(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0)
 			},
 			checkResponse: func(recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusInternalServerError, recorder.Code)
@@ -531,6 +1187,7 @@ func TestUpdateWithDB(t *testing.T) {
 			cache := mockstore.NewMockCache(ctrl)
 			database := mockdb.NewMockStore(ctrl)
 			tc.buildStubs(cache, database)
+			cache.EXPECT().Publish(gomock.Any(), gomock.Any()).AnyTimes().Return(nil)
 
 			server := newTestServer(t, nil, cache, database)
 			recorder := httptest.NewRecorder()
@@ -551,65 +1208,109 @@ func TestUpdateWithDB(t *testing.T) {
 func TestGetTaskFromDB(t *testing.T) {
 	tasks := []db.Task{
 		{
-			ID:        0,
+			ID:        1,
 			TaskID:    "12345",
 			ModelName: "test",
 			Status:    pgtype.Text{String: "pending", Valid: true},
 		},
 	}
+	params := db.ListTasksParams{
+		ModelName:  "test",
+		Statuses:   []string{"pending"},
+		SortBy:     db.SortByCreatedAt,
+		Descending: true,
+		Limit:      defaultListLimit + 1,
+	}
 	testCases := []struct {
 		name          string
+		query         string
 		body          gin.H
 		buildStubs    func(cache *mockstore.MockCache, database *mockdb.MockStore)
 		checkResponse func(recoder *httptest.ResponseRecorder)
 	}{
 		{
-			name: "OK",
-			body: gin.H{
-				"model_name": "test",
-				"status":     "pending",
-			},
+			name:  "OK",
+			query: "?model_name=test&status=pending",
 			buildStubs: func(cache *mockstore.MockCache, database *mockdb.MockStore) {
 				database.EXPECT().
-					GetTasksByModelNameAndStatus(gomock.Any(), gomock.Any()).
+					ListTasks(gomock.Any(), gomock.Eq(params)).
 					Times(1).
 					Return(tasks, nil)
 			},
 			checkResponse: func(recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusOK, recorder.Code)
-				fmt.Println(recorder.Body)
+				var res ListTasksResponse
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &res))
+				require.Len(t, res.Tasks, 1)
+				require.Equal(t, "12345", res.Tasks[0].ID)
+				require.Equal(t, "pending", res.Tasks[0].Status)
+				require.Empty(t, res.NextCursor)
 			},
 		},
 		{
-			name: "Internal error",
+			name: "OK Body",
 			body: gin.H{
 				"model_name": "test",
 				"status":     "pending",
 			},
 			buildStubs: func(cache *mockstore.MockCache, database *mockdb.MockStore) {
 				database.EXPECT().
-					GetTasksByModelNameAndStatus(gomock.Any(), gomock.Any()).
+					ListTasks(gomock.Any(), gomock.Eq(params)).
 					Times(1).
-					Return(nil, errors.New("failed"))
+					Return(tasks, nil)
 			},
 			checkResponse: func(recorder *httptest.ResponseRecorder) {
-				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+				require.Equal(t, http.StatusOK, recorder.Code)
 			},
 		},
 		{
-			name: "Record not found",
-			body: gin.H{
-				"model_name": "test",
-				"status":     "pending",
+			name:  "Paginated",
+			query: "?model_name=test&status=pending&limit=1",
+			buildStubs: func(cache *mockstore.MockCache, database *mockdb.MockStore) {
+				database.EXPECT().
+					ListTasks(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(append(tasks, db.Task{ID: 2, TaskID: "67890"}), nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				var res ListTasksResponse
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &res))
+				require.Len(t, res.Tasks, 1)
+				require.Equal(t, encodeCursor(defaultListSort, tasks[0]), res.NextCursor)
 			},
+		},
+		{
+			name:  "Missing status",
+			query: "?model_name=test",
+			buildStubs: func(cache *mockstore.MockCache, database *mockdb.MockStore) {
+				database.EXPECT().ListTasks(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:  "Invalid status",
+			query: "?model_name=test&status=done",
+			buildStubs: func(cache *mockstore.MockCache, database *mockdb.MockStore) {
+				database.EXPECT().ListTasks(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:  "Internal error",
+			query: "?model_name=test&status=pending",
 			buildStubs: func(cache *mockstore.MockCache, database *mockdb.MockStore) {
 				database.EXPECT().
-					GetTasksByModelNameAndStatus(gomock.Any(), gomock.Any()).
+					ListTasks(gomock.Any(), gomock.Any()).
 					Times(1).
-					Return(nil, db.ErrRecordNotFound)
+					Return(nil, errors.New("failed"))
 			},
 			checkResponse: func(recorder *httptest.ResponseRecorder) {
-				require.Equal(t, http.StatusNotFound, recorder.Code)
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
 			},
 		},
 	}
@@ -628,11 +1329,14 @@ func TestGetTaskFromDB(t *testing.T) {
 			server := newTestServer(t, nil, cache, database)
 			recorder := httptest.NewRecorder()
 
-			data, err := json.Marshal(tc.body)
-			require.NoError(t, err)
-
+			var body io.Reader
+			if tc.body != nil {
+				data, err := json.Marshal(tc.body)
+				require.NoError(t, err)
+				body = bytes.NewReader(data)
+			}
 			request, err := http.NewRequest(
-				http.MethodGet, "/task/modelstatus", bytes.NewReader(data))
+				http.MethodGet, "/task/modelstatus"+tc.query, body)
 			require.NoError(t, err)
 
 			server.router.ServeHTTP(recorder, request)
@@ -640,3 +1344,66 @@ func TestGetTaskFromDB(t *testing.T) {
 		})
 	}
 }
+
+func TestTaskWithMemoryCache(t *testing.T) {
+	server := newTestServer(t, nil, storage.NewMemoryCache(), nil)
+
+	sendRequest := func(method string, url string, body gin.H) *httptest.ResponseRecorder {
+		var reader io.Reader = nil
+		if body != nil {
+			data, err := json.Marshal(body)
+			require.NoError(t, err)
+			reader = bytes.NewReader(data)
+		}
+		request, err := http.NewRequest(method, url, reader)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		server.router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	recorder := sendRequest(http.MethodGet, "/task/12345", nil)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+
+	recorder = sendRequest(http.MethodPost, "/task", gin.H{
+		"id":            "12345",
+		"model_name":    "test_model",
+		"model_version": "v1",
+	})
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	// Concurrent updates of different fields should not overwrite each other
+	var wg sync.WaitGroup
+	for _, body := range []gin.H{
+		{"id": "12345", "queue_id": "1234"},
+		{"id": "12345", "status": "running"},
+	} {
+		wg.Add(1)
+		go func(body gin.H) {
+			defer wg.Done()
+			recorder := sendRequest(http.MethodPut, "/task", body)
+			require.Equal(t, http.StatusOK, recorder.Code)
+		}(body)
+	}
+	wg.Wait()
+
+	recorder = sendRequest(http.MethodPut, "/task", gin.H{
+		"id":           "12345",
+		"status":       "succeeded",
+		"running_time": "5s",
+		"outputs":      map[string]string{"output": "abc"},
+	})
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder = sendRequest(http.MethodGet, "/task/12345", nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var task TaskInfo
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &task))
+	require.Equal(t, "test_model", task.ModelName)
+	require.Equal(t, "succeeded", task.Status)
+	require.Equal(t, "1234", task.QueueID)
+	require.Equal(t, int64(4), task.Version)
+	require.Equal(t, `"4"`, recorder.Header().Get("ETag"))
+	require.Equal(t, "5s", task.RunningTime)
+	require.Equal(t, map[string]interface{}{"output": "abc"}, task.Outputs)
+}
@@ -0,0 +1,195 @@
+package api
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	db "github.com/HyperGAI/serving-webhook/db/sqlc"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	usageRollupInterval = 10 * time.Minute
+	maxUsagePeriod      = 366 * 24 * time.Hour
+	usageDayLayout      = "2006-01-02"
+)
+
+// parseRunningTime converts a running time like "12.3s" to seconds
+func parseRunningTime(value string) (float64, error) {
+	return strconv.ParseFloat(strings.Replace(value, "s", "", -1), 64)
+}
+
+// recordUsage bills the running time of a task when it is completed. It must be called
+// in the transaction of the change, and a task is billed at most once.
+func (server *Server) recordUsage(ctx context.Context, q db.Querier, previous *TaskInfo, task *TaskInfo) error {
+	if isTerminalStatus(previous.Status) || !isTerminalStatus(task.Status) || task.RunningTime == "" {
+		return nil
+	}
+	seconds, err := parseRunningTime(task.RunningTime)
+	if err != nil || seconds <= 0 {
+		return nil
+	}
+	return q.CreateUsageRecord(ctx, db.CreateUsageRecordParams{
+		TaskID:       task.ID,
+		UserID:       task.UserID,
+		ModelName:    task.ModelName,
+		ModelVersion: task.ModelVersion,
+		Status:       task.Status,
+		GpuSeconds:   seconds,
+		CompletedAt:  task.UpdatedAt,
+	})
+}
+
+// rollupUsage recomputes the daily usage in UTC since the last day that has been fully
+// rolled up, so that the days missed while the rollup wasn't running are caught up. It
+// covers at least today and yesterday, so that the tasks completed just before midnight
+// are included in the final rollup of their day. The first rollup covers all the records.
+func (server *Server) rollupUsage(ctx context.Context, now time.Time) error {
+	yesterday := now.UTC().Truncate(24*time.Hour).AddDate(0, 0, -1)
+	since := yesterday
+	watermark, err := server.database.GetUsageRollupDay(ctx)
+	if errors.Is(err, db.ErrRecordNotFound) {
+		since = time.Unix(0, 0).UTC()
+	} else if err != nil {
+		return err
+	} else if watermark.Valid && watermark.Time.Before(since) {
+		since = watermark.Time
+	}
+	if err = server.database.RollupUsage(ctx, since); err != nil {
+		return err
+	}
+	// Yesterday is complete once it has been rolled up today
+	return server.database.SetUsageRollupDay(ctx, pgtype.Date{Time: yesterday, Valid: true})
+}
+
+// UsageExportRequest selects the daily usage in [from, to), the days are in UTC.
+// The period defaults to the current month.
+type UsageExportRequest struct {
+	UserID string `form:"user_id"`
+	From   string `form:"from"`
+	To     string `form:"to"`
+	Format string `form:"format" binding:"omitempty,oneof=csv ndjson"`
+}
+
+// UsageRow is the usage of a model version by a user on a day
+type UsageRow struct {
+	Day          string  `json:"day"`
+	UserID       string  `json:"user_id"`
+	ModelName    string  `json:"model_name"`
+	ModelVersion string  `json:"model_version"`
+	Tasks        int64   `json:"tasks"`
+	GPUSeconds   float64 `json:"gpu_seconds"`
+}
+
+var usageColumns = []string{"day", "user_id", "model_name", "model_version", "tasks", "gpu_seconds"}
+
+func newUsageRow(usage db.UsageDaily) UsageRow {
+	return UsageRow{
+		Day:          usage.Day.Time.Format(usageDayLayout),
+		UserID:       usage.UserID,
+		ModelName:    usage.ModelName,
+		ModelVersion: usage.ModelVersion,
+		Tasks:        usage.Tasks,
+		GPUSeconds:   usage.GpuSeconds,
+	}
+}
+
+// usagePeriod validates the period of the request
+func usagePeriod(req *UsageExportRequest, now time.Time) (time.Time, time.Time, error) {
+	now = now.UTC()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+	var err error
+	if req.From != "" {
+		if from, err = time.Parse(usageDayLayout, req.From); err != nil {
+			return from, to, fmt.Errorf("%w: invalid day %q", errInvalidQuery, req.From)
+		}
+	}
+	if req.To != "" {
+		if to, err = time.Parse(usageDayLayout, req.To); err != nil {
+			return from, to, fmt.Errorf("%w: invalid day %q", errInvalidQuery, req.To)
+		}
+	} else if req.From != "" {
+		to = from.AddDate(0, 1, 0)
+	}
+	if !from.Before(to) {
+		return from, to, fmt.Errorf("%w: from must be before to", errInvalidQuery)
+	}
+	if to.Sub(from) > maxUsagePeriod {
+		return from, to, fmt.Errorf("%w: the period is longer than %s", errInvalidQuery, maxUsagePeriod)
+	}
+	return from, to, nil
+}
+
+/*
+curl "http://localhost:12000/usage/export?user_id=<USER_ID>&from=2024-01-01&to=2024-02-01&format=ndjson"
+*/
+
+// ExportUsage exports the daily usage of a period as CSV or NDJSON, ordered by user
+// and day. The usage of today is up to date as of the last rollup.
+func (server *Server) ExportUsage(ctx *gin.Context) {
+	var req UsageExportRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	from, to, err := usagePeriod(&req, time.Now())
+	if hasError(ctx, err) {
+		return
+	}
+	records, err := server.database.ListDailyUsage(ctx, db.ListDailyUsageParams{
+		FromDay: pgtype.Date{Time: from, Valid: true},
+		ToDay:   pgtype.Date{Time: to, Valid: true},
+		UserID:  pgtype.Text{String: req.UserID, Valid: req.UserID != ""},
+	})
+	if hasError(ctx, err) {
+		return
+	}
+
+	format := req.Format
+	if format == "" {
+		format = "csv"
+	}
+	filename := fmt.Sprintf("usage_%s_%s.%s", from.Format(usageDayLayout), to.Format(usageDayLayout), format)
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	if format == "ndjson" {
+		ctx.Header("Content-Type", "application/x-ndjson")
+		ctx.Status(http.StatusOK)
+		encoder := json.NewEncoder(ctx.Writer)
+		for _, record := range records {
+			if err = encoder.Encode(newUsageRow(record)); err != nil {
+				log.Error().Msgf("failed to export the usage: %v", err)
+				return
+			}
+		}
+		return
+	}
+
+	ctx.Header("Content-Type", "text/csv")
+	ctx.Status(http.StatusOK)
+	writer := csv.NewWriter(ctx.Writer)
+	_ = writer.Write(usageColumns)
+	for _, record := range records {
+		row := newUsageRow(record)
+		_ = writer.Write([]string{
+			row.Day,
+			row.UserID,
+			row.ModelName,
+			row.ModelVersion,
+			strconv.FormatInt(row.Tasks, 10),
+			strconv.FormatFloat(row.GPUSeconds, 'f', -1, 64),
+		})
+	}
+	writer.Flush()
+	if err = writer.Error(); err != nil {
+		log.Error().Msgf("failed to export the usage: %v", err)
+	}
+}
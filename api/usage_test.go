@@ -0,0 +1,297 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	mockdb "github.com/HyperGAI/serving-webhook/db/mock"
+	db "github.com/HyperGAI/serving-webhook/db/sqlc"
+	mockstore "github.com/HyperGAI/serving-webhook/storage/mock"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecordUsage(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	database := mockdb.NewMockStore(ctrl)
+	server := newTestServer(t, nil, mockstore.NewMockCache(ctrl), database)
+
+	now := time.Now()
+	running := TaskInfo{ID: "12345", UserID: "alice", ModelName: "test_model", ModelVersion: "v1", Status: TaskStatusRunning}
+	succeeded := running
+	succeeded.Status = TaskStatusSucceeded
+	succeeded.RunningTime = "12.5s"
+	succeeded.UpdatedAt = now
+
+	database.EXPECT().
+		CreateUsageRecord(gomock.Any(), gomock.Eq(db.CreateUsageRecordParams{
+			TaskID:       "12345",
+			UserID:       "alice",
+			ModelName:    "test_model",
+			ModelVersion: "v1",
+			Status:       TaskStatusSucceeded,
+			GpuSeconds:   12.5,
+			CompletedAt:  now,
+		})).
+		Times(1).
+		Return(nil)
+	require.NoError(t, server.recordUsage(context.Background(), database, &running, &succeeded))
+
+	// Only the completion of a task with a running time is billed
+	queued := running
+	queued.Status = TaskStatusQueued
+	require.NoError(t, server.recordUsage(context.Background(), database, &queued, &running))
+	canceled := queued
+	canceled.Status = TaskStatusCanceled
+	require.NoError(t, server.recordUsage(context.Background(), database, &queued, &canceled))
+	updated := succeeded
+	updated.ErrorInfo = "late update"
+	require.NoError(t, server.recordUsage(context.Background(), database, &succeeded, &updated))
+}
+
+func TestRollupUsage(t *testing.T) {
+	// It is Jan 1 in UTC
+	now := time.Date(2024, 1, 2, 0, 5, 0, 0, time.FixedZone("UTC+8", 8*3600))
+	yesterday := time.Date(2023, 12, 31, 0, 0, 0, 0, time.UTC)
+	day := func(year int, month time.Month, day int) pgtype.Date {
+		return pgtype.Date{Time: time.Date(year, month, day, 0, 0, 0, 0, time.UTC), Valid: true}
+	}
+
+	testCases := []struct {
+		name       string
+		buildStubs func(database *mockdb.MockStore)
+		checkError func(err error)
+	}{
+		{
+			name: "OK",
+			buildStubs: func(database *mockdb.MockStore) {
+				database.EXPECT().GetUsageRollupDay(gomock.Any()).Times(1).Return(day(2023, 12, 31), nil)
+				database.EXPECT().RollupUsage(gomock.Any(), gomock.Eq(yesterday)).Times(1).Return(nil)
+				database.EXPECT().SetUsageRollupDay(gomock.Any(), gomock.Eq(day(2023, 12, 31))).Times(1).Return(nil)
+			},
+			checkError: func(err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "Gap",
+			buildStubs: func(database *mockdb.MockStore) {
+				// The rollup hasn't succeeded for days, which are rolled up again
+				database.EXPECT().GetUsageRollupDay(gomock.Any()).Times(1).Return(day(2023, 12, 25), nil)
+				database.EXPECT().
+					RollupUsage(gomock.Any(), gomock.Eq(time.Date(2023, 12, 25, 0, 0, 0, 0, time.UTC))).
+					Times(1).
+					Return(nil)
+				database.EXPECT().SetUsageRollupDay(gomock.Any(), gomock.Eq(day(2023, 12, 31))).Times(1).Return(nil)
+			},
+			checkError: func(err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "First rollup",
+			buildStubs: func(database *mockdb.MockStore) {
+				database.EXPECT().GetUsageRollupDay(gomock.Any()).Times(1).Return(pgtype.Date{}, db.ErrRecordNotFound)
+				database.EXPECT().RollupUsage(gomock.Any(), gomock.Eq(time.Unix(0, 0).UTC())).Times(1).Return(nil)
+				database.EXPECT().SetUsageRollupDay(gomock.Any(), gomock.Eq(day(2023, 12, 31))).Times(1).Return(nil)
+			},
+			checkError: func(err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "Rollup failed",
+			buildStubs: func(database *mockdb.MockStore) {
+				database.EXPECT().GetUsageRollupDay(gomock.Any()).Times(1).Return(day(2023, 12, 25), nil)
+				database.EXPECT().RollupUsage(gomock.Any(), gomock.Any()).Times(1).Return(errors.New("connection refused"))
+				// The watermark stays, so that the next run starts from the same day
+				database.EXPECT().SetUsageRollupDay(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkError: func(err error) {
+				require.Error(t, err)
+			},
+		},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			database := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(database)
+
+			server := newTestServer(t, nil, mockstore.NewMockCache(ctrl), database)
+			tc.checkError(server.rollupUsage(context.Background(), now))
+		})
+	}
+}
+
+func TestExportUsage(t *testing.T) {
+	records := []db.UsageDaily{
+		{
+			Day:          pgtype.Date{Time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Valid: true},
+			UserID:       "alice",
+			ModelName:    "test_model",
+			ModelVersion: "v1",
+			Tasks:        3,
+			GpuSeconds:   37.5,
+		},
+		{
+			Day:          pgtype.Date{Time: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), Valid: true},
+			UserID:       "alice",
+			ModelName:    "test_model",
+			ModelVersion: "v2",
+			Tasks:        1,
+			GpuSeconds:   2,
+		},
+	}
+	params := db.ListDailyUsageParams{
+		FromDay: pgtype.Date{Time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Valid: true},
+		ToDay:   pgtype.Date{Time: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), Valid: true},
+		UserID:  pgtype.Text{String: "alice", Valid: true},
+	}
+
+	testCases := []struct {
+		name          string
+		query         string
+		buildStubs    func(database *mockdb.MockStore)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:  "CSV",
+			query: "?user_id=alice&from=2024-01-01&to=2024-02-01",
+			buildStubs: func(database *mockdb.MockStore) {
+				database.EXPECT().ListDailyUsage(gomock.Any(), gomock.Eq(params)).Times(1).Return(records, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, "text/csv", recorder.Header().Get("Content-Type"))
+				require.Contains(t, recorder.Header().Get("Content-Disposition"), "usage_2024-01-01_2024-02-01.csv")
+				rows, err := csv.NewReader(recorder.Body).ReadAll()
+				require.NoError(t, err)
+				require.Equal(t, [][]string{
+					usageColumns,
+					{"2024-01-01", "alice", "test_model", "v1", "3", "37.5"},
+					{"2024-01-02", "alice", "test_model", "v2", "1", "2"},
+				}, rows)
+			},
+		},
+		{
+			name:  "NDJSON",
+			query: "?user_id=alice&from=2024-01-01&format=ndjson",
+			buildStubs: func(database *mockdb.MockStore) {
+				database.EXPECT().ListDailyUsage(gomock.Any(), gomock.Eq(params)).Times(1).Return(records, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, "application/x-ndjson", recorder.Header().Get("Content-Type"))
+				var rows []UsageRow
+				scanner := bufio.NewScanner(recorder.Body)
+				for scanner.Scan() {
+					var row UsageRow
+					require.NoError(t, json.Unmarshal(scanner.Bytes(), &row))
+					rows = append(rows, row)
+				}
+				require.Equal(t, []UsageRow{
+					{Day: "2024-01-01", UserID: "alice", ModelName: "test_model", ModelVersion: "v1", Tasks: 3, GPUSeconds: 37.5},
+					{Day: "2024-01-02", UserID: "alice", ModelName: "test_model", ModelVersion: "v2", Tasks: 1, GPUSeconds: 2},
+				}, rows)
+			},
+		},
+		{
+			name:  "Current month",
+			query: "",
+			buildStubs: func(database *mockdb.MockStore) {
+				database.EXPECT().
+					ListDailyUsage(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ interface{}, arg db.ListDailyUsageParams) ([]db.UsageDaily, error) {
+						now := time.Now().UTC()
+						require.Equal(t, time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC), arg.FromDay.Time)
+						require.Equal(t, arg.FromDay.Time.AddDate(0, 1, 0), arg.ToDay.Time)
+						require.False(t, arg.UserID.Valid)
+						return []db.UsageDaily{}, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, strings.Join(usageColumns, ",")+"\n", recorder.Body.String())
+			},
+		},
+		{
+			name:  "Invalid day",
+			query: "?from=2024-01-32",
+			buildStubs: func(database *mockdb.MockStore) {
+				database.EXPECT().ListDailyUsage(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:  "Period too long",
+			query: "?from=2023-01-01&to=2024-06-01",
+			buildStubs: func(database *mockdb.MockStore) {
+				database.EXPECT().ListDailyUsage(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:  "Invalid format",
+			query: "?format=xml",
+			buildStubs: func(database *mockdb.MockStore) {
+				database.EXPECT().ListDailyUsage(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:  "Database error",
+			query: "",
+			buildStubs: func(database *mockdb.MockStore) {
+				database.EXPECT().
+					ListDailyUsage(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil, errors.New("connection refused"))
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			database := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(database)
+
+			server := newTestServer(t, nil, mockstore.NewMockCache(ctrl), database)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodGet, "/usage/export"+tc.query, nil)
+			require.NoError(t, err)
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
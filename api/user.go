@@ -0,0 +1,94 @@
+package api
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgtype"
+	"net/http"
+)
+
+type UserURI struct {
+	UID string `uri:"uid" binding:"required"`
+}
+
+// UserTasksRequest is the query of the task history of a user
+type UserTasksRequest struct {
+	Statuses []string `form:"status"`
+	Limit    int32    `form:"limit" binding:"omitempty,min=1,max=500"`
+	Cursor   string   `form:"cursor"`
+}
+
+// UserTasksResponse is a page of the task history of a user, newest first. Total is
+// the number of tasks matching the status filter, and Counts has the number of all
+// the tasks of the user by status.
+type UserTasksResponse struct {
+	ListTasksResponse
+	Total  int64            `json:"total"`
+	Counts map[string]int64 `json:"counts"`
+}
+
+/*
+curl "http://localhost:12000/users/<USER_ID>/tasks?status=succeeded&limit=20"
+*/
+
+// UserTasks returns the task history of the user in the path
+func (server *Server) UserTasks(ctx *gin.Context) {
+	var uri UserURI
+	if err := ctx.BindUri(&uri); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	server.userTasks(ctx, uri.UID)
+}
+
+/*
+curl "http://localhost:12000/me/tasks?limit=20" -H "UID: <USER_ID>"
+*/
+
+// MyTasks returns the task history of the user in the UID header
+func (server *Server) MyTasks(ctx *gin.Context) {
+	userID := ctx.GetHeader("UID")
+	if userID == "" {
+		ctx.JSON(http.StatusBadRequest, errorResponse(errors.New("the UID header is required")))
+		return
+	}
+	server.userTasks(ctx, userID)
+}
+
+func (server *Server) userTasks(ctx *gin.Context, userID string) {
+	var req UserTasksRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	statuses, err := parseStatuses(req.Statuses)
+	if hasError(ctx, err) {
+		return
+	}
+	page, err := server.queryTasks(ctx, &ListTasksRequest{
+		UserID:   userID,
+		Statuses: statuses,
+		Limit:    req.Limit,
+		Cursor:   req.Cursor,
+	})
+	if hasError(ctx, err) {
+		return
+	}
+	rows, err := server.database.CountTasksByUser(ctx, pgtype.Text{String: userID, Valid: true})
+	if hasError(ctx, err) {
+		return
+	}
+
+	res := UserTasksResponse{ListTasksResponse: *page, Counts: make(map[string]int64, len(rows))}
+	filter := make(map[string]bool, len(statuses))
+	for _, status := range statuses {
+		filter[status] = true
+	}
+	for _, row := range rows {
+		res.Counts[row.Status.String] += row.Count
+		if len(filter) == 0 || filter[row.Status.String] {
+			res.Total += row.Count
+		}
+	}
+	ctx.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	mockdb "github.com/HyperGAI/serving-webhook/db/mock"
+	db "github.com/HyperGAI/serving-webhook/db/sqlc"
+	mockstore "github.com/HyperGAI/serving-webhook/storage/mock"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUserTasks(t *testing.T) {
+	records := []db.Task{
+		{ID: 2, TaskID: "b", UserID: pgtype.Text{String: "alice", Valid: true}, Status: pgtype.Text{String: "succeeded", Valid: true}},
+		{ID: 1, TaskID: "a", UserID: pgtype.Text{String: "alice", Valid: true}, Status: pgtype.Text{String: "failed", Valid: true}},
+	}
+	counts := []db.CountTasksByUserRow{
+		{Status: pgtype.Text{String: "succeeded", Valid: true}, Count: 10},
+		{Status: pgtype.Text{String: "failed", Valid: true}, Count: 3},
+		{Status: pgtype.Text{String: "running", Valid: true}, Count: 1},
+	}
+	alice := pgtype.Text{String: "alice", Valid: true}
+
+	testCases := []struct {
+		name          string
+		url           string
+		uid           string
+		buildStubs    func(database *mockdb.MockStore)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			url:  "/users/alice/tasks?status=succeeded,failed&limit=1",
+			buildStubs: func(database *mockdb.MockStore) {
+				database.EXPECT().
+					ListTasks(gomock.Any(), gomock.Eq(db.ListTasksParams{
+						UserID:     "alice",
+						Statuses:   []string{"succeeded", "failed"},
+						SortBy:     db.SortByCreatedAt,
+						Descending: true,
+						Limit:      2,
+					})).
+					Times(1).
+					Return(records, nil)
+				database.EXPECT().
+					CountTasksByUser(gomock.Any(), gomock.Eq(alice)).
+					Times(1).
+					Return(counts, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				var res UserTasksResponse
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &res))
+				require.Len(t, res.Tasks, 1)
+				require.Equal(t, "b", res.Tasks[0].ID)
+				require.NotEmpty(t, res.NextCursor)
+				require.Equal(t, int64(13), res.Total)
+				require.Equal(t, map[string]int64{"succeeded": 10, "failed": 3, "running": 1}, res.Counts)
+			},
+		},
+		{
+			name: "OK Me",
+			url:  "/me/tasks",
+			uid:  "alice",
+			buildStubs: func(database *mockdb.MockStore) {
+				database.EXPECT().
+					ListTasks(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ interface{}, arg db.ListTasksParams) ([]db.Task, error) {
+						require.Equal(t, "alice", arg.UserID)
+						require.Empty(t, arg.Statuses)
+						return records, nil
+					})
+				database.EXPECT().
+					CountTasksByUser(gomock.Any(), gomock.Eq(alice)).
+					Times(1).
+					Return(counts, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				var res UserTasksResponse
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &res))
+				require.Len(t, res.Tasks, 2)
+				require.Empty(t, res.NextCursor)
+				require.Equal(t, int64(14), res.Total)
+			},
+		},
+		{
+			name: "Me without UID",
+			url:  "/me/tasks",
+			buildStubs: func(database *mockdb.MockStore) {
+				database.EXPECT().ListTasks(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "Invalid status",
+			url:  "/users/alice/tasks?status=done",
+			buildStubs: func(database *mockdb.MockStore) {
+				database.EXPECT().ListTasks(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "Count error",
+			url:  "/users/alice/tasks",
+			buildStubs: func(database *mockdb.MockStore) {
+				database.EXPECT().
+					ListTasks(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(records, nil)
+				database.EXPECT().
+					CountTasksByUser(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil, errors.New("connection refused"))
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			database := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(database)
+
+			server := newTestServer(t, nil, mockstore.NewMockCache(ctrl), database)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodGet, tc.url, nil)
+			require.NoError(t, err)
+			if tc.uid != "" {
+				request.Header.Set("UID", tc.uid)
+			}
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
@@ -0,0 +1,405 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	db "github.com/HyperGAI/serving-webhook/db/sqlc"
+	"github.com/HyperGAI/serving-webhook/utils"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/rs/zerolog/log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	webhookEventHeaderKey     = "X-Webhook-Event"
+	webhookDeliveryHeaderKey  = "X-Webhook-Delivery"
+	webhookTimestampHeaderKey = "X-Webhook-Timestamp"
+	webhookSignatureHeaderKey = "X-Webhook-Signature"
+
+	defaultWebhookTimeout     = 10 * time.Second
+	defaultWebhookMaxAttempts = 8
+	webhookRetryBase          = 10 * time.Second
+	webhookRetryMax           = time.Hour
+	webhookPollInterval       = time.Second
+	webhookBatchSize          = 10
+)
+
+// The status of a webhook delivery
+const (
+	DeliveryStatusPending   = "pending"
+	DeliveryStatusSucceeded = "succeeded"
+	DeliveryStatusFailed    = "failed"
+)
+
+// defaultWebhookEvents are the statuses notified if a task doesn't set webhook_events
+var defaultWebhookEvents = []string{
+	TaskStatusSucceeded,
+	TaskStatusFailed,
+	TaskStatusCanceled,
+	TaskStatusTimedOut,
+}
+
+var (
+	errInvalidWebhook     = errors.New("invalid webhook")
+	errWebhookAddress     = errors.New("webhook address is not allowed")
+	errWebhookRedirection = errors.New("webhook redirection is not allowed")
+)
+
+// newWebhookClient returns the client of the webhooks set by the tenants. Unless
+// WEBHOOK_ALLOW_PRIVATE is set, it refuses to connect to the loopback, private,
+// link-local and unspecified addresses, which are checked after the DNS resolution,
+// so that a webhook cannot reach the metadata service or the cluster-internal services.
+// The redirections are never followed, since they could lead anywhere.
+func newWebhookClient(config utils.Config) (*http.Client, error) {
+	timeout := defaultWebhookTimeout
+	if config.WebhookTimeout != "" {
+		duration, err := time.ParseDuration(config.WebhookTimeout)
+		if err != nil {
+			return nil, err
+		}
+		timeout = duration
+	}
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !config.WebhookAllowPrivate {
+		dialer.Control = checkWebhookAddress
+		// A proxy would connect to the webhook on behalf of the client, bypassing the check
+		transport.Proxy = nil
+	}
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return errWebhookRedirection
+		},
+	}, nil
+}
+
+// checkWebhookAddress is the control function of the webhook dialer, which is called
+// with the resolved IP address right before connecting
+func checkWebhookAddress(network string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !isPublicIP(ip) {
+		return fmt.Errorf("%w: %s", errWebhookAddress, host)
+	}
+	return nil
+}
+
+// reservedNetworks are the special-purpose ranges that net.IP doesn't classify: the
+// shared address space of carrier-grade NAT, the IETF protocol assignments and the
+// benchmarking networks
+var reservedNetworks = []*net.IPNet{
+	mustParseCIDR("100.64.0.0/10"),
+	mustParseCIDR("192.0.0.0/24"),
+	mustParseCIDR("198.18.0.0/15"),
+}
+
+func mustParseCIDR(cidr string) *net.IPNet {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return network
+}
+
+// isPublicIP checks if the IP address is not a loopback, private, link-local,
+// unspecified, multicast or reserved address
+func isPublicIP(ip net.IP) bool {
+	for _, network := range reservedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return !ip.IsLoopback() &&
+		!ip.IsPrivate() &&
+		!ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() &&
+		!ip.IsMulticast() &&
+		!ip.IsUnspecified()
+}
+
+// validateWebhook checks the callback URL and the statuses that trigger it
+func validateWebhook(webhookURL string, events []string) error {
+	if webhookURL == "" {
+		if len(events) > 0 {
+			return fmt.Errorf("%w: webhook_events is set without webhook_url", errInvalidWebhook)
+		}
+		return nil
+	}
+	u, err := url.Parse(webhookURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: %q is not an http or https URL", errInvalidWebhook, webhookURL)
+	}
+	for _, event := range events {
+		if !isValidStatus(event) {
+			return fmt.Errorf("%w: unknown event %q", errInvalidWebhook, event)
+		}
+	}
+	return nil
+}
+
+// webhookSubscribed checks if the task asks to be notified when it moves into the status
+func webhookSubscribed(task *TaskInfo, status string) bool {
+	if task.WebhookURL == "" {
+		return false
+	}
+	events := task.WebhookEvents
+	if len(events) == 0 {
+		events = defaultWebhookEvents
+	}
+	for _, event := range events {
+		if event == status {
+			return true
+		}
+	}
+	return false
+}
+
+// signWebhook returns the signature of a callback, which is the hex encoded
+// HMAC-SHA256 of "<timestamp>.<body>" with the secret of the tenant
+func signWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return "v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookBackoff returns the delay before retrying a delivery that has failed attempt times
+func webhookBackoff(attempt int32) time.Duration {
+	if attempt < 1 {
+		return webhookRetryBase
+	}
+	if attempt > 30 {
+		return webhookRetryMax
+	}
+	delay := webhookRetryBase << (attempt - 1)
+	if delay > webhookRetryMax {
+		return webhookRetryMax
+	}
+	return delay
+}
+
+func (server *Server) webhookMaxAttempts() int32 {
+	if server.config.WebhookMaxAttempts > 0 {
+		return int32(server.config.WebhookMaxAttempts)
+	}
+	return defaultWebhookMaxAttempts
+}
+
+// webhookSecret returns the signing secret of a tenant, or WEBHOOK_SECRET if the
+// tenant has no secret. An empty secret means the callback is not signed.
+func (server *Server) webhookSecret(ctx context.Context, userID string) (string, error) {
+	if server.database == nil || userID == "" {
+		return server.config.WebhookSecret, nil
+	}
+	secret, err := server.database.GetWebhookSecret(ctx, userID)
+	if err != nil {
+		if errors.Is(err, db.ErrRecordNotFound) {
+			return server.config.WebhookSecret, nil
+		}
+		return "", err
+	}
+	return secret.Secret, nil
+}
+
+// webhookDelivery returns the callback of a task if it has moved into a subscribed
+// status, or nil otherwise. previousStatus is empty for a new task.
+func webhookDelivery(previousStatus string, task *TaskInfo) (*db.CreateWebhookDeliveryParams, error) {
+	if task.Status == previousStatus || !webhookSubscribed(task, task.Status) {
+		return nil, nil
+	}
+	payload, err := json.Marshal(newTaskV1(task))
+	if err != nil {
+		return nil, err
+	}
+	return &db.CreateWebhookDeliveryParams{
+		TaskID:  task.ID,
+		UserID:  pgtype.Text{String: task.UserID, Valid: task.UserID != ""},
+		Url:     task.WebhookURL,
+		Event:   task.Status,
+		Payload: payload,
+	}, nil
+}
+
+// notifyWebhook posts the task info once in the background if the task has moved into
+// a subscribed status. With a database, the callback is queued by writeOutbox in the
+// transaction of the change instead, and delivered with retries by RunWebhookWorker.
+func (server *Server) notifyWebhook(previousStatus string, task *TaskInfo) {
+	delivery, err := webhookDelivery(previousStatus, task)
+	if err != nil {
+		log.Error().Msgf("failed to marshal the webhook payload of task %s: %v", task.ID, err)
+		return
+	}
+	if delivery == nil {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), server.webhookClient.Timeout)
+		defer cancel()
+		secret, _ := server.webhookSecret(ctx, delivery.UserID.String)
+		if _, err := server.postWebhook(ctx, delivery.Url, delivery.Event, "", secret, delivery.Payload); err != nil {
+			log.Error().Msgf("failed to notify the webhook of task %s: %v", delivery.TaskID, err)
+		}
+	}()
+}
+
+func (server *Server) wakeWebhookWorker() {
+	select {
+	case server.webhookWake <- struct{}{}:
+	default:
+	}
+}
+
+// postWebhook posts the payload and returns the response status code
+func (server *Server) postWebhook(
+	ctx context.Context,
+	webhookURL string,
+	event string,
+	deliveryID string,
+	secret string,
+	payload []byte,
+) (int, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(webhookEventHeaderKey, event)
+	if deliveryID != "" {
+		request.Header.Set(webhookDeliveryHeaderKey, deliveryID)
+	}
+	if secret != "" {
+		timestamp := time.Now().Unix()
+		request.Header.Set(webhookTimestampHeaderKey, strconv.FormatInt(timestamp, 10))
+		request.Header.Set(webhookSignatureHeaderKey, signWebhook(secret, timestamp, payload))
+	}
+	response, err := server.webhookClient.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return response.StatusCode, fmt.Errorf("webhook responded with status %d", response.StatusCode)
+	}
+	return response.StatusCode, nil
+}
+
+// RunWebhookWorker delivers the queued webhooks until the context is canceled.
+// Every replica can run a worker, since the deliveries are leased before sending.
+func (server *Server) RunWebhookWorker(ctx context.Context) {
+	if server.database == nil {
+		return
+	}
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+	for {
+		for {
+			count, err := server.processWebhookDeliveries(ctx)
+			if err != nil {
+				log.Error().Msgf("failed to process webhook deliveries: %v", err)
+			}
+			// Keep going while the batches are full
+			if err != nil || count < webhookBatchSize {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-server.webhookWake:
+		}
+	}
+}
+
+// processWebhookDeliveries leases a batch of due deliveries and sends them,
+// it returns the number of deliveries in the batch
+func (server *Server) processWebhookDeliveries(ctx context.Context) (int, error) {
+	// The lease must outlive an attempt, otherwise another worker may send it again
+	lease := 2*server.webhookClient.Timeout + time.Minute
+	deliveries, err := server.database.ClaimWebhookDeliveries(ctx, db.ClaimWebhookDeliveriesParams{
+		LeaseUntil: time.Now().Add(lease),
+		MaxCount:   webhookBatchSize,
+	})
+	if err != nil {
+		return 0, err
+	}
+	var wg sync.WaitGroup
+	for _, delivery := range deliveries {
+		wg.Add(1)
+		go func(delivery db.WebhookDelivery) {
+			defer wg.Done()
+			if err := server.deliverWebhook(ctx, delivery); err != nil {
+				log.Error().Msgf("failed to record webhook delivery %d: %v", delivery.ID, err)
+			}
+		}(delivery)
+	}
+	wg.Wait()
+	return len(deliveries), nil
+}
+
+// deliverWebhook makes one attempt of a delivery, records it in the delivery log,
+// and schedules the next attempt with exponential backoff if it fails
+func (server *Server) deliverWebhook(ctx context.Context, delivery db.WebhookDelivery) error {
+	attempt := delivery.Attempts + 1
+	start := time.Now()
+	secret, err := server.webhookSecret(ctx, delivery.UserID.String)
+	statusCode := 0
+	if err == nil {
+		deliveryID := strconv.FormatInt(delivery.ID, 10)
+		statusCode, err = server.postWebhook(ctx, delivery.Url, delivery.Event, deliveryID, secret, delivery.Payload)
+	}
+	duration := time.Since(start)
+
+	var errorInfo pgtype.Text
+	if err != nil {
+		errorInfo = pgtype.Text{String: err.Error(), Valid: true}
+	}
+	_, e := server.database.CreateWebhookAttempt(ctx, db.CreateWebhookAttemptParams{
+		DeliveryID: delivery.ID,
+		TaskID:     delivery.TaskID,
+		Attempt:    attempt,
+		StatusCode: pgtype.Int4{Int32: int32(statusCode), Valid: statusCode != 0},
+		Error:      errorInfo,
+		DurationMs: duration.Milliseconds(),
+	})
+	if e != nil {
+		return e
+	}
+
+	params := db.UpdateWebhookDeliveryParams{
+		ID:            delivery.ID,
+		Status:        DeliveryStatusSucceeded,
+		Attempts:      attempt,
+		NextAttemptAt: time.Now(),
+		LastError:     errorInfo,
+	}
+	if err != nil {
+		if attempt >= server.webhookMaxAttempts() {
+			params.Status = DeliveryStatusFailed
+		} else {
+			params.Status = DeliveryStatusPending
+			params.NextAttemptAt = time.Now().Add(webhookBackoff(attempt))
+		}
+	}
+	_, e = server.database.UpdateWebhookDelivery(ctx, params)
+	return e
+}
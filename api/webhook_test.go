@@ -0,0 +1,346 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	mockdb "github.com/HyperGAI/serving-webhook/db/mock"
+	db "github.com/HyperGAI/serving-webhook/db/sqlc"
+	"github.com/HyperGAI/serving-webhook/storage"
+	mockstore "github.com/HyperGAI/serving-webhook/storage/mock"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestValidateWebhook(t *testing.T) {
+	testCases := []struct {
+		name   string
+		url    string
+		events []string
+		valid  bool
+	}{
+		{name: "Empty", url: "", events: nil, valid: true},
+		{name: "Default events", url: "https://example.com/callback", events: nil, valid: true},
+		{name: "Events", url: "http://example.com", events: []string{"running", "succeeded"}, valid: true},
+		{name: "Events without URL", url: "", events: []string{"succeeded"}, valid: false},
+		{name: "Relative URL", url: "/callback", events: nil, valid: false},
+		{name: "Invalid scheme", url: "ftp://example.com", events: nil, valid: false},
+		{name: "Unknown event", url: "https://example.com", events: []string{"done"}, valid: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateWebhook(tc.url, tc.events)
+			if tc.valid {
+				require.NoError(t, err)
+			} else {
+				require.True(t, errors.Is(err, errInvalidWebhook))
+			}
+		})
+	}
+}
+
+// allowPrivateWebhooks lets the server post to the receivers of the tests on the loopback address
+func allowPrivateWebhooks(t *testing.T, server *Server) {
+	server.config.WebhookAllowPrivate = true
+	client, err := newWebhookClient(server.config)
+	require.NoError(t, err)
+	server.webhookClient = client
+}
+
+func TestWebhookClient(t *testing.T) {
+	redirected := false
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "/callback", http.StatusTemporaryRedirect)
+			return
+		}
+		redirected = true
+	}))
+	defer receiver.Close()
+
+	// The loopback address is refused by default
+	server := newTestServer(t, nil, storage.NewMemoryCache(), nil)
+	_, err := server.postWebhook(context.Background(), receiver.URL+"/callback", TaskStatusSucceeded, "", "", []byte(`{}`))
+	require.ErrorIs(t, err, errWebhookAddress)
+
+	allowPrivateWebhooks(t, server)
+	statusCode, err := server.postWebhook(context.Background(), receiver.URL+"/callback", TaskStatusSucceeded, "", "", []byte(`{}`))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, statusCode)
+
+	// The redirections are not followed
+	redirected = false
+	_, err = server.postWebhook(context.Background(), receiver.URL+"/redirect", TaskStatusSucceeded, "", "", []byte(`{}`))
+	require.ErrorIs(t, err, errWebhookRedirection)
+	require.False(t, redirected)
+}
+
+func TestIsPublicIP(t *testing.T) {
+	testCases := []struct {
+		ip     string
+		public bool
+	}{
+		{ip: "93.184.216.34", public: true},
+		{ip: "2606:2800:220:1:248:1893:25c8:1946", public: true},
+		{ip: "127.0.0.1", public: false},
+		{ip: "::1", public: false},
+		{ip: "10.0.0.1", public: false},
+		{ip: "172.16.5.4", public: false},
+		{ip: "192.168.1.1", public: false},
+		{ip: "fd00::1", public: false},
+		{ip: "169.254.169.254", public: false},
+		{ip: "fe80::1", public: false},
+		{ip: "0.0.0.0", public: false},
+		{ip: "::", public: false},
+		{ip: "::ffff:127.0.0.1", public: false},
+		{ip: "100.64.0.1", public: false},
+		{ip: "100.127.255.254", public: false},
+		{ip: "100.128.0.1", public: true},
+		{ip: "192.0.0.8", public: false},
+		{ip: "192.0.1.1", public: true},
+		{ip: "198.18.0.1", public: false},
+		{ip: "198.19.255.254", public: false},
+		{ip: "198.20.0.1", public: true},
+		{ip: "::ffff:100.64.0.1", public: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.ip, func(t *testing.T) {
+			require.Equal(t, tc.public, isPublicIP(net.ParseIP(tc.ip)))
+		})
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	type notification struct {
+		event string
+		task  TaskInfo
+	}
+	notifications := make(chan notification, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		timestamp, err := strconv.ParseInt(r.Header.Get(webhookTimestampHeaderKey), 10, 64)
+		require.NoError(t, err)
+		require.Equal(t, signWebhook("secret", timestamp, body), r.Header.Get(webhookSignatureHeaderKey))
+		var task TaskInfo
+		require.NoError(t, json.Unmarshal(body, &task))
+		notifications <- notification{event: r.Header.Get(webhookEventHeaderKey), task: task}
+	}))
+	defer receiver.Close()
+
+	server := newTestServer(t, nil, storage.NewMemoryCache(), nil)
+	allowPrivateWebhooks(t, server)
+	server.config.WebhookSecret = "secret"
+	sendRequest := func(method string, body gin.H) *httptest.ResponseRecorder {
+		data, err := json.Marshal(body)
+		require.NoError(t, err)
+		request, err := http.NewRequest(method, "/task", bytes.NewReader(data))
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		server.router.ServeHTTP(recorder, request)
+		return recorder
+	}
+	receive := func() notification {
+		select {
+		case n := <-notifications:
+			return n
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "webhook is not notified")
+		}
+		return notification{}
+	}
+
+	recorder := sendRequest(http.MethodPost, gin.H{"id": "1", "model_name": "test_model", "webhook_url": "ftp://example.com"})
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	// Notify the terminal statuses by default
+	recorder = sendRequest(http.MethodPost, gin.H{"id": "1", "model_name": "test_model", "webhook_url": receiver.URL})
+	require.Equal(t, http.StatusOK, recorder.Code)
+	recorder = sendRequest(http.MethodPut, gin.H{"id": "1", "status": TaskStatusRunning})
+	require.Equal(t, http.StatusOK, recorder.Code)
+	recorder = sendRequest(http.MethodPut, gin.H{"id": "1", "status": TaskStatusSucceeded, "outputs": gin.H{"url": "test.png"}})
+	require.Equal(t, http.StatusOK, recorder.Code)
+	n := receive()
+	require.Equal(t, TaskStatusSucceeded, n.event)
+	require.Equal(t, "1", n.task.ID)
+	require.Equal(t, map[string]interface{}{"url": "test.png"}, n.task.Outputs)
+
+	// Notify the subscribed statuses only once
+	recorder = sendRequest(http.MethodPost, gin.H{
+		"id":             "2",
+		"model_name":     "test_model",
+		"webhook_url":    receiver.URL,
+		"webhook_events": []string{TaskStatusQueued, TaskStatusRunning},
+	})
+	require.Equal(t, http.StatusOK, recorder.Code)
+	recorder = sendRequest(http.MethodPut, gin.H{"id": "2", "status": TaskStatusRunning})
+	require.Equal(t, http.StatusOK, recorder.Code)
+	recorder = sendRequest(http.MethodPut, gin.H{"id": "2", "running_time": "1s"})
+	require.Equal(t, http.StatusOK, recorder.Code)
+	recorder = sendRequest(http.MethodPut, gin.H{"id": "2", "status": TaskStatusFailed})
+	require.Equal(t, http.StatusOK, recorder.Code)
+	n = receive()
+	require.Equal(t, TaskStatusRunning, n.event)
+	require.Equal(t, "2", n.task.ID)
+	require.Equal(t, []string{TaskStatusQueued, TaskStatusRunning}, n.task.WebhookEvents)
+
+	select {
+	case n = <-notifications:
+		require.FailNow(t, "unexpected notification", "%+v", n)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestSignWebhook(t *testing.T) {
+	body := []byte(`{"id":"12345"}`)
+	signature := signWebhook("secret", 1700000000, body)
+	require.Regexp(t, "^v1=[0-9a-f]{64}$", signature)
+	require.Equal(t, signature, signWebhook("secret", 1700000000, body))
+	require.NotEqual(t, signature, signWebhook("other", 1700000000, body))
+	require.NotEqual(t, signature, signWebhook("secret", 1700000001, body))
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	require.Equal(t, 10*time.Second, webhookBackoff(1))
+	require.Equal(t, 20*time.Second, webhookBackoff(2))
+	require.Equal(t, 80*time.Second, webhookBackoff(4))
+	require.Equal(t, time.Hour, webhookBackoff(10))
+	require.Equal(t, time.Hour, webhookBackoff(100))
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	task := TaskInfo{
+		ID:         "12345",
+		UserID:     "user",
+		Status:     TaskStatusSucceeded,
+		WebhookURL: "https://example.com/callback",
+	}
+	delivery, err := webhookDelivery(TaskStatusRunning, &task)
+	require.NoError(t, err)
+	require.NotNil(t, delivery)
+	require.Equal(t, "12345", delivery.TaskID)
+	require.Equal(t, "user", delivery.UserID.String)
+	require.Equal(t, task.WebhookURL, delivery.Url)
+	require.Equal(t, TaskStatusSucceeded, delivery.Event)
+	var payload TaskInfo
+	require.NoError(t, json.Unmarshal(delivery.Payload, &payload))
+	require.Equal(t, task, payload)
+
+	// The status is unchanged or not subscribed
+	delivery, err = webhookDelivery(TaskStatusSucceeded, &task)
+	require.NoError(t, err)
+	require.Nil(t, delivery)
+	task.Status = TaskStatusRunning
+	delivery, err = webhookDelivery(TaskStatusQueued, &task)
+	require.NoError(t, err)
+	require.Nil(t, delivery)
+}
+
+func TestDeliverWebhook(t *testing.T) {
+	var statusCode int
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		timestamp, err := strconv.ParseInt(r.Header.Get(webhookTimestampHeaderKey), 10, 64)
+		require.NoError(t, err)
+		require.Equal(t, signWebhook("tenant", timestamp, body), r.Header.Get(webhookSignatureHeaderKey))
+		require.Equal(t, "7", r.Header.Get(webhookDeliveryHeaderKey))
+		w.WriteHeader(statusCode)
+	}))
+	defer receiver.Close()
+
+	delivery := db.WebhookDelivery{
+		ID:       7,
+		TaskID:   "12345",
+		UserID:   pgtype.Text{String: "user", Valid: true},
+		Url:      receiver.URL,
+		Event:    TaskStatusSucceeded,
+		Payload:  []byte(`{"id":"12345"}`),
+		Status:   DeliveryStatusPending,
+		Attempts: 2,
+	}
+
+	testCases := []struct {
+		name          string
+		statusCode    int
+		attempts      int32
+		checkDelivery func(arg db.UpdateWebhookDeliveryParams)
+	}{
+		{
+			name:       "OK",
+			statusCode: http.StatusOK,
+			attempts:   2,
+			checkDelivery: func(arg db.UpdateWebhookDeliveryParams) {
+				require.Equal(t, DeliveryStatusSucceeded, arg.Status)
+				require.Equal(t, int32(3), arg.Attempts)
+				require.False(t, arg.LastError.Valid)
+			},
+		},
+		{
+			name:       "Retry",
+			statusCode: http.StatusInternalServerError,
+			attempts:   2,
+			checkDelivery: func(arg db.UpdateWebhookDeliveryParams) {
+				require.Equal(t, DeliveryStatusPending, arg.Status)
+				require.Equal(t, int32(3), arg.Attempts)
+				require.Contains(t, arg.LastError.String, "500")
+				require.WithinDuration(t, time.Now().Add(webhookBackoff(3)), arg.NextAttemptAt, time.Second)
+			},
+		},
+		{
+			name:       "Give up",
+			statusCode: http.StatusInternalServerError,
+			attempts:   defaultWebhookMaxAttempts - 1,
+			checkDelivery: func(arg db.UpdateWebhookDeliveryParams) {
+				require.Equal(t, DeliveryStatusFailed, arg.Status)
+				require.Equal(t, int32(defaultWebhookMaxAttempts), arg.Attempts)
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			database := mockdb.NewMockStore(ctrl)
+			server := newTestServer(t, nil, mockstore.NewMockCache(ctrl), database)
+			allowPrivateWebhooks(t, server)
+			statusCode = tc.statusCode
+			d := delivery
+			d.Attempts = tc.attempts
+
+			database.EXPECT().
+				GetWebhookSecret(gomock.Any(), gomock.Eq("user")).
+				Times(1).
+				Return(db.WebhookSecret{UserID: "user", Secret: "tenant"}, nil)
+			database.EXPECT().
+				CreateWebhookAttempt(gomock.Any(), gomock.Any()).
+				Times(1).
+				DoAndReturn(func(_ interface{}, arg db.CreateWebhookAttemptParams) (db.WebhookAttempt, error) {
+					require.Equal(t, int64(7), arg.DeliveryID)
+					require.Equal(t, tc.attempts+1, arg.Attempt)
+					require.Equal(t, int32(tc.statusCode), arg.StatusCode.Int32)
+					require.Equal(t, tc.statusCode != http.StatusOK, arg.Error.Valid)
+					return db.WebhookAttempt{}, nil
+				})
+			database.EXPECT().
+				UpdateWebhookDelivery(gomock.Any(), gomock.Any()).
+				Times(1).
+				DoAndReturn(func(_ interface{}, arg db.UpdateWebhookDeliveryParams) (db.WebhookDelivery, error) {
+					require.Equal(t, int64(7), arg.ID)
+					tc.checkDelivery(arg)
+					return db.WebhookDelivery{}, nil
+				})
+			require.NoError(t, server.deliverWebhook(context.Background(), d))
+		})
+	}
+}
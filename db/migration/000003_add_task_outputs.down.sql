@@ -0,0 +1,3 @@
+ALTER TABLE "task" DROP COLUMN IF EXISTS "error_info";
+ALTER TABLE "task" DROP COLUMN IF EXISTS "outputs";
+ALTER TABLE "task" DROP COLUMN IF EXISTS "model_version";
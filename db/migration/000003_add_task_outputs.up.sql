@@ -0,0 +1,3 @@
+ALTER TABLE "task" ADD COLUMN "model_version" varchar;
+ALTER TABLE "task" ADD COLUMN "outputs" jsonb;
+ALTER TABLE "task" ADD COLUMN "error_info" varchar;
@@ -0,0 +1,2 @@
+ALTER TABLE "task" DROP COLUMN IF EXISTS "queue_id";
+ALTER TABLE "task" DROP COLUMN IF EXISTS "queue_num";
@@ -0,0 +1,2 @@
+ALTER TABLE "task" ADD COLUMN "queue_num" integer;
+ALTER TABLE "task" ADD COLUMN "queue_id" varchar;
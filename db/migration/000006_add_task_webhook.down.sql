@@ -0,0 +1,2 @@
+ALTER TABLE "task" DROP COLUMN IF EXISTS "webhook_events";
+ALTER TABLE "task" DROP COLUMN IF EXISTS "webhook_url";
@@ -0,0 +1,2 @@
+ALTER TABLE "task" ADD COLUMN "webhook_url" varchar;
+ALTER TABLE "task" ADD COLUMN "webhook_events" varchar[];
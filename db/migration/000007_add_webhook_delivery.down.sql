@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS "webhook_attempt";
+DROP TABLE IF EXISTS "webhook_delivery";
+DROP TABLE IF EXISTS "webhook_secret";
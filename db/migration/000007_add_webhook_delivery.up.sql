@@ -0,0 +1,39 @@
+CREATE TABLE "webhook_secret"
+(
+    "user_id"    varchar PRIMARY KEY,
+    "secret"     varchar     NOT NULL,
+    "created_at" timestamptz NOT NULL DEFAULT (now()),
+    "updated_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE TABLE "webhook_delivery"
+(
+    "id"              bigserial PRIMARY KEY,
+    "task_id"         varchar     NOT NULL,
+    "user_id"         varchar,
+    "url"             varchar     NOT NULL,
+    "event"           varchar     NOT NULL,
+    "payload"         jsonb       NOT NULL,
+    "status"          varchar     NOT NULL DEFAULT 'pending',
+    "attempts"        integer     NOT NULL DEFAULT 0,
+    "next_attempt_at" timestamptz NOT NULL DEFAULT (now()),
+    "last_error"      varchar,
+    "created_at"      timestamptz NOT NULL DEFAULT (now()),
+    "updated_at"      timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE TABLE "webhook_attempt"
+(
+    "id"          bigserial PRIMARY KEY,
+    "delivery_id" bigint      NOT NULL REFERENCES "webhook_delivery" ("id") ON DELETE CASCADE,
+    "task_id"     varchar     NOT NULL,
+    "attempt"     integer     NOT NULL,
+    "status_code" integer,
+    "error"       varchar,
+    "duration_ms" bigint      NOT NULL,
+    "created_at"  timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX webhook_delivery_task_index ON webhook_delivery (task_id);
+CREATE INDEX webhook_delivery_pending_index ON webhook_delivery (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX webhook_attempt_task_index ON webhook_attempt (task_id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS "task_outbox";
+ALTER TABLE "task" DROP COLUMN IF EXISTS "version";
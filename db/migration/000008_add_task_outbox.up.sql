@@ -0,0 +1,17 @@
+ALTER TABLE "task" ADD COLUMN "version" bigint NOT NULL DEFAULT 1;
+
+CREATE TABLE "task_outbox"
+(
+    "id"              bigserial PRIMARY KEY,
+    "task_id"         varchar     NOT NULL,
+    "event"           varchar     NOT NULL,
+    "task"            jsonb       NOT NULL,
+    "previous"        jsonb,
+    "attempts"        integer     NOT NULL DEFAULT 0,
+    "next_attempt_at" timestamptz NOT NULL DEFAULT (now()),
+    "processed_at"    timestamptz,
+    "created_at"      timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX task_outbox_pending_index ON task_outbox (id) WHERE processed_at IS NULL;
+CREATE INDEX task_outbox_processed_index ON task_outbox (processed_at);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS task_user_created_at_index;
+DROP INDEX IF EXISTS task_updated_at_index;
+DROP INDEX IF EXISTS task_created_at_index;
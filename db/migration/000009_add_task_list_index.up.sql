@@ -0,0 +1,3 @@
+CREATE INDEX task_created_at_index ON task (created_at, id);
+CREATE INDEX task_updated_at_index ON task (updated_at, id);
+CREATE INDEX task_user_created_at_index ON task (user_id, created_at);
@@ -0,0 +1,27 @@
+CREATE TABLE "usage_record"
+(
+    "id"            bigserial PRIMARY KEY,
+    "task_id"       varchar UNIQUE NOT NULL,
+    "user_id"       varchar        NOT NULL,
+    "model_name"    varchar        NOT NULL,
+    "model_version" varchar        NOT NULL,
+    "status"        varchar        NOT NULL,
+    "gpu_seconds"   float8         NOT NULL,
+    "completed_at"  timestamptz    NOT NULL,
+    "created_at"    timestamptz    NOT NULL DEFAULT (now())
+);
+
+CREATE TABLE "usage_daily"
+(
+    "day"           date        NOT NULL,
+    "user_id"       varchar     NOT NULL,
+    "model_name"    varchar     NOT NULL,
+    "model_version" varchar     NOT NULL,
+    "tasks"         bigint      NOT NULL,
+    "gpu_seconds"   float8      NOT NULL,
+    "updated_at"    timestamptz NOT NULL DEFAULT (now()),
+    PRIMARY KEY ("day", "user_id", "model_name", "model_version")
+);
+
+CREATE INDEX usage_record_completed_at_index ON usage_record (completed_at);
+CREATE INDEX usage_daily_user_index ON usage_daily (user_id, day);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS task_stale_index;
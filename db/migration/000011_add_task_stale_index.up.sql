@@ -0,0 +1 @@
+CREATE INDEX task_stale_index ON task (updated_at) WHERE status IN ('pending', 'running');
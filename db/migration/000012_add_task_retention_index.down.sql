@@ -0,0 +1 @@
+DROP INDEX IF EXISTS task_model_created_at_index;
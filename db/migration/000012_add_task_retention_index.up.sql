@@ -0,0 +1 @@
+CREATE INDEX task_model_created_at_index ON task (model_name, created_at);
@@ -0,0 +1,7 @@
+-- The last day whose daily usage has been fully rolled up, there is at most one row
+CREATE TABLE "usage_rollup"
+(
+    "id"            int PRIMARY KEY DEFAULT 1 CHECK ("id" = 1),
+    "rolled_up_day" date        NOT NULL,
+    "updated_at"    timestamptz NOT NULL DEFAULT (now())
+);
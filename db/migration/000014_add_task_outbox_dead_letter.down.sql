@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS task_outbox_task_index;
+ALTER TABLE "task_outbox" DROP COLUMN IF EXISTS "last_error";
+ALTER TABLE "task_outbox" DROP COLUMN IF EXISTS "failed_at";
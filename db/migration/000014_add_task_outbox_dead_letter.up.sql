@@ -0,0 +1,5 @@
+-- A change that fails to be relayed too many times is moved aside with its last error
+ALTER TABLE "task_outbox" ADD COLUMN "failed_at" timestamptz;
+ALTER TABLE "task_outbox" ADD COLUMN "last_error" varchar;
+
+CREATE INDEX task_outbox_task_index ON task_outbox (task_id, id) WHERE processed_at IS NULL AND failed_at IS NULL;
@@ -37,6 +37,66 @@ func (m *MockStore) EXPECT() *MockStoreMockRecorder {
 	return m.recorder
 }
 
+// ClaimTaskOutbox mocks base method.
+func (m *MockStore) ClaimTaskOutbox(arg0 context.Context, arg1 db.ClaimTaskOutboxParams) ([]db.TaskOutbox, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClaimTaskOutbox", arg0, arg1)
+	ret0, _ := ret[0].([]db.TaskOutbox)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ClaimTaskOutbox indicates an expected call of ClaimTaskOutbox.
+func (mr *MockStoreMockRecorder) ClaimTaskOutbox(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClaimTaskOutbox", reflect.TypeOf((*MockStore)(nil).ClaimTaskOutbox), arg0, arg1)
+}
+
+// ClaimWebhookDeliveries mocks base method.
+func (m *MockStore) ClaimWebhookDeliveries(arg0 context.Context, arg1 db.ClaimWebhookDeliveriesParams) ([]db.WebhookDelivery, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClaimWebhookDeliveries", arg0, arg1)
+	ret0, _ := ret[0].([]db.WebhookDelivery)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ClaimWebhookDeliveries indicates an expected call of ClaimWebhookDeliveries.
+func (mr *MockStoreMockRecorder) ClaimWebhookDeliveries(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClaimWebhookDeliveries", reflect.TypeOf((*MockStore)(nil).ClaimWebhookDeliveries), arg0, arg1)
+}
+
+// CountTasksByStatus mocks base method.
+func (m *MockStore) CountTasksByStatus(arg0 context.Context, arg1 db.CountTasksByStatusParams) ([]db.CountTasksByStatusRow, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountTasksByStatus", arg0, arg1)
+	ret0, _ := ret[0].([]db.CountTasksByStatusRow)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountTasksByStatus indicates an expected call of CountTasksByStatus.
+func (mr *MockStoreMockRecorder) CountTasksByStatus(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountTasksByStatus", reflect.TypeOf((*MockStore)(nil).CountTasksByStatus), arg0, arg1)
+}
+
+// CountTasksByUser mocks base method.
+func (m *MockStore) CountTasksByUser(arg0 context.Context, arg1 pgtype.Text) ([]db.CountTasksByUserRow, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountTasksByUser", arg0, arg1)
+	ret0, _ := ret[0].([]db.CountTasksByUserRow)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountTasksByUser indicates an expected call of CountTasksByUser.
+func (mr *MockStoreMockRecorder) CountTasksByUser(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountTasksByUser", reflect.TypeOf((*MockStore)(nil).CountTasksByUser), arg0, arg1)
+}
+
 // CreateTask mocks base method.
 func (m *MockStore) CreateTask(arg0 context.Context, arg1 db.CreateTaskParams) (db.Task, error) {
 	m.ctrl.T.Helper()
@@ -52,6 +112,79 @@ func (mr *MockStoreMockRecorder) CreateTask(arg0, arg1 interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateTask", reflect.TypeOf((*MockStore)(nil).CreateTask), arg0, arg1)
 }
 
+// CreateTaskOutbox mocks base method.
+func (m *MockStore) CreateTaskOutbox(arg0 context.Context, arg1 db.CreateTaskOutboxParams) (db.TaskOutbox, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateTaskOutbox", arg0, arg1)
+	ret0, _ := ret[0].(db.TaskOutbox)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateTaskOutbox indicates an expected call of CreateTaskOutbox.
+func (mr *MockStoreMockRecorder) CreateTaskOutbox(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateTaskOutbox", reflect.TypeOf((*MockStore)(nil).CreateTaskOutbox), arg0, arg1)
+}
+
+// CreateUsageRecord mocks base method.
+func (m *MockStore) CreateUsageRecord(arg0 context.Context, arg1 db.CreateUsageRecordParams) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateUsageRecord", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateUsageRecord indicates an expected call of CreateUsageRecord.
+func (mr *MockStoreMockRecorder) CreateUsageRecord(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUsageRecord", reflect.TypeOf((*MockStore)(nil).CreateUsageRecord), arg0, arg1)
+}
+
+// CreateWebhookAttempt mocks base method.
+func (m *MockStore) CreateWebhookAttempt(arg0 context.Context, arg1 db.CreateWebhookAttemptParams) (db.WebhookAttempt, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateWebhookAttempt", arg0, arg1)
+	ret0, _ := ret[0].(db.WebhookAttempt)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateWebhookAttempt indicates an expected call of CreateWebhookAttempt.
+func (mr *MockStoreMockRecorder) CreateWebhookAttempt(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateWebhookAttempt", reflect.TypeOf((*MockStore)(nil).CreateWebhookAttempt), arg0, arg1)
+}
+
+// CreateWebhookDelivery mocks base method.
+func (m *MockStore) CreateWebhookDelivery(arg0 context.Context, arg1 db.CreateWebhookDeliveryParams) (db.WebhookDelivery, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateWebhookDelivery", arg0, arg1)
+	ret0, _ := ret[0].(db.WebhookDelivery)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateWebhookDelivery indicates an expected call of CreateWebhookDelivery.
+func (mr *MockStoreMockRecorder) CreateWebhookDelivery(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateWebhookDelivery", reflect.TypeOf((*MockStore)(nil).CreateWebhookDelivery), arg0, arg1)
+}
+
+// DeleteProcessedTaskOutbox mocks base method.
+func (m *MockStore) DeleteProcessedTaskOutbox(arg0 context.Context, arg1 pgtype.Timestamptz) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteProcessedTaskOutbox", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteProcessedTaskOutbox indicates an expected call of DeleteProcessedTaskOutbox.
+func (mr *MockStoreMockRecorder) DeleteProcessedTaskOutbox(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteProcessedTaskOutbox", reflect.TypeOf((*MockStore)(nil).DeleteProcessedTaskOutbox), arg0, arg1)
+}
+
 // DeleteTask mocks base method.
 func (m *MockStore) DeleteTask(arg0 context.Context, arg1 string) error {
 	m.ctrl.T.Helper()
@@ -67,11 +200,12 @@ func (mr *MockStoreMockRecorder) DeleteTask(arg0, arg1 interface{}) *gomock.Call
 }
 
 // DeleteTaskBeforeDate mocks base method.
-func (m *MockStore) DeleteTaskBeforeDate(arg0 context.Context, arg1 time.Time) error {
+func (m *MockStore) DeleteTaskBeforeDate(arg0 context.Context, arg1 db.DeleteTaskBeforeDateParams) (int64, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "DeleteTaskBeforeDate", arg0, arg1)
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // DeleteTaskBeforeDate indicates an expected call of DeleteTaskBeforeDate.
@@ -94,6 +228,36 @@ func (mr *MockStoreMockRecorder) ExecTx(arg0, arg1 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExecTx", reflect.TypeOf((*MockStore)(nil).ExecTx), arg0, arg1)
 }
 
+// FailTaskOutbox mocks base method.
+func (m *MockStore) FailTaskOutbox(arg0 context.Context, arg1 db.FailTaskOutboxParams) (db.TaskOutbox, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FailTaskOutbox", arg0, arg1)
+	ret0, _ := ret[0].(db.TaskOutbox)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FailTaskOutbox indicates an expected call of FailTaskOutbox.
+func (mr *MockStoreMockRecorder) FailTaskOutbox(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FailTaskOutbox", reflect.TypeOf((*MockStore)(nil).FailTaskOutbox), arg0, arg1)
+}
+
+// GetModelStats mocks base method.
+func (m *MockStore) GetModelStats(arg0 context.Context, arg1 db.GetModelStatsParams) ([]db.GetModelStatsRow, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetModelStats", arg0, arg1)
+	ret0, _ := ret[0].([]db.GetModelStatsRow)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetModelStats indicates an expected call of GetModelStats.
+func (mr *MockStoreMockRecorder) GetModelStats(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetModelStats", reflect.TypeOf((*MockStore)(nil).GetModelStats), arg0, arg1)
+}
+
 // GetTaskById mocks base method.
 func (m *MockStore) GetTaskById(arg0 context.Context, arg1 string) (db.Task, error) {
 	m.ctrl.T.Helper()
@@ -109,34 +273,198 @@ func (mr *MockStoreMockRecorder) GetTaskById(arg0, arg1 interface{}) *gomock.Cal
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTaskById", reflect.TypeOf((*MockStore)(nil).GetTaskById), arg0, arg1)
 }
 
-// GetTaskByUser mocks base method.
-func (m *MockStore) GetTaskByUser(arg0 context.Context, arg1 pgtype.Text) ([]db.Task, error) {
+// GetUsageRollupDay mocks base method.
+func (m *MockStore) GetUsageRollupDay(arg0 context.Context) (pgtype.Date, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUsageRollupDay", arg0)
+	ret0, _ := ret[0].(pgtype.Date)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUsageRollupDay indicates an expected call of GetUsageRollupDay.
+func (mr *MockStoreMockRecorder) GetUsageRollupDay(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUsageRollupDay", reflect.TypeOf((*MockStore)(nil).GetUsageRollupDay), arg0)
+}
+
+// GetUserStats mocks base method.
+func (m *MockStore) GetUserStats(arg0 context.Context, arg1 db.GetUserStatsParams) ([]db.GetUserStatsRow, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserStats", arg0, arg1)
+	ret0, _ := ret[0].([]db.GetUserStatsRow)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserStats indicates an expected call of GetUserStats.
+func (mr *MockStoreMockRecorder) GetUserStats(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserStats", reflect.TypeOf((*MockStore)(nil).GetUserStats), arg0, arg1)
+}
+
+// GetWebhookDelivery mocks base method.
+func (m *MockStore) GetWebhookDelivery(arg0 context.Context, arg1 int64) (db.WebhookDelivery, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetWebhookDelivery", arg0, arg1)
+	ret0, _ := ret[0].(db.WebhookDelivery)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetWebhookDelivery indicates an expected call of GetWebhookDelivery.
+func (mr *MockStoreMockRecorder) GetWebhookDelivery(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWebhookDelivery", reflect.TypeOf((*MockStore)(nil).GetWebhookDelivery), arg0, arg1)
+}
+
+// GetWebhookSecret mocks base method.
+func (m *MockStore) GetWebhookSecret(arg0 context.Context, arg1 string) (db.WebhookSecret, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetWebhookSecret", arg0, arg1)
+	ret0, _ := ret[0].(db.WebhookSecret)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetWebhookSecret indicates an expected call of GetWebhookSecret.
+func (mr *MockStoreMockRecorder) GetWebhookSecret(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWebhookSecret", reflect.TypeOf((*MockStore)(nil).GetWebhookSecret), arg0, arg1)
+}
+
+// ListDailyUsage mocks base method.
+func (m *MockStore) ListDailyUsage(arg0 context.Context, arg1 db.ListDailyUsageParams) ([]db.UsageDaily, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListDailyUsage", arg0, arg1)
+	ret0, _ := ret[0].([]db.UsageDaily)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListDailyUsage indicates an expected call of ListDailyUsage.
+func (mr *MockStoreMockRecorder) ListDailyUsage(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListDailyUsage", reflect.TypeOf((*MockStore)(nil).ListDailyUsage), arg0, arg1)
+}
+
+// ListExpiredTaskModels mocks base method.
+func (m *MockStore) ListExpiredTaskModels(arg0 context.Context, arg1 time.Time) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListExpiredTaskModels", arg0, arg1)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListExpiredTaskModels indicates an expected call of ListExpiredTaskModels.
+func (mr *MockStoreMockRecorder) ListExpiredTaskModels(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListExpiredTaskModels", reflect.TypeOf((*MockStore)(nil).ListExpiredTaskModels), arg0, arg1)
+}
+
+// ListStaleTasks mocks base method.
+func (m *MockStore) ListStaleTasks(arg0 context.Context, arg1 db.ListStaleTasksParams) ([]db.Task, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetTaskByUser", arg0, arg1)
+	ret := m.ctrl.Call(m, "ListStaleTasks", arg0, arg1)
 	ret0, _ := ret[0].([]db.Task)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// GetTaskByUser indicates an expected call of GetTaskByUser.
-func (mr *MockStoreMockRecorder) GetTaskByUser(arg0, arg1 interface{}) *gomock.Call {
+// ListStaleTasks indicates an expected call of ListStaleTasks.
+func (mr *MockStoreMockRecorder) ListStaleTasks(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTaskByUser", reflect.TypeOf((*MockStore)(nil).GetTaskByUser), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListStaleTasks", reflect.TypeOf((*MockStore)(nil).ListStaleTasks), arg0, arg1)
 }
 
-// GetTasksByModelNameAndStatus mocks base method.
-func (m *MockStore) GetTasksByModelNameAndStatus(arg0 context.Context, arg1 db.GetTasksByModelNameAndStatusParams) ([]db.Task, error) {
+// ListTasks mocks base method.
+func (m *MockStore) ListTasks(arg0 context.Context, arg1 db.ListTasksParams) ([]db.Task, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetTasksByModelNameAndStatus", arg0, arg1)
+	ret := m.ctrl.Call(m, "ListTasks", arg0, arg1)
 	ret0, _ := ret[0].([]db.Task)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// GetTasksByModelNameAndStatus indicates an expected call of GetTasksByModelNameAndStatus.
-func (mr *MockStoreMockRecorder) GetTasksByModelNameAndStatus(arg0, arg1 interface{}) *gomock.Call {
+// ListTasks indicates an expected call of ListTasks.
+func (mr *MockStoreMockRecorder) ListTasks(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTasksByModelNameAndStatus", reflect.TypeOf((*MockStore)(nil).GetTasksByModelNameAndStatus), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListTasks", reflect.TypeOf((*MockStore)(nil).ListTasks), arg0, arg1)
+}
+
+// ListTasksBeforeDate mocks base method.
+func (m *MockStore) ListTasksBeforeDate(arg0 context.Context, arg1 db.ListTasksBeforeDateParams) ([]db.Task, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListTasksBeforeDate", arg0, arg1)
+	ret0, _ := ret[0].([]db.Task)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListTasksBeforeDate indicates an expected call of ListTasksBeforeDate.
+func (mr *MockStoreMockRecorder) ListTasksBeforeDate(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListTasksBeforeDate", reflect.TypeOf((*MockStore)(nil).ListTasksBeforeDate), arg0, arg1)
+}
+
+// ListTasksUpdatedSince mocks base method.
+func (m *MockStore) ListTasksUpdatedSince(arg0 context.Context, arg1 db.ListTasksUpdatedSinceParams) ([]db.Task, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListTasksUpdatedSince", arg0, arg1)
+	ret0, _ := ret[0].([]db.Task)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListTasksUpdatedSince indicates an expected call of ListTasksUpdatedSince.
+func (mr *MockStoreMockRecorder) ListTasksUpdatedSince(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListTasksUpdatedSince", reflect.TypeOf((*MockStore)(nil).ListTasksUpdatedSince), arg0, arg1)
+}
+
+// ListWebhookAttemptsByTask mocks base method.
+func (m *MockStore) ListWebhookAttemptsByTask(arg0 context.Context, arg1 string) ([]db.WebhookAttempt, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListWebhookAttemptsByTask", arg0, arg1)
+	ret0, _ := ret[0].([]db.WebhookAttempt)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListWebhookAttemptsByTask indicates an expected call of ListWebhookAttemptsByTask.
+func (mr *MockStoreMockRecorder) ListWebhookAttemptsByTask(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListWebhookAttemptsByTask", reflect.TypeOf((*MockStore)(nil).ListWebhookAttemptsByTask), arg0, arg1)
+}
+
+// ListWebhookDeliveriesByTask mocks base method.
+func (m *MockStore) ListWebhookDeliveriesByTask(arg0 context.Context, arg1 string) ([]db.WebhookDelivery, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListWebhookDeliveriesByTask", arg0, arg1)
+	ret0, _ := ret[0].([]db.WebhookDelivery)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListWebhookDeliveriesByTask indicates an expected call of ListWebhookDeliveriesByTask.
+func (mr *MockStoreMockRecorder) ListWebhookDeliveriesByTask(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListWebhookDeliveriesByTask", reflect.TypeOf((*MockStore)(nil).ListWebhookDeliveriesByTask), arg0, arg1)
+}
+
+// MarkTaskOutboxProcessed mocks base method.
+func (m *MockStore) MarkTaskOutboxProcessed(arg0 context.Context, arg1 int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkTaskOutboxProcessed", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkTaskOutboxProcessed indicates an expected call of MarkTaskOutboxProcessed.
+func (mr *MockStoreMockRecorder) MarkTaskOutboxProcessed(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkTaskOutboxProcessed", reflect.TypeOf((*MockStore)(nil).MarkTaskOutboxProcessed), arg0, arg1)
 }
 
 // Ping mocks base method.
@@ -153,6 +481,34 @@ func (mr *MockStoreMockRecorder) Ping(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ping", reflect.TypeOf((*MockStore)(nil).Ping), arg0)
 }
 
+// RollupUsage mocks base method.
+func (m *MockStore) RollupUsage(arg0 context.Context, arg1 time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RollupUsage", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RollupUsage indicates an expected call of RollupUsage.
+func (mr *MockStoreMockRecorder) RollupUsage(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RollupUsage", reflect.TypeOf((*MockStore)(nil).RollupUsage), arg0, arg1)
+}
+
+// SetUsageRollupDay mocks base method.
+func (m *MockStore) SetUsageRollupDay(arg0 context.Context, arg1 pgtype.Date) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetUsageRollupDay", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetUsageRollupDay indicates an expected call of SetUsageRollupDay.
+func (mr *MockStoreMockRecorder) SetUsageRollupDay(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetUsageRollupDay", reflect.TypeOf((*MockStore)(nil).SetUsageRollupDay), arg0, arg1)
+}
+
 // UpdateTask mocks base method.
 func (m *MockStore) UpdateTask(arg0 context.Context, arg1 db.UpdateTaskParams) (db.Task, error) {
 	m.ctrl.T.Helper()
@@ -167,3 +523,33 @@ func (mr *MockStoreMockRecorder) UpdateTask(arg0, arg1 interface{}) *gomock.Call
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateTask", reflect.TypeOf((*MockStore)(nil).UpdateTask), arg0, arg1)
 }
+
+// UpdateWebhookDelivery mocks base method.
+func (m *MockStore) UpdateWebhookDelivery(arg0 context.Context, arg1 db.UpdateWebhookDeliveryParams) (db.WebhookDelivery, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateWebhookDelivery", arg0, arg1)
+	ret0, _ := ret[0].(db.WebhookDelivery)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateWebhookDelivery indicates an expected call of UpdateWebhookDelivery.
+func (mr *MockStoreMockRecorder) UpdateWebhookDelivery(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateWebhookDelivery", reflect.TypeOf((*MockStore)(nil).UpdateWebhookDelivery), arg0, arg1)
+}
+
+// UpsertWebhookSecret mocks base method.
+func (m *MockStore) UpsertWebhookSecret(arg0 context.Context, arg1 db.UpsertWebhookSecretParams) (db.WebhookSecret, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpsertWebhookSecret", arg0, arg1)
+	ret0, _ := ret[0].(db.WebhookSecret)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpsertWebhookSecret indicates an expected call of UpsertWebhookSecret.
+func (mr *MockStoreMockRecorder) UpsertWebhookSecret(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpsertWebhookSecret", reflect.TypeOf((*MockStore)(nil).UpsertWebhookSecret), arg0, arg1)
+}
@@ -0,0 +1,48 @@
+-- name: CreateTaskOutbox :one
+INSERT INTO "task_outbox" (task_id,
+                           event,
+                           task,
+                           previous)
+VALUES ($1, $2, $3, $4)
+RETURNING *;
+
+-- name: ClaimTaskOutbox :many
+-- Lease the pending changes by moving next_attempt_at forward, so that
+-- other replicas skip them while they are being relayed. A change is only
+-- claimed after the earlier changes of its task, to relay them in order.
+UPDATE "task_outbox"
+SET next_attempt_at = sqlc.arg(lease_until)
+WHERE id IN (SELECT t.id
+             FROM "task_outbox" t
+             WHERE t.processed_at IS NULL
+               AND t.failed_at IS NULL
+               AND t.next_attempt_at <= now()
+               AND NOT EXISTS (SELECT 1
+                               FROM "task_outbox" o
+                               WHERE o.task_id = t.task_id
+                                 AND o.processed_at IS NULL
+                                 AND o.failed_at IS NULL
+                                 AND o.id < t.id)
+             ORDER BY t.id
+             LIMIT sqlc.arg(max_count) FOR UPDATE SKIP LOCKED)
+RETURNING *;
+
+-- name: MarkTaskOutboxProcessed :exec
+UPDATE "task_outbox"
+SET processed_at = now()
+WHERE id = $1;
+
+-- name: FailTaskOutbox :one
+-- Count a failed relay, and move the change aside after max_attempts,
+-- which lets the later changes of its task go ahead
+UPDATE "task_outbox"
+SET attempts   = attempts + 1,
+    last_error = sqlc.arg(last_error),
+    failed_at  = CASE WHEN attempts + 1 >= sqlc.arg(max_attempts)::integer THEN now() END
+WHERE id = sqlc.arg(id)
+RETURNING *;
+
+-- name: DeleteProcessedTaskOutbox :exec
+DELETE
+FROM "task_outbox"
+WHERE processed_at < $1;
@@ -0,0 +1,39 @@
+-- name: CountTasksByStatus :many
+SELECT status, count(*) AS count
+FROM "task"
+WHERE created_at >= sqlc.arg(since)
+  AND created_at < sqlc.arg(until)
+  AND (sqlc.narg(model_name)::varchar IS NULL OR model_name = sqlc.narg(model_name))
+GROUP BY status;
+
+-- name: GetModelStats :many
+-- The percentiles are over the running time of the succeeded tasks
+SELECT model_name,
+       count(*)                                                          AS total,
+       count(*) FILTER (WHERE status = 'succeeded')                      AS succeeded,
+       count(*) FILTER (WHERE status IN ('failed', 'timed_out'))         AS failed,
+       COALESCE(percentile_cont(0.5) WITHIN GROUP (ORDER BY running_time)
+                FILTER (WHERE status = 'succeeded'), 0)::float8          AS p50,
+       COALESCE(percentile_cont(0.95) WITHIN GROUP (ORDER BY running_time)
+                FILTER (WHERE status = 'succeeded'), 0)::float8          AS p95,
+       COALESCE(percentile_cont(0.99) WITHIN GROUP (ORDER BY running_time)
+                FILTER (WHERE status = 'succeeded'), 0)::float8          AS p99
+FROM "task"
+WHERE created_at >= sqlc.arg(since)
+  AND created_at < sqlc.arg(until)
+  AND (sqlc.narg(model_name)::varchar IS NULL OR model_name = sqlc.narg(model_name))
+GROUP BY model_name
+ORDER BY model_name;
+
+-- name: GetUserStats :many
+SELECT COALESCE(user_id, '')::varchar                AS user_id,
+       count(*)                                     AS total,
+       count(*) FILTER (WHERE status = 'succeeded') AS succeeded,
+       COALESCE(sum(running_time), 0)::float8       AS running_time
+FROM "task"
+WHERE created_at >= sqlc.arg(since)
+  AND created_at < sqlc.arg(until)
+  AND (sqlc.narg(model_name)::varchar IS NULL OR model_name = sqlc.narg(model_name))
+GROUP BY user_id
+ORDER BY running_time DESC, user_id
+LIMIT sqlc.arg(max_count);
@@ -2,9 +2,13 @@
 INSERT INTO "task" (task_id,
                     user_id,
                     model_name,
+                    model_version,
                     running_time,
-                    status)
-VALUES ($1, $2, $3, $4, $5)
+                    status,
+                    queue_num,
+                    webhook_url,
+                    webhook_events)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 RETURNING *;
 
 -- name: GetTaskById :one
@@ -13,23 +17,42 @@ FROM "task"
 WHERE task_id = $1
 LIMIT 1;
 
--- name: GetTaskByUser :many
+-- name: CountTasksByUser :many
+SELECT status, count(*) AS count
+FROM "task"
+WHERE user_id = $1
+GROUP BY status;
+
+-- name: ListTasksUpdatedSince :many
 SELECT *
 FROM "task"
-WHERE user_id = $1;
+WHERE updated_at >= sqlc.arg(updated_since)
+  AND id > sqlc.arg(after_id)
+ORDER BY id
+LIMIT sqlc.arg(max_count);
 
--- name: GetTasksByModelNameAndStatus :many
+-- name: ListStaleTasks :many
+-- The tasks in one of the statuses without an update since the given time
 SELECT *
 FROM "task"
-WHERE model_name = $1
-  AND status = $2;
+WHERE status = ANY (sqlc.arg(statuses)::varchar[])
+  AND updated_at < sqlc.arg(updated_before)
+  AND id > sqlc.arg(after_id)
+ORDER BY id
+LIMIT sqlc.arg(max_count);
 
 -- name: UpdateTask :one
 UPDATE "task"
 SET running_time = COALESCE(sqlc.narg(running_time), running_time),
     status       = COALESCE(sqlc.narg(status), status),
-    updated_at   = COALESCE(sqlc.narg(updated_at), updated_at)
+    outputs      = COALESCE(sqlc.narg(outputs), outputs),
+    error_info   = COALESCE(sqlc.narg(error_info), error_info),
+    queue_id     = COALESCE(sqlc.narg(queue_id), queue_id),
+    canceled_by  = COALESCE(sqlc.narg(canceled_by), canceled_by),
+    updated_at   = COALESCE(sqlc.narg(updated_at), updated_at),
+    version      = COALESCE(sqlc.narg(version), version)
 WHERE task_id = sqlc.arg(task_id)
+  AND (sqlc.narg(expected_version)::bigint IS NULL OR version = sqlc.narg(expected_version))
 RETURNING *;
 
 -- name: DeleteTask :exec
@@ -37,7 +60,44 @@ DELETE
 FROM "task"
 WHERE task_id = $1;
 
--- name: DeleteTaskBeforeDate :exec
-DELETE
+-- name: ListExpiredTaskModels :many
+-- The models with tasks created before the given time
+SELECT DISTINCT model_name
 FROM "task"
-WHERE created_at < $1;
+WHERE created_at < sqlc.arg(created_before)
+ORDER BY model_name;
+
+-- name: ListTasksBeforeDate :many
+-- List the tasks of a model in the given statuses, i.e., the terminal ones,
+-- created before the given time
+SELECT *
+FROM "task"
+WHERE model_name = sqlc.arg(model_name)
+  AND created_at < sqlc.arg(created_before)
+  AND status = ANY (sqlc.arg(statuses)::varchar[])
+  AND id > sqlc.arg(after_id)
+ORDER BY id
+LIMIT sqlc.arg(max_count);
+
+-- name: DeleteTaskBeforeDate :one
+-- Delete a batch of tasks returned by ListTasksBeforeDate together with their
+-- webhook deliveries (and attempts by cascade) and outbox changes, and count the
+-- deleted tasks. A task that has moved out of the statuses meanwhile is kept.
+WITH deleted AS (
+    DELETE
+    FROM "task" t
+    WHERE t.model_name = sqlc.arg(model_name)
+      AND t.created_at < sqlc.arg(created_before)
+      AND t.status = ANY (sqlc.arg(statuses)::varchar[])
+      AND t.id = ANY (sqlc.arg(ids)::bigint[])
+    RETURNING t.task_id),
+     deliveries AS (
+         DELETE
+         FROM "webhook_delivery"
+         WHERE task_id IN (SELECT task_id FROM deleted)),
+     outbox AS (
+         DELETE
+         FROM "task_outbox"
+         WHERE task_id IN (SELECT task_id FROM deleted))
+SELECT count(*)
+FROM deleted;
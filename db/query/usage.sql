@@ -0,0 +1,49 @@
+-- name: CreateUsageRecord :exec
+-- A task is only billed once, even if its terminal update is retried
+INSERT INTO "usage_record" (task_id,
+                            user_id,
+                            model_name,
+                            model_version,
+                            status,
+                            gpu_seconds,
+                            completed_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+ON CONFLICT (task_id) DO NOTHING;
+
+-- name: RollupUsage :exec
+-- Recompute the daily usage (in UTC) of the records completed since the given day
+INSERT INTO "usage_daily" (day, user_id, model_name, model_version, tasks, gpu_seconds)
+SELECT (completed_at AT TIME ZONE 'UTC')::date AS day,
+       user_id,
+       model_name,
+       model_version,
+       count(*),
+       sum(gpu_seconds)
+FROM "usage_record"
+WHERE completed_at >= sqlc.arg(since)
+GROUP BY 1, user_id, model_name, model_version
+ON CONFLICT (day, user_id, model_name, model_version) DO UPDATE
+    SET tasks       = EXCLUDED.tasks,
+        gpu_seconds = EXCLUDED.gpu_seconds,
+        updated_at  = now();
+
+-- name: GetUsageRollupDay :one
+SELECT rolled_up_day
+FROM "usage_rollup"
+WHERE id = 1;
+
+-- name: SetUsageRollupDay :exec
+-- The watermark only moves forward
+INSERT INTO "usage_rollup" (id, rolled_up_day)
+VALUES (1, $1)
+ON CONFLICT (id) DO UPDATE
+    SET rolled_up_day = GREATEST("usage_rollup".rolled_up_day, EXCLUDED.rolled_up_day),
+        updated_at    = now();
+
+-- name: ListDailyUsage :many
+SELECT *
+FROM "usage_daily"
+WHERE day >= sqlc.arg(from_day)
+  AND day < sqlc.arg(to_day)
+  AND (sqlc.narg(user_id)::varchar IS NULL OR user_id = sqlc.narg(user_id))
+ORDER BY user_id, day, model_name, model_version;
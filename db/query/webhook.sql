@@ -0,0 +1,74 @@
+-- name: GetWebhookSecret :one
+SELECT *
+FROM "webhook_secret"
+WHERE user_id = $1
+LIMIT 1;
+
+-- name: UpsertWebhookSecret :one
+INSERT INTO "webhook_secret" (user_id, secret)
+VALUES ($1, $2)
+ON CONFLICT (user_id) DO UPDATE
+    SET secret     = EXCLUDED.secret,
+        updated_at = now()
+RETURNING *;
+
+-- name: CreateWebhookDelivery :one
+INSERT INTO "webhook_delivery" (task_id,
+                                user_id,
+                                url,
+                                event,
+                                payload)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING *;
+
+-- name: GetWebhookDelivery :one
+SELECT *
+FROM "webhook_delivery"
+WHERE id = $1
+LIMIT 1;
+
+-- name: ListWebhookDeliveriesByTask :many
+SELECT *
+FROM "webhook_delivery"
+WHERE task_id = $1
+ORDER BY id;
+
+-- name: ClaimWebhookDeliveries :many
+-- Lease the due deliveries by moving next_attempt_at forward, so that
+-- other replicas skip them while they are being delivered
+UPDATE "webhook_delivery"
+SET next_attempt_at = sqlc.arg(lease_until),
+    updated_at      = now()
+WHERE id IN (SELECT id
+             FROM "webhook_delivery"
+             WHERE status = 'pending'
+               AND next_attempt_at <= now()
+             ORDER BY next_attempt_at
+             LIMIT sqlc.arg(max_count) FOR UPDATE SKIP LOCKED)
+RETURNING *;
+
+-- name: UpdateWebhookDelivery :one
+UPDATE "webhook_delivery"
+SET status          = $2,
+    attempts        = $3,
+    next_attempt_at = $4,
+    last_error      = $5,
+    updated_at      = now()
+WHERE id = $1
+RETURNING *;
+
+-- name: CreateWebhookAttempt :one
+INSERT INTO "webhook_attempt" (delivery_id,
+                               task_id,
+                               attempt,
+                               status_code,
+                               error,
+                               duration_ms)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING *;
+
+-- name: ListWebhookAttemptsByTask :many
+SELECT *
+FROM "webhook_attempt"
+WHERE task_id = $1
+ORDER BY id;
@@ -11,12 +11,96 @@ import (
 )
 
 type Task struct {
-	ID          int64         `json:"id"`
-	TaskID      string        `json:"task_id"`
-	UserID      pgtype.Text   `json:"user_id"`
-	ModelName   string        `json:"model_name"`
-	CreatedAt   time.Time     `json:"created_at"`
-	UpdatedAt   time.Time     `json:"updated_at"`
-	RunningTime pgtype.Float8 `json:"running_time"`
-	Status      pgtype.Text   `json:"status"`
+	ID            int64         `json:"id"`
+	TaskID        string        `json:"task_id"`
+	UserID        pgtype.Text   `json:"user_id"`
+	ModelName     string        `json:"model_name"`
+	CreatedAt     time.Time     `json:"created_at"`
+	UpdatedAt     time.Time     `json:"updated_at"`
+	RunningTime   pgtype.Float8 `json:"running_time"`
+	Status        pgtype.Text   `json:"status"`
+	ModelVersion  pgtype.Text   `json:"model_version"`
+	Outputs       []byte        `json:"outputs"`
+	ErrorInfo     pgtype.Text   `json:"error_info"`
+	QueueNum      pgtype.Int4   `json:"queue_num"`
+	QueueID       pgtype.Text   `json:"queue_id"`
+	CanceledBy    pgtype.Text   `json:"canceled_by"`
+	WebhookUrl    pgtype.Text   `json:"webhook_url"`
+	WebhookEvents []string      `json:"webhook_events"`
+	Version       int64         `json:"version"`
+}
+
+type TaskOutbox struct {
+	ID            int64              `json:"id"`
+	TaskID        string             `json:"task_id"`
+	Event         string             `json:"event"`
+	Task          []byte             `json:"task"`
+	Previous      []byte             `json:"previous"`
+	Attempts      int32              `json:"attempts"`
+	NextAttemptAt time.Time          `json:"next_attempt_at"`
+	ProcessedAt   pgtype.Timestamptz `json:"processed_at"`
+	CreatedAt     time.Time          `json:"created_at"`
+	FailedAt      pgtype.Timestamptz `json:"failed_at"`
+	LastError     pgtype.Text        `json:"last_error"`
+}
+
+type UsageDaily struct {
+	Day          pgtype.Date `json:"day"`
+	UserID       string      `json:"user_id"`
+	ModelName    string      `json:"model_name"`
+	ModelVersion string      `json:"model_version"`
+	Tasks        int64       `json:"tasks"`
+	GpuSeconds   float64     `json:"gpu_seconds"`
+	UpdatedAt    time.Time   `json:"updated_at"`
+}
+
+type UsageRecord struct {
+	ID           int64     `json:"id"`
+	TaskID       string    `json:"task_id"`
+	UserID       string    `json:"user_id"`
+	ModelName    string    `json:"model_name"`
+	ModelVersion string    `json:"model_version"`
+	Status       string    `json:"status"`
+	GpuSeconds   float64   `json:"gpu_seconds"`
+	CompletedAt  time.Time `json:"completed_at"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type UsageRollup struct {
+	ID          int32       `json:"id"`
+	RolledUpDay pgtype.Date `json:"rolled_up_day"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+}
+
+type WebhookAttempt struct {
+	ID         int64       `json:"id"`
+	DeliveryID int64       `json:"delivery_id"`
+	TaskID     string      `json:"task_id"`
+	Attempt    int32       `json:"attempt"`
+	StatusCode pgtype.Int4 `json:"status_code"`
+	Error      pgtype.Text `json:"error"`
+	DurationMs int64       `json:"duration_ms"`
+	CreatedAt  time.Time   `json:"created_at"`
+}
+
+type WebhookDelivery struct {
+	ID            int64       `json:"id"`
+	TaskID        string      `json:"task_id"`
+	UserID        pgtype.Text `json:"user_id"`
+	Url           string      `json:"url"`
+	Event         string      `json:"event"`
+	Payload       []byte      `json:"payload"`
+	Status        string      `json:"status"`
+	Attempts      int32       `json:"attempts"`
+	NextAttemptAt time.Time   `json:"next_attempt_at"`
+	LastError     pgtype.Text `json:"last_error"`
+	CreatedAt     time.Time   `json:"created_at"`
+	UpdatedAt     time.Time   `json:"updated_at"`
+}
+
+type WebhookSecret struct {
+	UserID    string    `json:"user_id"`
+	Secret    string    `json:"secret"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
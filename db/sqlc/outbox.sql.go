@@ -0,0 +1,170 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.25.0
+// source: outbox.sql
+
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const claimTaskOutbox = `-- name: ClaimTaskOutbox :many
+UPDATE "task_outbox"
+SET next_attempt_at = $1
+WHERE id IN (SELECT t.id
+             FROM "task_outbox" t
+             WHERE t.processed_at IS NULL
+               AND t.failed_at IS NULL
+               AND t.next_attempt_at <= now()
+               AND NOT EXISTS (SELECT 1
+                               FROM "task_outbox" o
+                               WHERE o.task_id = t.task_id
+                                 AND o.processed_at IS NULL
+                                 AND o.failed_at IS NULL
+                                 AND o.id < t.id)
+             ORDER BY t.id
+             LIMIT $2 FOR UPDATE SKIP LOCKED)
+RETURNING id, task_id, event, task, previous, attempts, next_attempt_at, processed_at, created_at, failed_at, last_error
+`
+
+type ClaimTaskOutboxParams struct {
+	LeaseUntil time.Time `json:"lease_until"`
+	MaxCount   int32     `json:"max_count"`
+}
+
+// Lease the pending changes by moving next_attempt_at forward, so that
+// other replicas skip them while they are being relayed. A change is only
+// claimed after the earlier changes of its task, to relay them in order.
+func (q *Queries) ClaimTaskOutbox(ctx context.Context, arg ClaimTaskOutboxParams) ([]TaskOutbox, error) {
+	rows, err := q.db.Query(ctx, claimTaskOutbox, arg.LeaseUntil, arg.MaxCount)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []TaskOutbox{}
+	for rows.Next() {
+		var i TaskOutbox
+		if err := rows.Scan(
+			&i.ID,
+			&i.TaskID,
+			&i.Event,
+			&i.Task,
+			&i.Previous,
+			&i.Attempts,
+			&i.NextAttemptAt,
+			&i.ProcessedAt,
+			&i.CreatedAt,
+			&i.FailedAt,
+			&i.LastError,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const createTaskOutbox = `-- name: CreateTaskOutbox :one
+INSERT INTO "task_outbox" (task_id,
+                           event,
+                           task,
+                           previous)
+VALUES ($1, $2, $3, $4)
+RETURNING id, task_id, event, task, previous, attempts, next_attempt_at, processed_at, created_at, failed_at, last_error
+`
+
+type CreateTaskOutboxParams struct {
+	TaskID   string `json:"task_id"`
+	Event    string `json:"event"`
+	Task     []byte `json:"task"`
+	Previous []byte `json:"previous"`
+}
+
+func (q *Queries) CreateTaskOutbox(ctx context.Context, arg CreateTaskOutboxParams) (TaskOutbox, error) {
+	row := q.db.QueryRow(ctx, createTaskOutbox,
+		arg.TaskID,
+		arg.Event,
+		arg.Task,
+		arg.Previous,
+	)
+	var i TaskOutbox
+	err := row.Scan(
+		&i.ID,
+		&i.TaskID,
+		&i.Event,
+		&i.Task,
+		&i.Previous,
+		&i.Attempts,
+		&i.NextAttemptAt,
+		&i.ProcessedAt,
+		&i.CreatedAt,
+		&i.FailedAt,
+		&i.LastError,
+	)
+	return i, err
+}
+
+const deleteProcessedTaskOutbox = `-- name: DeleteProcessedTaskOutbox :exec
+DELETE
+FROM "task_outbox"
+WHERE processed_at < $1
+`
+
+func (q *Queries) DeleteProcessedTaskOutbox(ctx context.Context, processedAt pgtype.Timestamptz) error {
+	_, err := q.db.Exec(ctx, deleteProcessedTaskOutbox, processedAt)
+	return err
+}
+
+const failTaskOutbox = `-- name: FailTaskOutbox :one
+UPDATE "task_outbox"
+SET attempts   = attempts + 1,
+    last_error = $1,
+    failed_at  = CASE WHEN attempts + 1 >= $2::integer THEN now() END
+WHERE id = $3
+RETURNING id, task_id, event, task, previous, attempts, next_attempt_at, processed_at, created_at, failed_at, last_error
+`
+
+type FailTaskOutboxParams struct {
+	LastError   pgtype.Text `json:"last_error"`
+	MaxAttempts int32       `json:"max_attempts"`
+	ID          int64       `json:"id"`
+}
+
+// Count a failed relay, and move the change aside after max_attempts,
+// which lets the later changes of its task go ahead
+func (q *Queries) FailTaskOutbox(ctx context.Context, arg FailTaskOutboxParams) (TaskOutbox, error) {
+	row := q.db.QueryRow(ctx, failTaskOutbox, arg.LastError, arg.MaxAttempts, arg.ID)
+	var i TaskOutbox
+	err := row.Scan(
+		&i.ID,
+		&i.TaskID,
+		&i.Event,
+		&i.Task,
+		&i.Previous,
+		&i.Attempts,
+		&i.NextAttemptAt,
+		&i.ProcessedAt,
+		&i.CreatedAt,
+		&i.FailedAt,
+		&i.LastError,
+	)
+	return i, err
+}
+
+const markTaskOutboxProcessed = `-- name: MarkTaskOutboxProcessed :exec
+UPDATE "task_outbox"
+SET processed_at = now()
+WHERE id = $1
+`
+
+func (q *Queries) MarkTaskOutboxProcessed(ctx context.Context, id int64) error {
+	_, err := q.db.Exec(ctx, markTaskOutboxProcessed, id)
+	return err
+}
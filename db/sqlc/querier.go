@@ -12,13 +12,56 @@ import (
 )
 
 type Querier interface {
+	// Lease the pending changes by moving next_attempt_at forward, so that
+	// other replicas skip them while they are being relayed. A change is only
+	// claimed after the earlier changes of its task, to relay them in order.
+	ClaimTaskOutbox(ctx context.Context, arg ClaimTaskOutboxParams) ([]TaskOutbox, error)
+	// Lease the due deliveries by moving next_attempt_at forward, so that
+	// other replicas skip them while they are being delivered
+	ClaimWebhookDeliveries(ctx context.Context, arg ClaimWebhookDeliveriesParams) ([]WebhookDelivery, error)
+	CountTasksByStatus(ctx context.Context, arg CountTasksByStatusParams) ([]CountTasksByStatusRow, error)
+	CountTasksByUser(ctx context.Context, userID pgtype.Text) ([]CountTasksByUserRow, error)
 	CreateTask(ctx context.Context, arg CreateTaskParams) (Task, error)
+	CreateTaskOutbox(ctx context.Context, arg CreateTaskOutboxParams) (TaskOutbox, error)
+	// A task is only billed once, even if its terminal update is retried
+	CreateUsageRecord(ctx context.Context, arg CreateUsageRecordParams) error
+	CreateWebhookAttempt(ctx context.Context, arg CreateWebhookAttemptParams) (WebhookAttempt, error)
+	CreateWebhookDelivery(ctx context.Context, arg CreateWebhookDeliveryParams) (WebhookDelivery, error)
+	DeleteProcessedTaskOutbox(ctx context.Context, processedAt pgtype.Timestamptz) error
 	DeleteTask(ctx context.Context, taskID string) error
-	DeleteTaskBeforeDate(ctx context.Context, createdAt time.Time) error
+	// Delete a batch of tasks returned by ListTasksBeforeDate together with their
+	// webhook deliveries (and attempts by cascade) and outbox changes, and count the
+	// deleted tasks. A task that has moved out of the statuses meanwhile is kept.
+	DeleteTaskBeforeDate(ctx context.Context, arg DeleteTaskBeforeDateParams) (int64, error)
+	// Count a failed relay, and move the change aside after max_attempts,
+	// which lets the later changes of its task go ahead
+	FailTaskOutbox(ctx context.Context, arg FailTaskOutboxParams) (TaskOutbox, error)
+	// The percentiles are over the running time of the succeeded tasks
+	GetModelStats(ctx context.Context, arg GetModelStatsParams) ([]GetModelStatsRow, error)
 	GetTaskById(ctx context.Context, taskID string) (Task, error)
-	GetTaskByUser(ctx context.Context, userID pgtype.Text) ([]Task, error)
-	GetTasksByModelNameAndStatus(ctx context.Context, arg GetTasksByModelNameAndStatusParams) ([]Task, error)
+	GetUsageRollupDay(ctx context.Context) (pgtype.Date, error)
+	GetUserStats(ctx context.Context, arg GetUserStatsParams) ([]GetUserStatsRow, error)
+	GetWebhookDelivery(ctx context.Context, id int64) (WebhookDelivery, error)
+	GetWebhookSecret(ctx context.Context, userID string) (WebhookSecret, error)
+	ListDailyUsage(ctx context.Context, arg ListDailyUsageParams) ([]UsageDaily, error)
+	// The models with tasks created before the given time
+	ListExpiredTaskModels(ctx context.Context, createdBefore time.Time) ([]string, error)
+	// The tasks in one of the statuses without an update since the given time
+	ListStaleTasks(ctx context.Context, arg ListStaleTasksParams) ([]Task, error)
+	// List the tasks of a model in the given statuses, i.e., the terminal ones,
+	// created before the given time
+	ListTasksBeforeDate(ctx context.Context, arg ListTasksBeforeDateParams) ([]Task, error)
+	ListTasksUpdatedSince(ctx context.Context, arg ListTasksUpdatedSinceParams) ([]Task, error)
+	ListWebhookAttemptsByTask(ctx context.Context, taskID string) ([]WebhookAttempt, error)
+	ListWebhookDeliveriesByTask(ctx context.Context, taskID string) ([]WebhookDelivery, error)
+	MarkTaskOutboxProcessed(ctx context.Context, id int64) error
+	// Recompute the daily usage (in UTC) of the records completed since the given day
+	RollupUsage(ctx context.Context, since time.Time) error
+	// The watermark only moves forward
+	SetUsageRollupDay(ctx context.Context, rolledUpDay pgtype.Date) error
 	UpdateTask(ctx context.Context, arg UpdateTaskParams) (Task, error)
+	UpdateWebhookDelivery(ctx context.Context, arg UpdateWebhookDeliveryParams) (WebhookDelivery, error)
+	UpsertWebhookSecret(ctx context.Context, arg UpsertWebhookSecretParams) (WebhookSecret, error)
 }
 
 var _ Querier = (*Queries)(nil)
@@ -0,0 +1,175 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.25.0
+// source: stats.sql
+
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const countTasksByStatus = `-- name: CountTasksByStatus :many
+SELECT status, count(*) AS count
+FROM "task"
+WHERE created_at >= $1
+  AND created_at < $2
+  AND ($3::varchar IS NULL OR model_name = $3)
+GROUP BY status
+`
+
+type CountTasksByStatusParams struct {
+	Since     time.Time   `json:"since"`
+	Until     time.Time   `json:"until"`
+	ModelName pgtype.Text `json:"model_name"`
+}
+
+type CountTasksByStatusRow struct {
+	Status pgtype.Text `json:"status"`
+	Count  int64       `json:"count"`
+}
+
+func (q *Queries) CountTasksByStatus(ctx context.Context, arg CountTasksByStatusParams) ([]CountTasksByStatusRow, error) {
+	rows, err := q.db.Query(ctx, countTasksByStatus, arg.Since, arg.Until, arg.ModelName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []CountTasksByStatusRow{}
+	for rows.Next() {
+		var i CountTasksByStatusRow
+		if err := rows.Scan(&i.Status, &i.Count); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getModelStats = `-- name: GetModelStats :many
+SELECT model_name,
+       count(*)                                                          AS total,
+       count(*) FILTER (WHERE status = 'succeeded')                      AS succeeded,
+       count(*) FILTER (WHERE status IN ('failed', 'timed_out'))         AS failed,
+       COALESCE(percentile_cont(0.5) WITHIN GROUP (ORDER BY running_time)
+                FILTER (WHERE status = 'succeeded'), 0)::float8          AS p50,
+       COALESCE(percentile_cont(0.95) WITHIN GROUP (ORDER BY running_time)
+                FILTER (WHERE status = 'succeeded'), 0)::float8          AS p95,
+       COALESCE(percentile_cont(0.99) WITHIN GROUP (ORDER BY running_time)
+                FILTER (WHERE status = 'succeeded'), 0)::float8          AS p99
+FROM "task"
+WHERE created_at >= $1
+  AND created_at < $2
+  AND ($3::varchar IS NULL OR model_name = $3)
+GROUP BY model_name
+ORDER BY model_name
+`
+
+type GetModelStatsParams struct {
+	Since     time.Time   `json:"since"`
+	Until     time.Time   `json:"until"`
+	ModelName pgtype.Text `json:"model_name"`
+}
+
+type GetModelStatsRow struct {
+	ModelName string  `json:"model_name"`
+	Total     int64   `json:"total"`
+	Succeeded int64   `json:"succeeded"`
+	Failed    int64   `json:"failed"`
+	P50       float64 `json:"p50"`
+	P95       float64 `json:"p95"`
+	P99       float64 `json:"p99"`
+}
+
+// The percentiles are over the running time of the succeeded tasks
+func (q *Queries) GetModelStats(ctx context.Context, arg GetModelStatsParams) ([]GetModelStatsRow, error) {
+	rows, err := q.db.Query(ctx, getModelStats, arg.Since, arg.Until, arg.ModelName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []GetModelStatsRow{}
+	for rows.Next() {
+		var i GetModelStatsRow
+		if err := rows.Scan(
+			&i.ModelName,
+			&i.Total,
+			&i.Succeeded,
+			&i.Failed,
+			&i.P50,
+			&i.P95,
+			&i.P99,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUserStats = `-- name: GetUserStats :many
+SELECT COALESCE(user_id, '')::varchar                AS user_id,
+       count(*)                                     AS total,
+       count(*) FILTER (WHERE status = 'succeeded') AS succeeded,
+       COALESCE(sum(running_time), 0)::float8       AS running_time
+FROM "task"
+WHERE created_at >= $1
+  AND created_at < $2
+  AND ($3::varchar IS NULL OR model_name = $3)
+GROUP BY user_id
+ORDER BY running_time DESC, user_id
+LIMIT $4
+`
+
+type GetUserStatsParams struct {
+	Since     time.Time   `json:"since"`
+	Until     time.Time   `json:"until"`
+	ModelName pgtype.Text `json:"model_name"`
+	MaxCount  int32       `json:"max_count"`
+}
+
+type GetUserStatsRow struct {
+	UserID      string  `json:"user_id"`
+	Total       int64   `json:"total"`
+	Succeeded   int64   `json:"succeeded"`
+	RunningTime float64 `json:"running_time"`
+}
+
+func (q *Queries) GetUserStats(ctx context.Context, arg GetUserStatsParams) ([]GetUserStatsRow, error) {
+	rows, err := q.db.Query(ctx, getUserStats,
+		arg.Since,
+		arg.Until,
+		arg.ModelName,
+		arg.MaxCount,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []GetUserStatsRow{}
+	for rows.Next() {
+		var i GetUserStatsRow
+		if err := rows.Scan(
+			&i.UserID,
+			&i.Total,
+			&i.Succeeded,
+			&i.RunningTime,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
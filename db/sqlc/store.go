@@ -8,6 +8,7 @@ import (
 
 type Store interface {
 	Querier
+	ListTasks(ctx context.Context, arg ListTasksParams) ([]Task, error)
 	ExecTx(ctx context.Context, fn func(*Queries) error) error
 	Ping(ctx context.Context) error
 }
@@ -0,0 +1,150 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// The columns that ListTasks can sort by
+const (
+	SortByCreatedAt = "created_at"
+	SortByUpdatedAt = "updated_at"
+)
+
+// taskColumns are the columns of Task, which TestTaskColumns keeps in line with the
+// generated struct when the schema changes
+const taskColumns = `id, task_id, user_id, model_name, created_at, updated_at, running_time, status, model_version,
+       outputs, error_info, queue_num, queue_id, canceled_by, webhook_url, webhook_events, version`
+
+// ListTasksParams filters, sorts and pages the tasks returned by ListTasks.
+// The zero value of a filter matches every task.
+type ListTasksParams struct {
+	UserID        string
+	ModelName     string
+	ModelVersion  string
+	Statuses      []string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	UpdatedAfter  time.Time
+	UpdatedBefore time.Time
+	// SortBy is SortByCreatedAt or SortByUpdatedAt, ties are broken by the record id
+	SortBy     string
+	Descending bool
+	// AfterTime and AfterID are the sort key of the last task of the previous page,
+	// the first page is returned if AfterID is zero
+	AfterTime time.Time
+	AfterID   int64
+	Limit     int32
+}
+
+// listTasksQuery builds the query of ListTasks. The filters are added dynamically,
+// so that the query can use the indexes of the filtered and sorted columns.
+func listTasksQuery(arg ListTasksParams) (string, []interface{}, error) {
+	sortBy := arg.SortBy
+	if sortBy == "" {
+		sortBy = SortByCreatedAt
+	}
+	if sortBy != SortByCreatedAt && sortBy != SortByUpdatedAt {
+		return "", nil, fmt.Errorf("cannot sort tasks by %q", sortBy)
+	}
+
+	var conditions []string
+	var args []interface{}
+	where := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if arg.UserID != "" {
+		where("user_id = $%d", arg.UserID)
+	}
+	if arg.ModelName != "" {
+		where("model_name = $%d", arg.ModelName)
+	}
+	if arg.ModelVersion != "" {
+		where("model_version = $%d", arg.ModelVersion)
+	}
+	if len(arg.Statuses) > 0 {
+		where("status = ANY($%d::varchar[])", arg.Statuses)
+	}
+	if !arg.CreatedAfter.IsZero() {
+		where("created_at >= $%d", arg.CreatedAfter)
+	}
+	if !arg.CreatedBefore.IsZero() {
+		where("created_at < $%d", arg.CreatedBefore)
+	}
+	if !arg.UpdatedAfter.IsZero() {
+		where("updated_at >= $%d", arg.UpdatedAfter)
+	}
+	if !arg.UpdatedBefore.IsZero() {
+		where("updated_at < $%d", arg.UpdatedBefore)
+	}
+	order, compare := "ASC", ">"
+	if arg.Descending {
+		order, compare = "DESC", "<"
+	}
+	if arg.AfterID != 0 {
+		args = append(args, arg.AfterTime, arg.AfterID)
+		conditions = append(conditions, fmt.Sprintf("(%s, id) %s ($%d, $%d)",
+			sortBy, compare, len(args)-1, len(args)))
+	}
+
+	var query strings.Builder
+	query.WriteString("SELECT " + taskColumns + "\nFROM \"task\"")
+	if len(conditions) > 0 {
+		query.WriteString("\nWHERE " + strings.Join(conditions, "\n  AND "))
+	}
+	args = append(args, arg.Limit)
+	query.WriteString(fmt.Sprintf("\nORDER BY %s %s, id %s\nLIMIT $%d", sortBy, order, order, len(args)))
+	return query.String(), args, nil
+}
+
+// ListTasks returns a page of the tasks matching the filters. It isn't generated by sqlc
+// since the filters are added dynamically.
+func (store *SQLStore) ListTasks(ctx context.Context, arg ListTasksParams) ([]Task, error) {
+	query, args, err := listTasksQuery(arg)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := store.connPool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Task{}
+	for rows.Next() {
+		var i Task
+		if err := rows.Scan(taskFields(&i)...); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// taskFields returns the fields of a task in the order of taskColumns
+func taskFields(i *Task) []interface{} {
+	return []interface{}{
+		&i.ID,
+		&i.TaskID,
+		&i.UserID,
+		&i.ModelName,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.RunningTime,
+		&i.Status,
+		&i.ModelVersion,
+		&i.Outputs,
+		&i.ErrorInfo,
+		&i.QueueNum,
+		&i.QueueID,
+		&i.CanceledBy,
+		&i.WebhookUrl,
+		&i.WebhookEvents,
+		&i.Version,
+	}
+}
@@ -0,0 +1,53 @@
+package db
+
+import (
+	"github.com/stretchr/testify/require"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTaskColumns(t *testing.T) {
+	// The columns and the scanned fields must follow the struct generated from the schema
+	var task Task
+	value := reflect.ValueOf(&task).Elem()
+	fields := taskFields(&task)
+	require.Len(t, fields, value.NumField())
+	var columns []string
+	for i := 0; i < value.NumField(); i++ {
+		columns = append(columns, value.Type().Field(i).Tag.Get("json"))
+		require.Same(t, value.Field(i).Addr().Interface(), fields[i], value.Type().Field(i).Name)
+	}
+	require.Equal(t, columns, strings.Fields(strings.ReplaceAll(taskColumns, ",", " ")))
+}
+
+func TestListTasksQuery(t *testing.T) {
+	query, args, err := listTasksQuery(ListTasksParams{Limit: 10})
+	require.NoError(t, err)
+	require.Equal(t, "SELECT "+taskColumns+"\nFROM \"task\"\nORDER BY created_at ASC, id ASC\nLIMIT $1", query)
+	require.Equal(t, []interface{}{int32(10)}, args)
+
+	after := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	query, args, err = listTasksQuery(ListTasksParams{
+		ModelName:    "m",
+		Statuses:     []string{"failed", "timed_out"},
+		UpdatedAfter: after,
+		SortBy:       SortByUpdatedAt,
+		Descending:   true,
+		AfterTime:    after,
+		AfterID:      7,
+		Limit:        10,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "SELECT "+taskColumns+"\nFROM \"task\"\n"+
+		"WHERE model_name = $1\n"+
+		"  AND status = ANY($2::varchar[])\n"+
+		"  AND updated_at >= $3\n"+
+		"  AND (updated_at, id) < ($4, $5)\n"+
+		"ORDER BY updated_at DESC, id DESC\nLIMIT $6", query)
+	require.Equal(t, []interface{}{"m", []string{"failed", "timed_out"}, after, after, int64(7), int32(10)}, args)
+
+	_, _, err = listTasksQuery(ListTasksParams{SortBy: "status"})
+	require.Error(t, err)
+}
@@ -12,22 +12,62 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const countTasksByUser = `-- name: CountTasksByUser :many
+SELECT status, count(*) AS count
+FROM "task"
+WHERE user_id = $1
+GROUP BY status
+`
+
+type CountTasksByUserRow struct {
+	Status pgtype.Text `json:"status"`
+	Count  int64       `json:"count"`
+}
+
+func (q *Queries) CountTasksByUser(ctx context.Context, userID pgtype.Text) ([]CountTasksByUserRow, error) {
+	rows, err := q.db.Query(ctx, countTasksByUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []CountTasksByUserRow{}
+	for rows.Next() {
+		var i CountTasksByUserRow
+		if err := rows.Scan(&i.Status, &i.Count); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const createTask = `-- name: CreateTask :one
 INSERT INTO "task" (task_id,
                     user_id,
                     model_name,
+                    model_version,
                     running_time,
-                    status)
-VALUES ($1, $2, $3, $4, $5)
-RETURNING id, task_id, user_id, model_name, created_at, updated_at, running_time, status
+                    status,
+                    queue_num,
+                    webhook_url,
+                    webhook_events)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+RETURNING id, task_id, user_id, model_name, created_at, updated_at, running_time, status, model_version, outputs, error_info, queue_num, queue_id, canceled_by, webhook_url, webhook_events, version
 `
 
 type CreateTaskParams struct {
-	TaskID      string        `json:"task_id"`
-	UserID      pgtype.Text   `json:"user_id"`
-	ModelName   string        `json:"model_name"`
-	RunningTime pgtype.Float8 `json:"running_time"`
-	Status      pgtype.Text   `json:"status"`
+	TaskID        string        `json:"task_id"`
+	UserID        pgtype.Text   `json:"user_id"`
+	ModelName     string        `json:"model_name"`
+	ModelVersion  pgtype.Text   `json:"model_version"`
+	RunningTime   pgtype.Float8 `json:"running_time"`
+	Status        pgtype.Text   `json:"status"`
+	QueueNum      pgtype.Int4   `json:"queue_num"`
+	WebhookUrl    pgtype.Text   `json:"webhook_url"`
+	WebhookEvents []string      `json:"webhook_events"`
 }
 
 func (q *Queries) CreateTask(ctx context.Context, arg CreateTaskParams) (Task, error) {
@@ -35,8 +75,12 @@ func (q *Queries) CreateTask(ctx context.Context, arg CreateTaskParams) (Task, e
 		arg.TaskID,
 		arg.UserID,
 		arg.ModelName,
+		arg.ModelVersion,
 		arg.RunningTime,
 		arg.Status,
+		arg.QueueNum,
+		arg.WebhookUrl,
+		arg.WebhookEvents,
 	)
 	var i Task
 	err := row.Scan(
@@ -48,6 +92,15 @@ func (q *Queries) CreateTask(ctx context.Context, arg CreateTaskParams) (Task, e
 		&i.UpdatedAt,
 		&i.RunningTime,
 		&i.Status,
+		&i.ModelVersion,
+		&i.Outputs,
+		&i.ErrorInfo,
+		&i.QueueNum,
+		&i.QueueID,
+		&i.CanceledBy,
+		&i.WebhookUrl,
+		&i.WebhookEvents,
+		&i.Version,
 	)
 	return i, err
 }
@@ -63,19 +116,51 @@ func (q *Queries) DeleteTask(ctx context.Context, taskID string) error {
 	return err
 }
 
-const deleteTaskBeforeDate = `-- name: DeleteTaskBeforeDate :exec
-DELETE
-FROM "task"
-WHERE created_at < $1
+const deleteTaskBeforeDate = `-- name: DeleteTaskBeforeDate :one
+WITH deleted AS (
+    DELETE
+    FROM "task" t
+    WHERE t.model_name = $1
+      AND t.created_at < $2
+      AND t.status = ANY ($3::varchar[])
+      AND t.id = ANY ($4::bigint[])
+    RETURNING t.task_id),
+     deliveries AS (
+         DELETE
+         FROM "webhook_delivery"
+         WHERE task_id IN (SELECT task_id FROM deleted)),
+     outbox AS (
+         DELETE
+         FROM "task_outbox"
+         WHERE task_id IN (SELECT task_id FROM deleted))
+SELECT count(*)
+FROM deleted
 `
 
-func (q *Queries) DeleteTaskBeforeDate(ctx context.Context, createdAt time.Time) error {
-	_, err := q.db.Exec(ctx, deleteTaskBeforeDate, createdAt)
-	return err
+type DeleteTaskBeforeDateParams struct {
+	ModelName     string    `json:"model_name"`
+	CreatedBefore time.Time `json:"created_before"`
+	Statuses      []string  `json:"statuses"`
+	IDs           []int64   `json:"ids"`
+}
+
+// Delete a batch of tasks returned by ListTasksBeforeDate together with their
+// webhook deliveries (and attempts by cascade) and outbox changes, and count the
+// deleted tasks. A task that has moved out of the statuses meanwhile is kept.
+func (q *Queries) DeleteTaskBeforeDate(ctx context.Context, arg DeleteTaskBeforeDateParams) (int64, error) {
+	row := q.db.QueryRow(ctx, deleteTaskBeforeDate,
+		arg.ModelName,
+		arg.CreatedBefore,
+		arg.Statuses,
+		arg.IDs,
+	)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
 }
 
 const getTaskById = `-- name: GetTaskById :one
-SELECT id, task_id, user_id, model_name, created_at, updated_at, running_time, status
+SELECT id, task_id, user_id, model_name, created_at, updated_at, running_time, status, model_version, outputs, error_info, queue_num, queue_id, canceled_by, webhook_url, webhook_events, version
 FROM "task"
 WHERE task_id = $1
 LIMIT 1
@@ -93,18 +178,72 @@ func (q *Queries) GetTaskById(ctx context.Context, taskID string) (Task, error)
 		&i.UpdatedAt,
 		&i.RunningTime,
 		&i.Status,
+		&i.ModelVersion,
+		&i.Outputs,
+		&i.ErrorInfo,
+		&i.QueueNum,
+		&i.QueueID,
+		&i.CanceledBy,
+		&i.WebhookUrl,
+		&i.WebhookEvents,
+		&i.Version,
 	)
 	return i, err
 }
 
-const getTaskByUser = `-- name: GetTaskByUser :many
-SELECT id, task_id, user_id, model_name, created_at, updated_at, running_time, status
+const listExpiredTaskModels = `-- name: ListExpiredTaskModels :many
+SELECT DISTINCT model_name
 FROM "task"
-WHERE user_id = $1
+WHERE created_at < $1
+ORDER BY model_name
 `
 
-func (q *Queries) GetTaskByUser(ctx context.Context, userID pgtype.Text) ([]Task, error) {
-	rows, err := q.db.Query(ctx, getTaskByUser, userID)
+// The models with tasks created before the given time
+func (q *Queries) ListExpiredTaskModels(ctx context.Context, createdBefore time.Time) ([]string, error) {
+	rows, err := q.db.Query(ctx, listExpiredTaskModels, createdBefore)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []string{}
+	for rows.Next() {
+		var model_name string
+		if err := rows.Scan(&model_name); err != nil {
+			return nil, err
+		}
+		items = append(items, model_name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listStaleTasks = `-- name: ListStaleTasks :many
+SELECT id, task_id, user_id, model_name, created_at, updated_at, running_time, status, model_version, outputs, error_info, queue_num, queue_id, canceled_by, webhook_url, webhook_events, version
+FROM "task"
+WHERE status = ANY ($1::varchar[])
+  AND updated_at < $2
+  AND id > $3
+ORDER BY id
+LIMIT $4
+`
+
+type ListStaleTasksParams struct {
+	Statuses      []string  `json:"statuses"`
+	UpdatedBefore time.Time `json:"updated_before"`
+	AfterID       int64     `json:"after_id"`
+	MaxCount      int32     `json:"max_count"`
+}
+
+// The tasks in one of the statuses without an update since the given time
+func (q *Queries) ListStaleTasks(ctx context.Context, arg ListStaleTasksParams) ([]Task, error) {
+	rows, err := q.db.Query(ctx, listStaleTasks,
+		arg.Statuses,
+		arg.UpdatedBefore,
+		arg.AfterID,
+		arg.MaxCount,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -121,6 +260,15 @@ func (q *Queries) GetTaskByUser(ctx context.Context, userID pgtype.Text) ([]Task
 			&i.UpdatedAt,
 			&i.RunningTime,
 			&i.Status,
+			&i.ModelVersion,
+			&i.Outputs,
+			&i.ErrorInfo,
+			&i.QueueNum,
+			&i.QueueID,
+			&i.CanceledBy,
+			&i.WebhookUrl,
+			&i.WebhookEvents,
+			&i.Version,
 		); err != nil {
 			return nil, err
 		}
@@ -132,20 +280,88 @@ func (q *Queries) GetTaskByUser(ctx context.Context, userID pgtype.Text) ([]Task
 	return items, nil
 }
 
-const getTasksByModelNameAndStatus = `-- name: GetTasksByModelNameAndStatus :many
-SELECT id, task_id, user_id, model_name, created_at, updated_at, running_time, status
+const listTasksBeforeDate = `-- name: ListTasksBeforeDate :many
+SELECT id, task_id, user_id, model_name, created_at, updated_at, running_time, status, model_version, outputs, error_info, queue_num, queue_id, canceled_by, webhook_url, webhook_events, version
 FROM "task"
 WHERE model_name = $1
-  AND status = $2
+  AND created_at < $2
+  AND status = ANY ($3::varchar[])
+  AND id > $4
+ORDER BY id
+LIMIT $5
+`
+
+type ListTasksBeforeDateParams struct {
+	ModelName     string    `json:"model_name"`
+	CreatedBefore time.Time `json:"created_before"`
+	Statuses      []string  `json:"statuses"`
+	AfterID       int64     `json:"after_id"`
+	MaxCount      int32     `json:"max_count"`
+}
+
+// List the tasks of a model in the given statuses, i.e., the terminal ones,
+// created before the given time
+func (q *Queries) ListTasksBeforeDate(ctx context.Context, arg ListTasksBeforeDateParams) ([]Task, error) {
+	rows, err := q.db.Query(ctx, listTasksBeforeDate,
+		arg.ModelName,
+		arg.CreatedBefore,
+		arg.Statuses,
+		arg.AfterID,
+		arg.MaxCount,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Task{}
+	for rows.Next() {
+		var i Task
+		if err := rows.Scan(
+			&i.ID,
+			&i.TaskID,
+			&i.UserID,
+			&i.ModelName,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.RunningTime,
+			&i.Status,
+			&i.ModelVersion,
+			&i.Outputs,
+			&i.ErrorInfo,
+			&i.QueueNum,
+			&i.QueueID,
+			&i.CanceledBy,
+			&i.WebhookUrl,
+			&i.WebhookEvents,
+			&i.Version,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTasksUpdatedSince = `-- name: ListTasksUpdatedSince :many
+SELECT id, task_id, user_id, model_name, created_at, updated_at, running_time, status, model_version, outputs, error_info, queue_num, queue_id, canceled_by, webhook_url, webhook_events, version
+FROM "task"
+WHERE updated_at >= $1
+  AND id > $2
+ORDER BY id
+LIMIT $3
 `
 
-type GetTasksByModelNameAndStatusParams struct {
-	ModelName string      `json:"model_name"`
-	Status    pgtype.Text `json:"status"`
+type ListTasksUpdatedSinceParams struct {
+	UpdatedSince time.Time `json:"updated_since"`
+	AfterID      int64     `json:"after_id"`
+	MaxCount     int32     `json:"max_count"`
 }
 
-func (q *Queries) GetTasksByModelNameAndStatus(ctx context.Context, arg GetTasksByModelNameAndStatusParams) ([]Task, error) {
-	rows, err := q.db.Query(ctx, getTasksByModelNameAndStatus, arg.ModelName, arg.Status)
+func (q *Queries) ListTasksUpdatedSince(ctx context.Context, arg ListTasksUpdatedSinceParams) ([]Task, error) {
+	rows, err := q.db.Query(ctx, listTasksUpdatedSince, arg.UpdatedSince, arg.AfterID, arg.MaxCount)
 	if err != nil {
 		return nil, err
 	}
@@ -162,6 +378,15 @@ func (q *Queries) GetTasksByModelNameAndStatus(ctx context.Context, arg GetTasks
 			&i.UpdatedAt,
 			&i.RunningTime,
 			&i.Status,
+			&i.ModelVersion,
+			&i.Outputs,
+			&i.ErrorInfo,
+			&i.QueueNum,
+			&i.QueueID,
+			&i.CanceledBy,
+			&i.WebhookUrl,
+			&i.WebhookEvents,
+			&i.Version,
 		); err != nil {
 			return nil, err
 		}
@@ -177,24 +402,42 @@ const updateTask = `-- name: UpdateTask :one
 UPDATE "task"
 SET running_time = COALESCE($1, running_time),
     status       = COALESCE($2, status),
-    updated_at   = COALESCE($3, updated_at)
-WHERE task_id = $4
-RETURNING id, task_id, user_id, model_name, created_at, updated_at, running_time, status
+    outputs      = COALESCE($3, outputs),
+    error_info   = COALESCE($4, error_info),
+    queue_id     = COALESCE($5, queue_id),
+    canceled_by  = COALESCE($6, canceled_by),
+    updated_at   = COALESCE($7, updated_at),
+    version      = COALESCE($8, version)
+WHERE task_id = $9
+  AND ($10::bigint IS NULL OR version = $10)
+RETURNING id, task_id, user_id, model_name, created_at, updated_at, running_time, status, model_version, outputs, error_info, queue_num, queue_id, canceled_by, webhook_url, webhook_events, version
 `
 
 type UpdateTaskParams struct {
-	RunningTime pgtype.Float8      `json:"running_time"`
-	Status      pgtype.Text        `json:"status"`
-	UpdatedAt   pgtype.Timestamptz `json:"updated_at"`
-	TaskID      string             `json:"task_id"`
+	RunningTime     pgtype.Float8      `json:"running_time"`
+	Status          pgtype.Text        `json:"status"`
+	Outputs         []byte             `json:"outputs"`
+	ErrorInfo       pgtype.Text        `json:"error_info"`
+	QueueID         pgtype.Text        `json:"queue_id"`
+	CanceledBy      pgtype.Text        `json:"canceled_by"`
+	UpdatedAt       pgtype.Timestamptz `json:"updated_at"`
+	Version         pgtype.Int8        `json:"version"`
+	TaskID          string             `json:"task_id"`
+	ExpectedVersion pgtype.Int8        `json:"expected_version"`
 }
 
 func (q *Queries) UpdateTask(ctx context.Context, arg UpdateTaskParams) (Task, error) {
 	row := q.db.QueryRow(ctx, updateTask,
 		arg.RunningTime,
 		arg.Status,
+		arg.Outputs,
+		arg.ErrorInfo,
+		arg.QueueID,
+		arg.CanceledBy,
 		arg.UpdatedAt,
+		arg.Version,
 		arg.TaskID,
+		arg.ExpectedVersion,
 	)
 	var i Task
 	err := row.Scan(
@@ -206,6 +449,15 @@ func (q *Queries) UpdateTask(ctx context.Context, arg UpdateTaskParams) (Task, e
 		&i.UpdatedAt,
 		&i.RunningTime,
 		&i.Status,
+		&i.ModelVersion,
+		&i.Outputs,
+		&i.ErrorInfo,
+		&i.QueueNum,
+		&i.QueueID,
+		&i.CanceledBy,
+		&i.WebhookUrl,
+		&i.WebhookEvents,
+		&i.Version,
 	)
 	return i, err
 }
@@ -0,0 +1,142 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.25.0
+// source: usage.sql
+
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const createUsageRecord = `-- name: CreateUsageRecord :exec
+INSERT INTO "usage_record" (task_id,
+                            user_id,
+                            model_name,
+                            model_version,
+                            status,
+                            gpu_seconds,
+                            completed_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+ON CONFLICT (task_id) DO NOTHING
+`
+
+type CreateUsageRecordParams struct {
+	TaskID       string    `json:"task_id"`
+	UserID       string    `json:"user_id"`
+	ModelName    string    `json:"model_name"`
+	ModelVersion string    `json:"model_version"`
+	Status       string    `json:"status"`
+	GpuSeconds   float64   `json:"gpu_seconds"`
+	CompletedAt  time.Time `json:"completed_at"`
+}
+
+// A task is only billed once, even if its terminal update is retried
+func (q *Queries) CreateUsageRecord(ctx context.Context, arg CreateUsageRecordParams) error {
+	_, err := q.db.Exec(ctx, createUsageRecord,
+		arg.TaskID,
+		arg.UserID,
+		arg.ModelName,
+		arg.ModelVersion,
+		arg.Status,
+		arg.GpuSeconds,
+		arg.CompletedAt,
+	)
+	return err
+}
+
+const getUsageRollupDay = `-- name: GetUsageRollupDay :one
+SELECT rolled_up_day
+FROM "usage_rollup"
+WHERE id = 1
+`
+
+func (q *Queries) GetUsageRollupDay(ctx context.Context) (pgtype.Date, error) {
+	row := q.db.QueryRow(ctx, getUsageRollupDay)
+	var rolled_up_day pgtype.Date
+	err := row.Scan(&rolled_up_day)
+	return rolled_up_day, err
+}
+
+const listDailyUsage = `-- name: ListDailyUsage :many
+SELECT day, user_id, model_name, model_version, tasks, gpu_seconds, updated_at
+FROM "usage_daily"
+WHERE day >= $1
+  AND day < $2
+  AND ($3::varchar IS NULL OR user_id = $3)
+ORDER BY user_id, day, model_name, model_version
+`
+
+type ListDailyUsageParams struct {
+	FromDay pgtype.Date `json:"from_day"`
+	ToDay   pgtype.Date `json:"to_day"`
+	UserID  pgtype.Text `json:"user_id"`
+}
+
+func (q *Queries) ListDailyUsage(ctx context.Context, arg ListDailyUsageParams) ([]UsageDaily, error) {
+	rows, err := q.db.Query(ctx, listDailyUsage, arg.FromDay, arg.ToDay, arg.UserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []UsageDaily{}
+	for rows.Next() {
+		var i UsageDaily
+		if err := rows.Scan(
+			&i.Day,
+			&i.UserID,
+			&i.ModelName,
+			&i.ModelVersion,
+			&i.Tasks,
+			&i.GpuSeconds,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const rollupUsage = `-- name: RollupUsage :exec
+INSERT INTO "usage_daily" (day, user_id, model_name, model_version, tasks, gpu_seconds)
+SELECT (completed_at AT TIME ZONE 'UTC')::date AS day,
+       user_id,
+       model_name,
+       model_version,
+       count(*),
+       sum(gpu_seconds)
+FROM "usage_record"
+WHERE completed_at >= $1
+GROUP BY 1, user_id, model_name, model_version
+ON CONFLICT (day, user_id, model_name, model_version) DO UPDATE
+    SET tasks       = EXCLUDED.tasks,
+        gpu_seconds = EXCLUDED.gpu_seconds,
+        updated_at  = now()
+`
+
+// Recompute the daily usage (in UTC) of the records completed since the given day
+func (q *Queries) RollupUsage(ctx context.Context, since time.Time) error {
+	_, err := q.db.Exec(ctx, rollupUsage, since)
+	return err
+}
+
+const setUsageRollupDay = `-- name: SetUsageRollupDay :exec
+INSERT INTO "usage_rollup" (id, rolled_up_day)
+VALUES (1, $1)
+ON CONFLICT (id) DO UPDATE
+    SET rolled_up_day = GREATEST("usage_rollup".rolled_up_day, EXCLUDED.rolled_up_day),
+        updated_at    = now()
+`
+
+// The watermark only moves forward
+func (q *Queries) SetUsageRollupDay(ctx context.Context, rolledUpDay pgtype.Date) error {
+	_, err := q.db.Exec(ctx, setUsageRollupDay, rolledUpDay)
+	return err
+}
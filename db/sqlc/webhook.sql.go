@@ -0,0 +1,346 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.25.0
+// source: webhook.sql
+
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const claimWebhookDeliveries = `-- name: ClaimWebhookDeliveries :many
+UPDATE "webhook_delivery"
+SET next_attempt_at = $1,
+    updated_at      = now()
+WHERE id IN (SELECT id
+             FROM "webhook_delivery"
+             WHERE status = 'pending'
+               AND next_attempt_at <= now()
+             ORDER BY next_attempt_at
+             LIMIT $2 FOR UPDATE SKIP LOCKED)
+RETURNING id, task_id, user_id, url, event, payload, status, attempts, next_attempt_at, last_error, created_at, updated_at
+`
+
+type ClaimWebhookDeliveriesParams struct {
+	LeaseUntil time.Time `json:"lease_until"`
+	MaxCount   int32     `json:"max_count"`
+}
+
+// Lease the due deliveries by moving next_attempt_at forward, so that
+// other replicas skip them while they are being delivered
+func (q *Queries) ClaimWebhookDeliveries(ctx context.Context, arg ClaimWebhookDeliveriesParams) ([]WebhookDelivery, error) {
+	rows, err := q.db.Query(ctx, claimWebhookDeliveries, arg.LeaseUntil, arg.MaxCount)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []WebhookDelivery{}
+	for rows.Next() {
+		var i WebhookDelivery
+		if err := rows.Scan(
+			&i.ID,
+			&i.TaskID,
+			&i.UserID,
+			&i.Url,
+			&i.Event,
+			&i.Payload,
+			&i.Status,
+			&i.Attempts,
+			&i.NextAttemptAt,
+			&i.LastError,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const createWebhookAttempt = `-- name: CreateWebhookAttempt :one
+INSERT INTO "webhook_attempt" (delivery_id,
+                               task_id,
+                               attempt,
+                               status_code,
+                               error,
+                               duration_ms)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING id, delivery_id, task_id, attempt, status_code, error, duration_ms, created_at
+`
+
+type CreateWebhookAttemptParams struct {
+	DeliveryID int64       `json:"delivery_id"`
+	TaskID     string      `json:"task_id"`
+	Attempt    int32       `json:"attempt"`
+	StatusCode pgtype.Int4 `json:"status_code"`
+	Error      pgtype.Text `json:"error"`
+	DurationMs int64       `json:"duration_ms"`
+}
+
+func (q *Queries) CreateWebhookAttempt(ctx context.Context, arg CreateWebhookAttemptParams) (WebhookAttempt, error) {
+	row := q.db.QueryRow(ctx, createWebhookAttempt,
+		arg.DeliveryID,
+		arg.TaskID,
+		arg.Attempt,
+		arg.StatusCode,
+		arg.Error,
+		arg.DurationMs,
+	)
+	var i WebhookAttempt
+	err := row.Scan(
+		&i.ID,
+		&i.DeliveryID,
+		&i.TaskID,
+		&i.Attempt,
+		&i.StatusCode,
+		&i.Error,
+		&i.DurationMs,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const createWebhookDelivery = `-- name: CreateWebhookDelivery :one
+INSERT INTO "webhook_delivery" (task_id,
+                                user_id,
+                                url,
+                                event,
+                                payload)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING id, task_id, user_id, url, event, payload, status, attempts, next_attempt_at, last_error, created_at, updated_at
+`
+
+type CreateWebhookDeliveryParams struct {
+	TaskID  string      `json:"task_id"`
+	UserID  pgtype.Text `json:"user_id"`
+	Url     string      `json:"url"`
+	Event   string      `json:"event"`
+	Payload []byte      `json:"payload"`
+}
+
+func (q *Queries) CreateWebhookDelivery(ctx context.Context, arg CreateWebhookDeliveryParams) (WebhookDelivery, error) {
+	row := q.db.QueryRow(ctx, createWebhookDelivery,
+		arg.TaskID,
+		arg.UserID,
+		arg.Url,
+		arg.Event,
+		arg.Payload,
+	)
+	var i WebhookDelivery
+	err := row.Scan(
+		&i.ID,
+		&i.TaskID,
+		&i.UserID,
+		&i.Url,
+		&i.Event,
+		&i.Payload,
+		&i.Status,
+		&i.Attempts,
+		&i.NextAttemptAt,
+		&i.LastError,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getWebhookDelivery = `-- name: GetWebhookDelivery :one
+SELECT id, task_id, user_id, url, event, payload, status, attempts, next_attempt_at, last_error, created_at, updated_at
+FROM "webhook_delivery"
+WHERE id = $1
+LIMIT 1
+`
+
+func (q *Queries) GetWebhookDelivery(ctx context.Context, id int64) (WebhookDelivery, error) {
+	row := q.db.QueryRow(ctx, getWebhookDelivery, id)
+	var i WebhookDelivery
+	err := row.Scan(
+		&i.ID,
+		&i.TaskID,
+		&i.UserID,
+		&i.Url,
+		&i.Event,
+		&i.Payload,
+		&i.Status,
+		&i.Attempts,
+		&i.NextAttemptAt,
+		&i.LastError,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getWebhookSecret = `-- name: GetWebhookSecret :one
+SELECT user_id, secret, created_at, updated_at
+FROM "webhook_secret"
+WHERE user_id = $1
+LIMIT 1
+`
+
+func (q *Queries) GetWebhookSecret(ctx context.Context, userID string) (WebhookSecret, error) {
+	row := q.db.QueryRow(ctx, getWebhookSecret, userID)
+	var i WebhookSecret
+	err := row.Scan(
+		&i.UserID,
+		&i.Secret,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const listWebhookAttemptsByTask = `-- name: ListWebhookAttemptsByTask :many
+SELECT id, delivery_id, task_id, attempt, status_code, error, duration_ms, created_at
+FROM "webhook_attempt"
+WHERE task_id = $1
+ORDER BY id
+`
+
+func (q *Queries) ListWebhookAttemptsByTask(ctx context.Context, taskID string) ([]WebhookAttempt, error) {
+	rows, err := q.db.Query(ctx, listWebhookAttemptsByTask, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []WebhookAttempt{}
+	for rows.Next() {
+		var i WebhookAttempt
+		if err := rows.Scan(
+			&i.ID,
+			&i.DeliveryID,
+			&i.TaskID,
+			&i.Attempt,
+			&i.StatusCode,
+			&i.Error,
+			&i.DurationMs,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listWebhookDeliveriesByTask = `-- name: ListWebhookDeliveriesByTask :many
+SELECT id, task_id, user_id, url, event, payload, status, attempts, next_attempt_at, last_error, created_at, updated_at
+FROM "webhook_delivery"
+WHERE task_id = $1
+ORDER BY id
+`
+
+func (q *Queries) ListWebhookDeliveriesByTask(ctx context.Context, taskID string) ([]WebhookDelivery, error) {
+	rows, err := q.db.Query(ctx, listWebhookDeliveriesByTask, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []WebhookDelivery{}
+	for rows.Next() {
+		var i WebhookDelivery
+		if err := rows.Scan(
+			&i.ID,
+			&i.TaskID,
+			&i.UserID,
+			&i.Url,
+			&i.Event,
+			&i.Payload,
+			&i.Status,
+			&i.Attempts,
+			&i.NextAttemptAt,
+			&i.LastError,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateWebhookDelivery = `-- name: UpdateWebhookDelivery :one
+UPDATE "webhook_delivery"
+SET status          = $2,
+    attempts        = $3,
+    next_attempt_at = $4,
+    last_error      = $5,
+    updated_at      = now()
+WHERE id = $1
+RETURNING id, task_id, user_id, url, event, payload, status, attempts, next_attempt_at, last_error, created_at, updated_at
+`
+
+type UpdateWebhookDeliveryParams struct {
+	ID            int64       `json:"id"`
+	Status        string      `json:"status"`
+	Attempts      int32       `json:"attempts"`
+	NextAttemptAt time.Time   `json:"next_attempt_at"`
+	LastError     pgtype.Text `json:"last_error"`
+}
+
+func (q *Queries) UpdateWebhookDelivery(ctx context.Context, arg UpdateWebhookDeliveryParams) (WebhookDelivery, error) {
+	row := q.db.QueryRow(ctx, updateWebhookDelivery,
+		arg.ID,
+		arg.Status,
+		arg.Attempts,
+		arg.NextAttemptAt,
+		arg.LastError,
+	)
+	var i WebhookDelivery
+	err := row.Scan(
+		&i.ID,
+		&i.TaskID,
+		&i.UserID,
+		&i.Url,
+		&i.Event,
+		&i.Payload,
+		&i.Status,
+		&i.Attempts,
+		&i.NextAttemptAt,
+		&i.LastError,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const upsertWebhookSecret = `-- name: UpsertWebhookSecret :one
+INSERT INTO "webhook_secret" (user_id, secret)
+VALUES ($1, $2)
+ON CONFLICT (user_id) DO UPDATE
+    SET secret     = EXCLUDED.secret,
+        updated_at = now()
+RETURNING user_id, secret, created_at, updated_at
+`
+
+type UpsertWebhookSecretParams struct {
+	UserID string `json:"user_id"`
+	Secret string `json:"secret"`
+}
+
+func (q *Queries) UpsertWebhookSecret(ctx context.Context, arg UpsertWebhookSecretParams) (WebhookSecret, error) {
+	row := q.db.QueryRow(ctx, upsertWebhookSecret, arg.UserID, arg.Secret)
+	var i WebhookSecret
+	err := row.Scan(
+		&i.UserID,
+		&i.Secret,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
@@ -2,8 +2,10 @@ package main
 
 import (
 	"context"
+	"flag"
 	"github.com/HyperGAI/serving-webhook/api"
 	db "github.com/HyperGAI/serving-webhook/db/sqlc"
+	"github.com/HyperGAI/serving-webhook/scheduler"
 	"github.com/HyperGAI/serving-webhook/storage"
 	"github.com/HyperGAI/serving-webhook/utils"
 	"github.com/golang-migrate/migrate/v4"
@@ -18,6 +20,12 @@ import (
 	"time"
 )
 
+const (
+	schedulerLockKey = "lock:scheduler"
+	// schedulerLockID is the key of the advisory lock in postgres
+	schedulerLockID int64 = 7240350
+)
+
 func main() {
 	config, err := utils.LoadConfig(".")
 	if err != nil {
@@ -33,7 +41,9 @@ func main() {
 	}
 	// Redis cache
 	var cache storage.Cache = nil
-	if config.RedisAddress != "" && config.RedisAddress != "empty" {
+	if config.RedisAddress == "memory" {
+		cache = storage.NewMemoryCache()
+	} else if config.RedisAddress != "" && config.RedisAddress != "empty" {
 		cache, err = storage.NewRedisClient(config)
 		if err != nil {
 			log.Fatal().Err(err).Msg("cannot create redis cache")
@@ -41,8 +51,9 @@ func main() {
 	}
 	// Database
 	var database db.Store = nil
+	var connPool *pgxpool.Pool = nil
 	if config.DBSource != "" && config.DBSource != "empty" {
-		connPool, err := pgxpool.New(context.Background(), config.DBSource)
+		connPool, err = pgxpool.New(context.Background(), config.DBSource)
 		if err != nil {
 			log.Fatal().Err(err).Msg("cannot connect to db")
 		}
@@ -51,11 +62,62 @@ func main() {
 		runDBMigration(config.MigrationURL, config.DBSource)
 		database = db.NewStore(connPool)
 	}
+	if len(os.Args) > 1 && os.Args[1] == "reconcile" {
+		runReconcile(config, store, cache, database, os.Args[2:])
+		return
+	}
 	// Start model API server
-	runGinServer(config, store, cache, database)
+	runGinServer(config, store, cache, database, newElector(config, cache, connPool))
+}
+
+// newElector elects the replica that runs the scheduled jobs by SCHEDULER_ELECTION,
+// a replica without redis or the database runs them on its own
+func newElector(config utils.Config, cache storage.Cache, connPool *pgxpool.Pool) scheduler.Elector {
+	switch config.SchedulerElection {
+	case "postgres":
+		if connPool != nil {
+			return scheduler.NewPostgresElector(connPool, schedulerLockID)
+		}
+	case "none":
+		return scheduler.Standalone{}
+	default:
+		if cache != nil {
+			return scheduler.NewRedisElector(cache, schedulerLockKey, scheduler.LeaderTTL)
+		}
+	}
+	log.Warn().Msgf("cannot elect by %q, the scheduled jobs run on every replica", config.SchedulerElection)
+	return scheduler.Standalone{}
+}
+
+// runReconcile repairs the tasks whose info in redis disagrees with the database, e.g.,
+// go run main.go reconcile -since 24h
+func runReconcile(config utils.Config, store storage.Store, cache storage.Cache, database db.Store, args []string) {
+	flags := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	since := flags.Duration("since", 48*time.Hour, "check the tasks updated within this duration")
+	_ = flags.Parse(args)
+
+	server, err := api.NewServer(config, store, cache, database)
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot create server")
+	}
+	result, err := server.Reconcile(context.Background(), time.Now().Add(-*since))
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot reconcile tasks")
+	}
+	log.Info().
+		Int("checked", result.Checked).
+		Int("missing", result.Missing).
+		Int("repaired", result.Repaired).
+		Msg("tasks reconciled")
 }
 
-func runGinServer(config utils.Config, store storage.Store, cache storage.Cache, database db.Store) {
+func runGinServer(
+	config utils.Config,
+	store storage.Store,
+	cache storage.Cache,
+	database db.Store,
+	elector scheduler.Elector,
+) {
 	server, err := api.NewServer(config, store, cache, database)
 	if err != nil {
 		log.Fatal().Err(err).Msg("cannot create server")
@@ -66,6 +128,24 @@ func runGinServer(config utils.Config, store storage.Store, cache storage.Cache,
 			log.Fatal().Err(err).Msg("cannot start server")
 		}
 	*/
+	// Relay the outbox, and deliver the queued webhooks and task events in the background
+	workerCtx, stopWorker := context.WithCancel(context.Background())
+	defer stopWorker()
+	go server.RunOutboxRelay(workerCtx)
+	go server.RunWebhookWorker(workerCtx)
+	// The periodic jobs run on the elected replica
+	jobs := server.NewScheduler(elector)
+	jobsDone := make(chan struct{})
+	go func() {
+		defer close(jobsDone)
+		jobs.Run(workerCtx)
+	}()
+	sinkDone := make(chan struct{})
+	go func() {
+		defer close(sinkDone)
+		server.RunEventSink(workerCtx)
+	}()
+
 	httpServer := &http.Server{
 		Addr:    config.HTTPServerAddress,
 		Handler: server.Handler(),
@@ -77,7 +157,7 @@ func runGinServer(config utils.Config, store storage.Store, cache storage.Cache,
 	}()
 
 	// https://gin-gonic.com/docs/examples/graceful-restart-or-stop/
-	quit := make(chan os.Signal)
+	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	log.Info().Msg("Shutdown Server ...")
@@ -87,6 +167,10 @@ func runGinServer(config utils.Config, store storage.Store, cache storage.Cache,
 	if err := httpServer.Shutdown(ctx); err != nil {
 		log.Fatal().Err(err).Msg("server shutdown")
 	}
+	// Stop the workers after the requests are finished, so that their events are flushed
+	stopWorker()
+	<-sinkDone
+	<-jobsDone
 	// catching ctx.Done(). timeout of 10 seconds.
 	select {
 	case <-ctx.Done():
@@ -0,0 +1,134 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/HyperGAI/serving-webhook/storage"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"sync"
+	"time"
+)
+
+// Elector elects one replica as the leader, which runs the scheduled jobs
+type Elector interface {
+	// Elect tries to become or stay the leader, and returns whether this replica is the leader.
+	// It is called periodically, more often than the leadership expires.
+	Elect(ctx context.Context) (bool, error)
+	// Resign gives up the leadership, so that another replica can take over right away
+	Resign(ctx context.Context) error
+}
+
+// Standalone is the elector of a single replica, which is always the leader
+type Standalone struct{}
+
+func (Standalone) Elect(context.Context) (bool, error) { return true, nil }
+
+func (Standalone) Resign(context.Context) error { return nil }
+
+var errNotLeader = errors.New("not the leader")
+
+// RedisElector holds the leadership as a key in redis, which expires unless the
+// leader renews it
+type RedisElector struct {
+	cache storage.Cache
+	key   string
+	token string
+	ttl   time.Duration
+}
+
+func NewRedisElector(cache storage.Cache, key string, ttl time.Duration) *RedisElector {
+	return &RedisElector{cache: cache, key: key, token: uuid.NewString(), ttl: ttl}
+}
+
+func (elector *RedisElector) Elect(context.Context) (bool, error) {
+	acquired, err := elector.cache.SetKeyNX(elector.key, elector.token, elector.ttl)
+	if err != nil || acquired {
+		return acquired, err
+	}
+	// Renew the key if this replica holds it
+	err = elector.cache.UpdateKey(elector.key, func(value string) (interface{}, error) {
+		var token string
+		if e := json.Unmarshal([]byte(value), &token); e != nil || token != elector.token {
+			return nil, errNotLeader
+		}
+		return elector.token, nil
+	}, elector.ttl)
+	if errors.Is(err, errNotLeader) || errors.Is(err, storage.ErrKeyNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (elector *RedisElector) Resign(context.Context) error {
+	_, err := elector.cache.DeleteKeyIf(elector.key, elector.token)
+	return err
+}
+
+// PostgresElector holds the leadership as a session-level advisory lock on a dedicated
+// connection, which Postgres releases when the connection is closed
+type PostgresElector struct {
+	pool   *pgxpool.Pool
+	lockID int64
+	mutex  sync.Mutex
+	conn   *pgxpool.Conn
+}
+
+func NewPostgresElector(pool *pgxpool.Pool, lockID int64) *PostgresElector {
+	return &PostgresElector{pool: pool, lockID: lockID}
+}
+
+func (elector *PostgresElector) Elect(ctx context.Context) (bool, error) {
+	elector.mutex.Lock()
+	defer elector.mutex.Unlock()
+	if elector.conn != nil {
+		// The lock is held as long as the connection is alive
+		if _, err := elector.conn.Exec(ctx, "SELECT 1"); err != nil {
+			elector.closeConn()
+			return false, err
+		}
+		return true, nil
+	}
+
+	conn, err := elector.pool.Acquire(ctx)
+	if err != nil {
+		return false, err
+	}
+	var locked bool
+	if err = conn.QueryRow(ctx, "SELECT pg_try_advisory_lock($1)", elector.lockID).Scan(&locked); err != nil {
+		elector.conn = conn
+		elector.closeConn()
+		return false, err
+	}
+	if !locked {
+		conn.Release()
+		return false, nil
+	}
+	elector.conn = conn
+	return true, nil
+}
+
+func (elector *PostgresElector) Resign(ctx context.Context) error {
+	elector.mutex.Lock()
+	defer elector.mutex.Unlock()
+	if elector.conn == nil {
+		return nil
+	}
+	_, err := elector.conn.Exec(ctx, "SELECT pg_advisory_unlock($1)", elector.lockID)
+	if err != nil {
+		elector.closeConn()
+		return err
+	}
+	elector.conn.Release()
+	elector.conn = nil
+	return nil
+}
+
+// closeConn closes the connection instead of returning it to the pool, so that the lock
+// cannot be left with another user of the pool. The caller must hold the mutex.
+func (elector *PostgresElector) closeConn() {
+	_ = elector.conn.Conn().Close(context.Background())
+	elector.conn.Release()
+	elector.conn = nil
+}
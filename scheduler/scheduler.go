@@ -0,0 +1,291 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/HyperGAI/serving-webhook/storage"
+	"github.com/rs/zerolog/log"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// ElectionInterval is the time between two elections, the leadership must last longer
+	ElectionInterval = 5 * time.Second
+	// LeaderTTL is the time until the leadership expires if the leader stops renewing it
+	LeaderTTL       = 15 * time.Second
+	statusKeyPrefix = "scheduler:job:"
+)
+
+// Job is a periodic background job, which only runs on the leader
+type Job struct {
+	Name     string
+	Interval time.Duration
+	// Retry is the time until a failed run is retried, it defaults to Interval
+	Retry time.Duration
+	Run   func(ctx context.Context) error
+}
+
+// JobStatus is the last run of a job, which is kept in redis if there is one, so that
+// every replica can report it and a new leader knows when the job is due
+type JobStatus struct {
+	Name          string     `json:"name"`
+	Interval      string     `json:"interval"`
+	LastRunAt     *time.Time `json:"last_run_at,omitempty"`
+	LastDuration  string     `json:"last_duration,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	LastRunBy     string     `json:"last_run_by,omitempty"`
+	LastSuccessAt *time.Time `json:"last_success_at,omitempty"`
+	NextRunAt     *time.Time `json:"next_run_at,omitempty"`
+	Running       bool       `json:"running"`
+}
+
+// Scheduler runs the registered jobs on the elected replica, so that every run
+// happens once in the cluster
+type Scheduler struct {
+	elector    Elector
+	cache      storage.Cache
+	instanceID string
+	interval   time.Duration
+
+	mutex    sync.Mutex
+	jobs     map[string]Job
+	leader   bool
+	running  map[string]bool
+	statuses map[string]JobStatus
+}
+
+// New creates a scheduler, the statuses of the jobs are kept in memory if cache is nil
+func New(elector Elector, cache storage.Cache, instanceID string) *Scheduler {
+	return &Scheduler{
+		elector:    elector,
+		cache:      cache,
+		instanceID: instanceID,
+		interval:   ElectionInterval,
+		jobs:       make(map[string]Job),
+		running:    make(map[string]bool),
+		statuses:   make(map[string]JobStatus),
+	}
+}
+
+// Register adds a job, it must be called before Run
+func (scheduler *Scheduler) Register(job Job) {
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+	if _, ok := scheduler.jobs[job.Name]; ok {
+		panic(fmt.Sprintf("scheduler: job %s is registered twice", job.Name))
+	}
+	scheduler.jobs[job.Name] = job
+}
+
+// IsLeader returns whether this replica is the leader as of the last election
+func (scheduler *Scheduler) IsLeader() bool {
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+	return scheduler.leader
+}
+
+// InstanceID identifies this replica in the job statuses
+func (scheduler *Scheduler) InstanceID() string {
+	return scheduler.instanceID
+}
+
+// Run elects the leader periodically, and runs the due jobs while this replica is the
+// leader. The running jobs are canceled when the leadership is lost, and the leadership
+// is given up when the context is canceled.
+func (scheduler *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(scheduler.interval)
+	defer ticker.Stop()
+	jobs := newJobGroup(ctx)
+	defer func() {
+		jobs.stop()
+		scheduler.setLeader(false)
+		if err := scheduler.elector.Resign(context.Background()); err != nil {
+			log.Error().Msgf("failed to resign the leadership: %v", err)
+		}
+	}()
+
+	for {
+		leader, err := scheduler.elector.Elect(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Error().Msgf("failed to elect the leader: %v", err)
+		}
+		if scheduler.setLeader(leader) {
+			if leader {
+				log.Info().Msgf("%s is the leader of the scheduled jobs", scheduler.instanceID)
+			} else {
+				log.Info().Msgf("%s is no longer the leader, cancel the running jobs", scheduler.instanceID)
+				jobs.stop()
+				jobs = newJobGroup(ctx)
+			}
+		}
+		if leader {
+			scheduler.runDueJobs(jobs, time.Now())
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// jobGroup is the jobs started in a term of the leadership, which are canceled together
+type jobGroup struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newJobGroup(ctx context.Context) *jobGroup {
+	jobs := &jobGroup{}
+	jobs.ctx, jobs.cancel = context.WithCancel(ctx)
+	return jobs
+}
+
+// stop cancels the jobs and waits for them to return
+func (jobs *jobGroup) stop() {
+	jobs.cancel()
+	jobs.wg.Wait()
+}
+
+// setLeader records the result of an election, and returns whether it has changed
+func (scheduler *Scheduler) setLeader(leader bool) bool {
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+	changed := scheduler.leader != leader
+	scheduler.leader = leader
+	return changed
+}
+
+// runDueJobs starts the jobs that are due and not running
+func (scheduler *Scheduler) runDueJobs(jobs *jobGroup, now time.Time) {
+	for _, job := range scheduler.sortedJobs() {
+		status, err := scheduler.loadStatus(job.Name)
+		if err != nil {
+			log.Error().Msgf("failed to load the status of job %s: %v", job.Name, err)
+			continue
+		}
+		if next := nextRunAt(job, status); next != nil && now.Before(*next) {
+			continue
+		}
+		scheduler.mutex.Lock()
+		if scheduler.running[job.Name] {
+			scheduler.mutex.Unlock()
+			continue
+		}
+		scheduler.running[job.Name] = true
+		scheduler.mutex.Unlock()
+
+		jobs.wg.Add(1)
+		go func(job Job, status JobStatus) {
+			defer jobs.wg.Done()
+			scheduler.runJob(jobs.ctx, job, status)
+		}(job, status)
+	}
+}
+
+func (scheduler *Scheduler) runJob(ctx context.Context, job Job, status JobStatus) {
+	defer func() {
+		scheduler.mutex.Lock()
+		delete(scheduler.running, job.Name)
+		scheduler.mutex.Unlock()
+	}()
+	start := time.Now()
+	err := job.Run(ctx)
+	if errors.Is(err, context.Canceled) && ctx.Err() != nil {
+		// The job is interrupted and runs again on the next leader
+		return
+	}
+
+	status.Name = job.Name
+	status.LastRunAt = &start
+	status.LastDuration = time.Since(start).Round(time.Millisecond).String()
+	status.LastRunBy = scheduler.instanceID
+	status.LastError = ""
+	if err != nil {
+		status.LastError = err.Error()
+		log.Error().Msgf("job %s failed: %v", job.Name, err)
+	} else {
+		status.LastSuccessAt = &start
+	}
+	if err = scheduler.saveStatus(status); err != nil {
+		log.Error().Msgf("failed to save the status of job %s: %v", job.Name, err)
+	}
+}
+
+// nextRunAt returns when the job is due, or nil if it has never run
+func nextRunAt(job Job, status JobStatus) *time.Time {
+	if status.LastRunAt == nil {
+		return nil
+	}
+	interval := job.Interval
+	if status.LastError != "" && job.Retry > 0 && job.Retry < interval {
+		interval = job.Retry
+	}
+	next := status.LastRunAt.Add(interval)
+	return &next
+}
+
+func (scheduler *Scheduler) sortedJobs() []Job {
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+	jobs := make([]Job, 0, len(scheduler.jobs))
+	for _, job := range scheduler.jobs {
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Name < jobs[j].Name })
+	return jobs
+}
+
+func (scheduler *Scheduler) loadStatus(name string) (JobStatus, error) {
+	if scheduler.cache == nil {
+		scheduler.mutex.Lock()
+		defer scheduler.mutex.Unlock()
+		return scheduler.statuses[name], nil
+	}
+	var status JobStatus
+	value, err := scheduler.cache.GetKey(statusKeyPrefix + name)
+	if errors.Is(err, storage.ErrKeyNotFound) {
+		return status, nil
+	}
+	if err != nil {
+		return status, err
+	}
+	err = json.Unmarshal([]byte(value), &status)
+	return status, err
+}
+
+func (scheduler *Scheduler) saveStatus(status JobStatus) error {
+	if scheduler.cache == nil {
+		scheduler.mutex.Lock()
+		defer scheduler.mutex.Unlock()
+		scheduler.statuses[status.Name] = status
+		return nil
+	}
+	return scheduler.cache.SetKey(statusKeyPrefix+status.Name, status, 0)
+}
+
+// Jobs returns the statuses of the registered jobs in the order of their names.
+// Running is only known for the jobs running on this replica.
+func (scheduler *Scheduler) Jobs() ([]JobStatus, error) {
+	jobs := scheduler.sortedJobs()
+	statuses := make([]JobStatus, 0, len(jobs))
+	for _, job := range jobs {
+		status, err := scheduler.loadStatus(job.Name)
+		if err != nil {
+			return nil, err
+		}
+		status.Name = job.Name
+		status.Interval = job.Interval.String()
+		status.NextRunAt = nextRunAt(job, status)
+		scheduler.mutex.Lock()
+		status.Running = scheduler.running[job.Name]
+		scheduler.mutex.Unlock()
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
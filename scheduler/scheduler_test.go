@@ -0,0 +1,174 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"github.com/HyperGAI/serving-webhook/storage"
+	"github.com/stretchr/testify/require"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRedisElector(t *testing.T) {
+	cache := storage.NewMemoryCache()
+	first := NewRedisElector(cache, "lock:test", 50*time.Millisecond)
+	second := NewRedisElector(cache, "lock:test", 50*time.Millisecond)
+	ctx := context.Background()
+
+	leader, err := first.Elect(ctx)
+	require.NoError(t, err)
+	require.True(t, leader)
+	leader, err = second.Elect(ctx)
+	require.NoError(t, err)
+	require.False(t, leader)
+
+	// The leader renews the leadership
+	time.Sleep(30 * time.Millisecond)
+	leader, err = first.Elect(ctx)
+	require.NoError(t, err)
+	require.True(t, leader)
+	time.Sleep(30 * time.Millisecond)
+	leader, err = second.Elect(ctx)
+	require.NoError(t, err)
+	require.False(t, leader)
+
+	// Another replica takes over after the leader resigns
+	require.NoError(t, second.Resign(ctx))
+	require.NoError(t, first.Resign(ctx))
+	leader, err = second.Elect(ctx)
+	require.NoError(t, err)
+	require.True(t, leader)
+	leader, err = first.Elect(ctx)
+	require.NoError(t, err)
+	require.False(t, leader)
+
+	// Or after the leadership expires
+	time.Sleep(60 * time.Millisecond)
+	leader, err = first.Elect(ctx)
+	require.NoError(t, err)
+	require.True(t, leader)
+}
+
+func TestNextRunAt(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	job := Job{Name: "test", Interval: time.Hour, Retry: time.Minute}
+
+	require.Nil(t, nextRunAt(job, JobStatus{}))
+	require.Equal(t, now.Add(time.Hour), *nextRunAt(job, JobStatus{LastRunAt: &now}))
+	require.Equal(t, now.Add(time.Minute), *nextRunAt(job, JobStatus{LastRunAt: &now, LastError: "failed"}))
+	job.Retry = 0
+	require.Equal(t, now.Add(time.Hour), *nextRunAt(job, JobStatus{LastRunAt: &now, LastError: "failed"}))
+}
+
+func TestRegisterTwice(t *testing.T) {
+	scheduler := New(Standalone{}, nil, "test")
+	scheduler.Register(Job{Name: "test", Interval: time.Hour})
+	require.Panics(t, func() { scheduler.Register(Job{Name: "test", Interval: time.Minute}) })
+}
+
+// runScheduler runs the scheduler with a short election interval until the returned
+// function is called
+func runScheduler(scheduler *Scheduler) func() {
+	scheduler.interval = 5 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		scheduler.Run(ctx)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func TestSchedulerRunsOnce(t *testing.T) {
+	cache := storage.NewMemoryCache()
+	var runs atomic.Int32
+	job := Job{
+		Name:     "test",
+		Interval: time.Hour,
+		Run: func(ctx context.Context) error {
+			runs.Add(1)
+			return nil
+		},
+	}
+
+	// Two replicas share the leadership and the statuses in redis
+	first := New(NewRedisElector(cache, "lock:test", time.Second), cache, "first")
+	first.Register(job)
+	second := New(NewRedisElector(cache, "lock:test", time.Second), cache, "second")
+	second.Register(job)
+	stopFirst := runScheduler(first)
+	require.Eventually(t, first.IsLeader, time.Second, time.Millisecond)
+	stopSecond := runScheduler(second)
+	time.Sleep(50 * time.Millisecond)
+	require.False(t, second.IsLeader())
+	require.Equal(t, int32(1), runs.Load())
+
+	// The new leader knows the job is not due
+	stopFirst()
+	require.False(t, first.IsLeader())
+	require.Eventually(t, second.IsLeader, time.Second, time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	stopSecond()
+	require.Equal(t, int32(1), runs.Load())
+
+	statuses, err := second.Jobs()
+	require.NoError(t, err)
+	require.Len(t, statuses, 1)
+	require.Equal(t, "first", statuses[0].LastRunBy)
+	require.NotNil(t, statuses[0].LastSuccessAt)
+	require.Equal(t, statuses[0].LastRunAt.Add(time.Hour), *statuses[0].NextRunAt)
+}
+
+func TestSchedulerRetry(t *testing.T) {
+	var runs atomic.Int32
+	scheduler := New(Standalone{}, nil, "test")
+	scheduler.Register(Job{
+		Name:     "test",
+		Interval: time.Hour,
+		Retry:    10 * time.Millisecond,
+		Run: func(ctx context.Context) error {
+			if runs.Add(1) == 1 {
+				return errors.New("connection refused")
+			}
+			return nil
+		},
+	})
+	stop := runScheduler(scheduler)
+	require.Eventually(t, func() bool { return runs.Load() == 2 }, time.Second, time.Millisecond)
+	stop()
+
+	statuses, err := scheduler.Jobs()
+	require.NoError(t, err)
+	require.Empty(t, statuses[0].LastError)
+	require.NotNil(t, statuses[0].LastSuccessAt)
+}
+
+func TestSchedulerCancelsJobs(t *testing.T) {
+	started := make(chan struct{})
+	scheduler := New(Standalone{}, nil, "test")
+	scheduler.Register(Job{
+		Name:     "test",
+		Interval: time.Hour,
+		Run: func(ctx context.Context) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	})
+	stop := runScheduler(scheduler)
+	<-started
+	statuses, err := scheduler.Jobs()
+	require.NoError(t, err)
+	require.True(t, statuses[0].Running)
+	stop()
+
+	// An interrupted run is not recorded, so that the job runs again on the next leader
+	statuses, err = scheduler.Jobs()
+	require.NoError(t, err)
+	require.Nil(t, statuses[0].LastRunAt)
+	require.False(t, statuses[0].Running)
+}
@@ -3,14 +3,95 @@ package storage
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"github.com/HyperGAI/serving-webhook/utils"
 	goredis "github.com/redis/go-redis/v9"
+	"strconv"
+	"sync"
 	"time"
 )
 
+// ErrKeyNotFound is returned by GetKey when the key doesn't exist or has expired
+var ErrKeyNotFound = errors.New("key not found")
+
+// ErrUpdateConflict is returned by UpdateKey when the key keeps being modified concurrently
+var ErrUpdateConflict = errors.New("too many concurrent updates")
+
+const maxUpdateRetries = 10
+
+// deleteIfScript compares and deletes a key atomically
+var deleteIfScript = goredis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// UpdateFunc receives the current value of a key and returns the new value.
+// It may be called more than once if the key is modified concurrently.
+type UpdateFunc func(value string) (interface{}, error)
+
 type Cache interface {
 	GetKey(key string) (string, error)
 	SetKey(key string, value interface{}, expiration time.Duration) error
+	SetKeyNX(key string, value interface{}, expiration time.Duration) (bool, error)
+	UpdateKey(key string, fn UpdateFunc, expiration time.Duration) error
+	// DeleteKeyIf deletes the key only if it holds the value, and returns whether the key is deleted
+	DeleteKeyIf(key string, value interface{}) (bool, error)
+	Publish(channel string, message interface{}) error
+	Subscribe(channels ...string) (Subscription, error)
+	// AddToSortedSet adds a member to a sorted set, or updates its score
+	AddToSortedSet(key string, member string, score float64) error
+	RemoveFromSortedSet(key string, members ...string) error
+	// RangeByScore returns the members with a score up to max in the ascending order of the scores
+	RangeByScore(key string, max float64, offset int64, count int64) ([]string, error)
+}
+
+// Subscription receives the messages published to the subscribed channels
+// until it is closed
+type Subscription interface {
+	Channel() <-chan string
+	Close() error
+}
+
+type redisSubscription struct {
+	pubsub   *goredis.PubSub
+	messages chan string
+	done     chan struct{}
+	once     sync.Once
+}
+
+func newRedisSubscription(pubsub *goredis.PubSub) (Subscription, error) {
+	// Wait for the confirmation so that no messages are missed after returning
+	if _, err := pubsub.Receive(context.TODO()); err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+	subscription := &redisSubscription{
+		pubsub:   pubsub,
+		messages: make(chan string),
+		done:     make(chan struct{}),
+	}
+	go func() {
+		defer close(subscription.messages)
+		for message := range pubsub.Channel() {
+			select {
+			case subscription.messages <- message.Payload:
+			case <-subscription.done:
+				return
+			}
+		}
+	}()
+	return subscription, nil
+}
+
+func (subscription *redisSubscription) Channel() <-chan string {
+	return subscription.messages
+}
+
+func (subscription *redisSubscription) Close() error {
+	subscription.once.Do(func() { close(subscription.done) })
+	return subscription.pubsub.Close()
 }
 
 type RedisClient struct {
@@ -53,6 +134,9 @@ func NewRedisClient(config utils.Config) (Cache, error) {
 
 func (client *RedisClusterClient) GetKey(key string) (string, error) {
 	val, err := client.client.Get(context.TODO(), key).Result()
+	if errors.Is(err, goredis.Nil) {
+		return "", ErrKeyNotFound
+	}
 	if err != nil {
 		return "", err
 	}
@@ -71,8 +155,61 @@ func (client *RedisClusterClient) SetKey(key string, value interface{}, expirati
 	return nil
 }
 
+// SetKeyNX sets the key only if it doesn't exist, and returns whether the key is set
+func (client *RedisClusterClient) SetKeyNX(key string, value interface{}, expiration time.Duration) (bool, error) {
+	cacheEntry, err := json.Marshal(value)
+	if err != nil {
+		return false, err
+	}
+	return client.client.SetNX(context.TODO(), key, cacheEntry, expiration).Result()
+}
+
+func (client *RedisClusterClient) UpdateKey(key string, fn UpdateFunc, expiration time.Duration) error {
+	return updateKey(client.client, key, fn, expiration)
+}
+
+func (client *RedisClusterClient) DeleteKeyIf(key string, value interface{}) (bool, error) {
+	return deleteKeyIf(client.client, key, value)
+}
+
+func (client *RedisClusterClient) Publish(channel string, message interface{}) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	return client.client.Publish(context.TODO(), channel, data).Err()
+}
+
+func (client *RedisClusterClient) Subscribe(channels ...string) (Subscription, error) {
+	return newRedisSubscription(client.client.Subscribe(context.TODO(), channels...))
+}
+
+func (client *RedisClusterClient) AddToSortedSet(key string, member string, score float64) error {
+	return client.client.ZAdd(context.TODO(), key, goredis.Z{Score: score, Member: member}).Err()
+}
+
+func (client *RedisClusterClient) RemoveFromSortedSet(key string, members ...string) error {
+	values := make([]interface{}, len(members))
+	for i, member := range members {
+		values[i] = member
+	}
+	return client.client.ZRem(context.TODO(), key, values...).Err()
+}
+
+func (client *RedisClusterClient) RangeByScore(key string, max float64, offset int64, count int64) ([]string, error) {
+	return client.client.ZRangeByScore(context.TODO(), key, &goredis.ZRangeBy{
+		Min:    "-inf",
+		Max:    strconv.FormatFloat(max, 'f', -1, 64),
+		Offset: offset,
+		Count:  count,
+	}).Result()
+}
+
 func (client *RedisClient) GetKey(key string) (string, error) {
 	val, err := client.client.Get(context.TODO(), key).Result()
+	if errors.Is(err, goredis.Nil) {
+		return "", ErrKeyNotFound
+	}
 	if err != nil {
 		return "", err
 	}
@@ -90,3 +227,99 @@ func (client *RedisClient) SetKey(key string, value interface{}, expiration time
 	}
 	return nil
 }
+
+// SetKeyNX sets the key only if it doesn't exist, and returns whether the key is set
+func (client *RedisClient) SetKeyNX(key string, value interface{}, expiration time.Duration) (bool, error) {
+	cacheEntry, err := json.Marshal(value)
+	if err != nil {
+		return false, err
+	}
+	return client.client.SetNX(context.TODO(), key, cacheEntry, expiration).Result()
+}
+
+func (client *RedisClient) UpdateKey(key string, fn UpdateFunc, expiration time.Duration) error {
+	return updateKey(client.client, key, fn, expiration)
+}
+
+func (client *RedisClient) DeleteKeyIf(key string, value interface{}) (bool, error) {
+	return deleteKeyIf(client.client, key, value)
+}
+
+func (client *RedisClient) Publish(channel string, message interface{}) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	return client.client.Publish(context.TODO(), channel, data).Err()
+}
+
+func (client *RedisClient) Subscribe(channels ...string) (Subscription, error) {
+	return newRedisSubscription(client.client.Subscribe(context.TODO(), channels...))
+}
+
+func (client *RedisClient) AddToSortedSet(key string, member string, score float64) error {
+	return client.client.ZAdd(context.TODO(), key, goredis.Z{Score: score, Member: member}).Err()
+}
+
+func (client *RedisClient) RemoveFromSortedSet(key string, members ...string) error {
+	values := make([]interface{}, len(members))
+	for i, member := range members {
+		values[i] = member
+	}
+	return client.client.ZRem(context.TODO(), key, values...).Err()
+}
+
+func (client *RedisClient) RangeByScore(key string, max float64, offset int64, count int64) ([]string, error) {
+	return client.client.ZRangeByScore(context.TODO(), key, &goredis.ZRangeBy{
+		Min:    "-inf",
+		Max:    strconv.FormatFloat(max, 'f', -1, 64),
+		Offset: offset,
+		Count:  count,
+	}).Result()
+}
+
+// updateKey does an optimistic read-modify-write with WATCH/MULTI/EXEC,
+// and retries if the key is modified by others before EXEC.
+func updateKey(client goredis.UniversalClient, key string, fn UpdateFunc, expiration time.Duration) error {
+	ctx := context.TODO()
+	txf := func(tx *goredis.Tx) error {
+		val, err := tx.Get(ctx, key).Result()
+		if errors.Is(err, goredis.Nil) {
+			return ErrKeyNotFound
+		}
+		if err != nil {
+			return err
+		}
+		value, err := fn(val)
+		if err != nil {
+			return err
+		}
+		cacheEntry, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+			pipe.Set(ctx, key, cacheEntry, expiration)
+			return nil
+		})
+		return err
+	}
+
+	for i := 0; i < maxUpdateRetries; i++ {
+		err := client.Watch(ctx, txf, key)
+		if errors.Is(err, goredis.TxFailedErr) {
+			continue
+		}
+		return err
+	}
+	return ErrUpdateConflict
+}
+
+func deleteKeyIf(client goredis.UniversalClient, key string, value interface{}) (bool, error) {
+	cacheEntry, err := json.Marshal(value)
+	if err != nil {
+		return false, err
+	}
+	deleted, err := deleteIfScript.Run(context.TODO(), client, []string{key}, cacheEntry).Int()
+	return deleted > 0, err
+}
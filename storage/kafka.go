@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	kafkaContentType = "application/vnd.kafka.json.v2+json"
+	kafkaTimeout     = 30 * time.Second
+)
+
+// KafkaSink produces the events to a Kafka topic through the REST proxy API v2,
+// which is served by the Confluent REST Proxy and the Redpanda HTTP Proxy. The proxy
+// responds after the brokers have acknowledged the records.
+type KafkaSink struct {
+	client *http.Client
+	url    string
+}
+
+type kafkaRecord struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+type kafkaProduceRequest struct {
+	Records []kafkaRecord `json:"records"`
+}
+
+type kafkaProduceResponse struct {
+	Offsets []struct {
+		Partition int    `json:"partition"`
+		Offset    int64  `json:"offset"`
+		ErrorCode *int   `json:"error_code"`
+		Error     string `json:"error"`
+	} `json:"offsets"`
+}
+
+func NewKafkaSink(address string, topic string) (EventSink, error) {
+	u, err := url.Parse(address)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid kafka rest proxy address %q", address)
+	}
+	return &KafkaSink{
+		client: &http.Client{Timeout: kafkaTimeout},
+		url:    strings.TrimSuffix(address, "/") + "/topics/" + url.PathEscape(topic),
+	}, nil
+}
+
+func (sink *KafkaSink) Publish(ctx context.Context, message SinkMessage) error {
+	body, err := json.Marshal(kafkaProduceRequest{
+		Records: []kafkaRecord{{Key: message.Key, Value: message.Data}},
+	})
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, sink.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", kafkaContentType)
+	request.Header.Set("Accept", "application/vnd.kafka.v2+json")
+	response, err := sink.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("kafka rest proxy responded with status %d: %s", response.StatusCode, data)
+	}
+	// A record may fail even if the request succeeds
+	var res kafkaProduceResponse
+	if err = json.Unmarshal(data, &res); err != nil {
+		return err
+	}
+	for _, offset := range res.Offsets {
+		if offset.ErrorCode != nil || offset.Error != "" {
+			return fmt.Errorf("failed to produce to kafka: %s", offset.Error)
+		}
+	}
+	return nil
+}
+
+func (sink *KafkaSink) Close() error {
+	sink.client.CloseIdleConnections()
+	return nil
+}
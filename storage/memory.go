@@ -0,0 +1,253 @@
+package storage
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryCache is an in-process cache for development and tests,
+// it is selected by setting REDIS_ADDRESS to "memory"
+type MemoryCache struct {
+	mutex         sync.RWMutex
+	items         map[string]memoryItem
+	lastSweep     time.Time
+	subscriptions map[string]map[*memorySubscription]struct{}
+	sortedSets    map[string]map[string]float64
+}
+
+type memoryItem struct {
+	value    string
+	expireAt time.Time
+}
+
+func NewMemoryCache() Cache {
+	return &MemoryCache{
+		items:         make(map[string]memoryItem),
+		lastSweep:     time.Now(),
+		subscriptions: make(map[string]map[*memorySubscription]struct{}),
+		sortedSets:    make(map[string]map[string]float64),
+	}
+}
+
+func (item *memoryItem) expired(now time.Time) bool {
+	return !item.expireAt.IsZero() && !now.Before(item.expireAt)
+}
+
+func (cache *MemoryCache) GetKey(key string) (string, error) {
+	cache.mutex.RLock()
+	item, ok := cache.items[key]
+	cache.mutex.RUnlock()
+	if !ok || item.expired(time.Now()) {
+		return "", ErrKeyNotFound
+	}
+	return item.value, nil
+}
+
+func (cache *MemoryCache) SetKey(key string, value interface{}, expiration time.Duration) error {
+	cacheEntry, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	item := memoryItem{value: string(cacheEntry)}
+	if expiration > 0 {
+		item.expireAt = now.Add(expiration)
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	cache.items[key] = item
+	cache.sweep(now)
+	return nil
+}
+
+func (cache *MemoryCache) SetKeyNX(key string, value interface{}, expiration time.Duration) (bool, error) {
+	cacheEntry, err := json.Marshal(value)
+	if err != nil {
+		return false, err
+	}
+	now := time.Now()
+	item := memoryItem{value: string(cacheEntry)}
+	if expiration > 0 {
+		item.expireAt = now.Add(expiration)
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if old, ok := cache.items[key]; ok && !old.expired(now) {
+		return false, nil
+	}
+	cache.items[key] = item
+	return true, nil
+}
+
+func (cache *MemoryCache) UpdateKey(key string, fn UpdateFunc, expiration time.Duration) error {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	now := time.Now()
+	item, ok := cache.items[key]
+	if !ok || item.expired(now) {
+		return ErrKeyNotFound
+	}
+	value, err := fn(item.value)
+	if err != nil {
+		return err
+	}
+	cacheEntry, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	item = memoryItem{value: string(cacheEntry)}
+	if expiration > 0 {
+		item.expireAt = now.Add(expiration)
+	}
+	cache.items[key] = item
+	return nil
+}
+
+func (cache *MemoryCache) DeleteKeyIf(key string, value interface{}) (bool, error) {
+	cacheEntry, err := json.Marshal(value)
+	if err != nil {
+		return false, err
+	}
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	item, ok := cache.items[key]
+	if !ok || item.expired(time.Now()) || item.value != string(cacheEntry) {
+		return false, nil
+	}
+	delete(cache.items, key)
+	return true, nil
+}
+
+// Publish delivers the message to the subscribers in this process. Like redis,
+// the message is dropped for a subscriber that doesn't keep up.
+func (cache *MemoryCache) Publish(channel string, message interface{}) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	cache.mutex.RLock()
+	defer cache.mutex.RUnlock()
+	for subscription := range cache.subscriptions[channel] {
+		select {
+		case subscription.messages <- string(data):
+		default:
+		}
+	}
+	return nil
+}
+
+func (cache *MemoryCache) Subscribe(channels ...string) (Subscription, error) {
+	subscription := &memorySubscription{
+		cache:    cache,
+		channels: channels,
+		messages: make(chan string, memorySubscriptionSize),
+	}
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	for _, channel := range channels {
+		if cache.subscriptions[channel] == nil {
+			cache.subscriptions[channel] = make(map[*memorySubscription]struct{})
+		}
+		cache.subscriptions[channel][subscription] = struct{}{}
+	}
+	return subscription, nil
+}
+
+func (cache *MemoryCache) AddToSortedSet(key string, member string, score float64) error {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if cache.sortedSets[key] == nil {
+		cache.sortedSets[key] = make(map[string]float64)
+	}
+	cache.sortedSets[key][member] = score
+	return nil
+}
+
+func (cache *MemoryCache) RemoveFromSortedSet(key string, members ...string) error {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	for _, member := range members {
+		delete(cache.sortedSets[key], member)
+	}
+	if len(cache.sortedSets[key]) == 0 {
+		delete(cache.sortedSets, key)
+	}
+	return nil
+}
+
+// RangeByScore orders the members with the same score lexicographically like redis
+func (cache *MemoryCache) RangeByScore(key string, max float64, offset int64, count int64) ([]string, error) {
+	cache.mutex.RLock()
+	set := cache.sortedSets[key]
+	members := make([]string, 0, len(set))
+	for member, score := range set {
+		if score <= max {
+			members = append(members, member)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if set[members[i]] != set[members[j]] {
+			return set[members[i]] < set[members[j]]
+		}
+		return members[i] < members[j]
+	})
+	cache.mutex.RUnlock()
+
+	if offset >= int64(len(members)) {
+		return []string{}, nil
+	}
+	members = members[offset:]
+	if count >= 0 && count < int64(len(members)) {
+		members = members[:count]
+	}
+	return members, nil
+}
+
+const memorySubscriptionSize = 100
+
+type memorySubscription struct {
+	cache    *MemoryCache
+	channels []string
+	messages chan string
+	closed   bool
+}
+
+func (subscription *memorySubscription) Channel() <-chan string {
+	return subscription.messages
+}
+
+func (subscription *memorySubscription) Close() error {
+	cache := subscription.cache
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if subscription.closed {
+		return nil
+	}
+	for _, channel := range subscription.channels {
+		delete(cache.subscriptions[channel], subscription)
+		if len(cache.subscriptions[channel]) == 0 {
+			delete(cache.subscriptions, channel)
+		}
+	}
+	subscription.closed = true
+	close(subscription.messages)
+	return nil
+}
+
+// sweep removes the expired keys at most once per minute, the caller must hold the lock
+func (cache *MemoryCache) sweep(now time.Time) {
+	if now.Sub(cache.lastSweep) < time.Minute {
+		return
+	}
+	for key, item := range cache.items {
+		if item.expired(now) {
+			delete(cache.items, key)
+		}
+	}
+	cache.lastSweep = now
+}
@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryCache(t *testing.T) {
+	cache := NewMemoryCache()
+
+	_, err := cache.GetKey("12345")
+	require.ErrorIs(t, err, ErrKeyNotFound)
+
+	err = cache.SetKey("12345", map[string]string{"status": "pending"}, time.Minute)
+	require.NoError(t, err)
+	value, err := cache.GetKey("12345")
+	require.NoError(t, err)
+	require.Equal(t, `{"status":"pending"}`, value)
+
+	err = cache.SetKey("12345", map[string]string{"status": "running"}, 0)
+	require.NoError(t, err)
+	value, err = cache.GetKey("12345")
+	require.NoError(t, err)
+	require.Equal(t, `{"status":"running"}`, value)
+}
+
+func TestMemoryCacheSetKeyNX(t *testing.T) {
+	cache := NewMemoryCache()
+
+	ok, err := cache.SetKeyNX("12345", "first", 10*time.Millisecond)
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, err = cache.SetKeyNX("12345", "second", time.Minute)
+	require.NoError(t, err)
+	require.False(t, ok)
+	value, err := cache.GetKey("12345")
+	require.NoError(t, err)
+	require.Equal(t, `"first"`, value)
+
+	// The key can be set again after it expires
+	time.Sleep(20 * time.Millisecond)
+	ok, err = cache.SetKeyNX("12345", "third", time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+}
+
+func TestMemoryCacheExpiration(t *testing.T) {
+	cache := NewMemoryCache()
+
+	err := cache.SetKey("12345", "value", 10*time.Millisecond)
+	require.NoError(t, err)
+	_, err = cache.GetKey("12345")
+	require.NoError(t, err)
+
+	time.Sleep(20 * time.Millisecond)
+	_, err = cache.GetKey("12345")
+	require.ErrorIs(t, err, ErrKeyNotFound)
+}
+
+func TestMemoryCacheConcurrency(t *testing.T) {
+	cache := NewMemoryCache()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprintf("key_%d", i%5)
+			require.NoError(t, cache.SetKey(key, i, time.Minute))
+			_, err := cache.GetKey(key)
+			require.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestMemoryCacheUpdateKey(t *testing.T) {
+	cache := NewMemoryCache()
+
+	increment := func(value string) (interface{}, error) {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, err
+		}
+		return n + 1, nil
+	}
+	err := cache.UpdateKey("counter", increment, time.Minute)
+	require.ErrorIs(t, err, ErrKeyNotFound)
+
+	require.NoError(t, cache.SetKey("counter", 0, time.Minute))
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			require.NoError(t, cache.UpdateKey("counter", increment, time.Minute))
+		}()
+	}
+	wg.Wait()
+	value, err := cache.GetKey("counter")
+	require.NoError(t, err)
+	require.Equal(t, "50", value)
+
+	err = cache.UpdateKey("counter", func(value string) (interface{}, error) {
+		return nil, errors.New("failed")
+	}, time.Minute)
+	require.Error(t, err)
+	value, err = cache.GetKey("counter")
+	require.NoError(t, err)
+	require.Equal(t, "50", value)
+}
+
+func TestMemoryCachePubSub(t *testing.T) {
+	cache := NewMemoryCache()
+	require.NoError(t, cache.Publish("channel", "no subscribers"))
+
+	first, err := cache.Subscribe("channel", "other")
+	require.NoError(t, err)
+	second, err := cache.Subscribe("channel")
+	require.NoError(t, err)
+
+	require.NoError(t, cache.Publish("channel", map[string]string{"id": "12345"}))
+	require.Equal(t, `{"id":"12345"}`, <-first.Channel())
+	require.Equal(t, `{"id":"12345"}`, <-second.Channel())
+	require.NoError(t, cache.Publish("other", "message"))
+	require.Equal(t, `"message"`, <-first.Channel())
+
+	require.NoError(t, first.Close())
+	require.NoError(t, first.Close())
+	_, ok := <-first.Channel()
+	require.False(t, ok)
+	require.NoError(t, cache.Publish("channel", "message"))
+	require.Equal(t, `"message"`, <-second.Channel())
+	require.NoError(t, second.Close())
+}
+
+func TestMemoryCacheSortedSet(t *testing.T) {
+	testSortedSet(t, NewMemoryCache())
+}
+
+// testSortedSet checks the sorted sets of a cache, which behave the same in redis and in memory
+func testSortedSet(t *testing.T, cache Cache) {
+	members, err := cache.RangeByScore("tasks", 100, 0, 10)
+	require.NoError(t, err)
+	require.Empty(t, members)
+
+	require.NoError(t, cache.AddToSortedSet("tasks", "c", 30))
+	require.NoError(t, cache.AddToSortedSet("tasks", "a", 10))
+	require.NoError(t, cache.AddToSortedSet("tasks", "b", 10))
+	require.NoError(t, cache.AddToSortedSet("tasks", "d", 40))
+	// Adding a member again updates its score
+	require.NoError(t, cache.AddToSortedSet("tasks", "d", 200))
+
+	members, err = cache.RangeByScore("tasks", 100, 0, 10)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b", "c"}, members)
+	members, err = cache.RangeByScore("tasks", 100, 1, 1)
+	require.NoError(t, err)
+	require.Equal(t, []string{"b"}, members)
+	members, err = cache.RangeByScore("tasks", 100, 5, 10)
+	require.NoError(t, err)
+	require.Empty(t, members)
+
+	require.NoError(t, cache.RemoveFromSortedSet("tasks", "a", "c", "missing"))
+	members, err = cache.RangeByScore("tasks", 1000, 0, 10)
+	require.NoError(t, err)
+	require.Equal(t, []string{"b", "d"}, members)
+}
+
+func TestMemoryCacheDeleteKeyIf(t *testing.T) {
+	testDeleteKeyIf(t, NewMemoryCache())
+}
+
+// testDeleteKeyIf checks the compare-and-delete of a cache, e.g., for releasing a lock
+func testDeleteKeyIf(t *testing.T, cache Cache) {
+	deleted, err := cache.DeleteKeyIf("lock", "owner")
+	require.NoError(t, err)
+	require.False(t, deleted)
+
+	require.NoError(t, cache.SetKey("lock", "owner", time.Minute))
+	deleted, err = cache.DeleteKeyIf("lock", "other")
+	require.NoError(t, err)
+	require.False(t, deleted)
+	_, err = cache.GetKey("lock")
+	require.NoError(t, err)
+
+	deleted, err = cache.DeleteKeyIf("lock", "owner")
+	require.NoError(t, err)
+	require.True(t, deleted)
+	_, err = cache.GetKey("lock")
+	require.ErrorIs(t, err, ErrKeyNotFound)
+}
@@ -8,6 +8,7 @@ import (
 	reflect "reflect"
 	time "time"
 
+	storage "github.com/HyperGAI/serving-webhook/storage"
 	gomock "go.uber.org/mock/gomock"
 )
 
@@ -34,6 +35,35 @@ func (m *MockCache) EXPECT() *MockCacheMockRecorder {
 	return m.recorder
 }
 
+// AddToSortedSet mocks base method.
+func (m *MockCache) AddToSortedSet(arg0, arg1 string, arg2 float64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddToSortedSet", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddToSortedSet indicates an expected call of AddToSortedSet.
+func (mr *MockCacheMockRecorder) AddToSortedSet(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddToSortedSet", reflect.TypeOf((*MockCache)(nil).AddToSortedSet), arg0, arg1, arg2)
+}
+
+// DeleteKeyIf mocks base method.
+func (m *MockCache) DeleteKeyIf(arg0 string, arg1 interface{}) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteKeyIf", arg0, arg1)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteKeyIf indicates an expected call of DeleteKeyIf.
+func (mr *MockCacheMockRecorder) DeleteKeyIf(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteKeyIf", reflect.TypeOf((*MockCache)(nil).DeleteKeyIf), arg0, arg1)
+}
+
 // GetKey mocks base method.
 func (m *MockCache) GetKey(arg0 string) (string, error) {
 	m.ctrl.T.Helper()
@@ -49,6 +79,54 @@ func (mr *MockCacheMockRecorder) GetKey(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetKey", reflect.TypeOf((*MockCache)(nil).GetKey), arg0)
 }
 
+// Publish mocks base method.
+func (m *MockCache) Publish(arg0 string, arg1 interface{}) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Publish", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Publish indicates an expected call of Publish.
+func (mr *MockCacheMockRecorder) Publish(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Publish", reflect.TypeOf((*MockCache)(nil).Publish), arg0, arg1)
+}
+
+// RangeByScore mocks base method.
+func (m *MockCache) RangeByScore(arg0 string, arg1 float64, arg2, arg3 int64) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RangeByScore", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RangeByScore indicates an expected call of RangeByScore.
+func (mr *MockCacheMockRecorder) RangeByScore(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RangeByScore", reflect.TypeOf((*MockCache)(nil).RangeByScore), arg0, arg1, arg2, arg3)
+}
+
+// RemoveFromSortedSet mocks base method.
+func (m *MockCache) RemoveFromSortedSet(arg0 string, arg1 ...string) error {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0}
+	for _, a := range arg1 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "RemoveFromSortedSet", varargs...)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RemoveFromSortedSet indicates an expected call of RemoveFromSortedSet.
+func (mr *MockCacheMockRecorder) RemoveFromSortedSet(arg0 interface{}, arg1 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0}, arg1...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveFromSortedSet", reflect.TypeOf((*MockCache)(nil).RemoveFromSortedSet), varargs...)
+}
+
 // SetKey mocks base method.
 func (m *MockCache) SetKey(arg0 string, arg1 interface{}, arg2 time.Duration) error {
 	m.ctrl.T.Helper()
@@ -62,3 +140,51 @@ func (mr *MockCacheMockRecorder) SetKey(arg0, arg1, arg2 interface{}) *gomock.Ca
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetKey", reflect.TypeOf((*MockCache)(nil).SetKey), arg0, arg1, arg2)
 }
+
+// SetKeyNX mocks base method.
+func (m *MockCache) SetKeyNX(arg0 string, arg1 interface{}, arg2 time.Duration) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetKeyNX", arg0, arg1, arg2)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetKeyNX indicates an expected call of SetKeyNX.
+func (mr *MockCacheMockRecorder) SetKeyNX(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetKeyNX", reflect.TypeOf((*MockCache)(nil).SetKeyNX), arg0, arg1, arg2)
+}
+
+// Subscribe mocks base method.
+func (m *MockCache) Subscribe(arg0 ...string) (storage.Subscription, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{}
+	for _, a := range arg0 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Subscribe", varargs...)
+	ret0, _ := ret[0].(storage.Subscription)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Subscribe indicates an expected call of Subscribe.
+func (mr *MockCacheMockRecorder) Subscribe(arg0 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Subscribe", reflect.TypeOf((*MockCache)(nil).Subscribe), arg0...)
+}
+
+// UpdateKey mocks base method.
+func (m *MockCache) UpdateKey(arg0 string, arg1 storage.UpdateFunc, arg2 time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateKey", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateKey indicates an expected call of UpdateKey.
+func (mr *MockCacheMockRecorder) UpdateKey(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateKey", reflect.TypeOf((*MockCache)(nil).UpdateKey), arg0, arg1, arg2)
+}
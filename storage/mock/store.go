@@ -34,6 +34,20 @@ func (m *MockStore) EXPECT() *MockStoreMockRecorder {
 	return m.recorder
 }
 
+// DeleteObject mocks base method.
+func (m *MockStore) DeleteObject(arg0 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteObject", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteObject indicates an expected call of DeleteObject.
+func (mr *MockStoreMockRecorder) DeleteObject(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteObject", reflect.TypeOf((*MockStore)(nil).DeleteObject), arg0)
+}
+
 // PutObject mocks base method.
 func (m *MockStore) PutObject(arg0 io.Reader, arg1 string) (string, error) {
 	m.ctrl.T.Helper()
@@ -49,6 +63,20 @@ func (mr *MockStoreMockRecorder) PutObject(arg0, arg1 interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PutObject", reflect.TypeOf((*MockStore)(nil).PutObject), arg0, arg1)
 }
 
+// PutPrivateObject mocks base method.
+func (m *MockStore) PutPrivateObject(arg0 io.Reader, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PutPrivateObject", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PutPrivateObject indicates an expected call of PutPrivateObject.
+func (mr *MockStoreMockRecorder) PutPrivateObject(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PutPrivateObject", reflect.TypeOf((*MockStore)(nil).PutPrivateObject), arg0, arg1)
+}
+
 // Upload mocks base method.
 func (m *MockStore) Upload(arg0 io.Reader, arg1 string) (string, error) {
 	m.ctrl.T.Helper()
@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"context"
+	"github.com/nats-io/nats.go"
+)
+
+// NATSSink publishes the events to a JetStream stream, which must be configured
+// with the subject. The message ID is set as Nats-Msg-Id, so the stream drops
+// the duplicates within its deduplication window.
+type NATSSink struct {
+	conn    *nats.Conn
+	js      nats.JetStreamContext
+	subject string
+}
+
+func NewNATSSink(address string, subject string) (EventSink, error) {
+	if address == "" {
+		address = nats.DefaultURL
+	}
+	conn, err := nats.Connect(address, nats.Name("serving-webhook"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, err
+	}
+	js, err := conn.JetStream()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &NATSSink{conn: conn, js: js, subject: subject}, nil
+}
+
+func (sink *NATSSink) Publish(ctx context.Context, message SinkMessage) error {
+	msg := nats.NewMsg(sink.subject)
+	msg.Header.Set("Task-Id", message.Key)
+	msg.Data = message.Data
+	_, err := sink.js.PublishMsg(msg, nats.MsgId(message.ID), nats.Context(ctx))
+	return err
+}
+
+func (sink *NATSSink) Close() error {
+	return sink.conn.Drain()
+}
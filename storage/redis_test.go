@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newTestRedisClient(t *testing.T) (*RedisClient, *miniredis.Miniredis) {
+	server := miniredis.RunT(t)
+	client := goredis.NewClient(&goredis.Options{Addr: server.Addr()})
+	return &RedisClient{client: client}, server
+}
+
+func TestRedisGetKey(t *testing.T) {
+	client, _ := newTestRedisClient(t)
+
+	_, err := client.GetKey("12345")
+	require.ErrorIs(t, err, ErrKeyNotFound)
+
+	require.NoError(t, client.SetKey("12345", map[string]string{"status": "pending"}, time.Minute))
+	value, err := client.GetKey("12345")
+	require.NoError(t, err)
+	require.Equal(t, `{"status":"pending"}`, value)
+}
+
+func TestRedisSetKeyNX(t *testing.T) {
+	client, _ := newTestRedisClient(t)
+
+	ok, err := client.SetKeyNX("12345", "first", time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, err = client.SetKeyNX("12345", "second", time.Minute)
+	require.NoError(t, err)
+	require.False(t, ok)
+	value, err := client.GetKey("12345")
+	require.NoError(t, err)
+	require.Equal(t, `"first"`, value)
+}
+
+func TestRedisUpdateKey(t *testing.T) {
+	client, server := newTestRedisClient(t)
+
+	increment := func(value string) (interface{}, error) {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, err
+		}
+		return n + 1, nil
+	}
+	err := client.UpdateKey("counter", increment, time.Minute)
+	require.ErrorIs(t, err, ErrKeyNotFound)
+
+	require.NoError(t, client.SetKey("counter", 0, time.Minute))
+	require.NoError(t, client.UpdateKey("counter", increment, time.Minute))
+
+	// Modify the key between WATCH and EXEC, the update should be retried
+	calls := 0
+	err = client.UpdateKey("counter", func(value string) (interface{}, error) {
+		calls += 1
+		if calls == 1 {
+			require.NoError(t, server.Set("counter", "10"))
+		}
+		return increment(value)
+	}, time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, 2, calls)
+
+	value, err := client.GetKey("counter")
+	require.NoError(t, err)
+	require.Equal(t, "11", value)
+	require.Equal(t, time.Minute, server.TTL("counter"))
+}
+
+func TestRedisPublish(t *testing.T) {
+	client, _ := newTestRedisClient(t)
+
+	subscriber := client.client.Subscribe(context.Background(), "channel")
+	defer subscriber.Close()
+	_, err := subscriber.Receive(context.Background())
+	require.NoError(t, err)
+
+	require.NoError(t, client.Publish("channel", map[string]string{"id": "12345"}))
+	message, err := subscriber.ReceiveMessage(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, `{"id":"12345"}`, message.Payload)
+}
+
+func TestRedisSubscribe(t *testing.T) {
+	client, _ := newTestRedisClient(t)
+
+	subscription, err := client.Subscribe("channel")
+	require.NoError(t, err)
+	require.NoError(t, client.Publish("channel", map[string]string{"id": "12345"}))
+	require.Equal(t, `{"id":"12345"}`, <-subscription.Channel())
+
+	require.NoError(t, subscription.Close())
+	_, ok := <-subscription.Channel()
+	require.False(t, ok)
+}
+
+func TestRedisSortedSet(t *testing.T) {
+	client, _ := newTestRedisClient(t)
+	testSortedSet(t, client)
+}
+
+func TestRedisDeleteKeyIf(t *testing.T) {
+	client, _ := newTestRedisClient(t)
+	testDeleteKeyIf(t, client)
+}
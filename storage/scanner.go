@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"github.com/HyperGAI/serving-webhook/utils"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+const clamdChunkSize = 64 * 1024
+
+type Scanner interface {
+	Scan(fileReader io.Reader) (*ScanResult, error)
+}
+
+type ScanResult struct {
+	Infected  bool
+	Signature string
+}
+
+func NewScanner(config utils.Config) (Scanner, error) {
+	if config.ScannerAddress == "" || config.ScannerAddress == "empty" {
+		return &NoopScanner{}, nil
+	}
+	timeout := 30 * time.Second
+	if config.ScannerTimeout != "" {
+		duration, err := time.ParseDuration(config.ScannerTimeout)
+		if err != nil {
+			return nil, err
+		}
+		timeout = duration
+	}
+	return &ClamAVScanner{address: config.ScannerAddress, timeout: timeout}, nil
+}
+
+// NoopScanner accepts every file, it is used when no scanner is configured
+type NoopScanner struct{}
+
+func (scanner *NoopScanner) Scan(fileReader io.Reader) (*ScanResult, error) {
+	return &ScanResult{Infected: false}, nil
+}
+
+// ClamAVScanner streams files to a clamd daemon with the INSTREAM command
+// Check https://docs.clamav.net/manual/Usage/Scanning.html#clamd
+type ClamAVScanner struct {
+	address string
+	timeout time.Duration
+}
+
+func (scanner *ClamAVScanner) Scan(fileReader io.Reader) (*ScanResult, error) {
+	conn, err := net.DialTimeout("tcp", scanner.address, scanner.timeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to clamd, %v", err)
+	}
+	defer conn.Close()
+	if err = conn.SetDeadline(time.Now().Add(scanner.timeout)); err != nil {
+		return nil, err
+	}
+
+	if _, err = conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return nil, fmt.Errorf("failed to send command to clamd, %v", err)
+	}
+	buf := make([]byte, clamdChunkSize)
+	size := make([]byte, 4)
+	for {
+		n, e := fileReader.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size, uint32(n))
+			if _, err = conn.Write(size); err != nil {
+				return nil, fmt.Errorf("failed to send file to clamd, %v", err)
+			}
+			if _, err = conn.Write(buf[:n]); err != nil {
+				return nil, fmt.Errorf("failed to send file to clamd, %v", err)
+			}
+		}
+		if e == io.EOF {
+			break
+		}
+		if e != nil {
+			return nil, fmt.Errorf("failed to read file, %v", e)
+		}
+	}
+	// A zero-length chunk marks the end of the stream
+	binary.BigEndian.PutUint32(size, 0)
+	if _, err = conn.Write(size); err != nil {
+		return nil, fmt.Errorf("failed to send file to clamd, %v", err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read clamd reply, %v", err)
+	}
+	return parseClamdReply(reply)
+}
+
+// The reply is "stream: OK", "stream: <signature> FOUND" or "<message> ERROR"
+func parseClamdReply(reply string) (*ScanResult, error) {
+	reply = strings.TrimSpace(strings.TrimRight(reply, "\x00"))
+	switch {
+	case strings.HasSuffix(reply, " OK"):
+		return &ScanResult{Infected: false}, nil
+	case strings.HasSuffix(reply, " FOUND"):
+		signature := strings.TrimSuffix(strings.TrimPrefix(reply, "stream: "), " FOUND")
+		return &ScanResult{Infected: true, Signature: signature}, nil
+	default:
+		return nil, fmt.Errorf("clamd error: %s", reply)
+	}
+}
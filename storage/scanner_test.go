@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// runFakeClamd accepts one INSTREAM session and replies with the given message
+func runFakeClamd(t *testing.T, reply string) (string, <-chan []byte) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	received := make(chan []byte, 1)
+
+	go func() {
+		defer listener.Close()
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		if _, err = reader.ReadString(0); err != nil {
+			return
+		}
+		var data []byte
+		size := make([]byte, 4)
+		for {
+			if _, err = io.ReadFull(reader, size); err != nil {
+				return
+			}
+			n := binary.BigEndian.Uint32(size)
+			if n == 0 {
+				break
+			}
+			chunk := make([]byte, n)
+			if _, err = io.ReadFull(reader, chunk); err != nil {
+				return
+			}
+			data = append(data, chunk...)
+		}
+		received <- data
+		conn.Write([]byte(reply + "\x00"))
+	}()
+	return listener.Addr().String(), received
+}
+
+func TestClamAVScanner(t *testing.T) {
+	testCases := []struct {
+		name     string
+		reply    string
+		infected bool
+		hasError bool
+	}{
+		{name: "Clean", reply: "stream: OK", infected: false},
+		{name: "Infected", reply: "stream: Eicar-Signature FOUND", infected: true},
+		{name: "Error", reply: "INSTREAM size limit exceeded. ERROR", hasError: true},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			address, received := runFakeClamd(t, tc.reply)
+			scanner := &ClamAVScanner{address: address, timeout: 5 * time.Second}
+
+			content := strings.Repeat("a", clamdChunkSize+10)
+			result, err := scanner.Scan(strings.NewReader(content))
+			require.Equal(t, content, string(<-received))
+			if tc.hasError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.infected, result.Infected)
+			if tc.infected {
+				require.Equal(t, "Eicar-Signature", result.Signature)
+			}
+		})
+	}
+}
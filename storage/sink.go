@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"github.com/HyperGAI/serving-webhook/utils"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+const (
+	EventSinkNATS  = "nats"
+	EventSinkKafka = "kafka"
+	EventSinkRedis = "redis"
+
+	defaultEventSinkTopic = "task-events"
+	redisStreamMaxLen     = 1000000
+)
+
+// SinkMessage is an event sent to a message broker. ID is unique for each event,
+// so that consumers can drop the duplicates, and Key orders the events of one task.
+type SinkMessage struct {
+	ID   string
+	Key  string
+	Data []byte
+}
+
+// EventSink publishes events to a message broker. Publish returns nil only after
+// the broker has acknowledged the message, so a failed message can be retried.
+type EventSink interface {
+	Publish(ctx context.Context, message SinkMessage) error
+	Close() error
+}
+
+// NewEventSink creates the sink selected by EVENT_SINK, it returns nil if no sink is set
+func NewEventSink(config utils.Config) (EventSink, error) {
+	topic := config.EventSinkTopic
+	if topic == "" {
+		topic = defaultEventSinkTopic
+	}
+	switch config.EventSink {
+	case "", "empty":
+		return nil, nil
+	case EventSinkNATS:
+		return NewNATSSink(config.EventSinkAddress, topic)
+	case EventSinkKafka:
+		return NewKafkaSink(config.EventSinkAddress, topic)
+	case EventSinkRedis:
+		address := config.EventSinkAddress
+		if address == "" {
+			address = config.RedisAddress
+		}
+		return NewRedisStreamSink(address, config.RedisClusterMode, topic)
+	default:
+		return nil, fmt.Errorf("unknown event sink %q", config.EventSink)
+	}
+}
+
+// RedisStreamSink appends the events to a redis stream
+type RedisStreamSink struct {
+	client goredis.UniversalClient
+	stream string
+}
+
+func NewRedisStreamSink(address string, clusterMode bool, stream string) (EventSink, error) {
+	var client goredis.UniversalClient
+	if clusterMode {
+		client = goredis.NewClusterClient(&goredis.ClusterOptions{
+			Addrs:      []string{address},
+			MaxRetries: 10,
+		})
+	} else {
+		client = goredis.NewClient(&goredis.Options{
+			Addr:       address,
+			MaxRetries: 10,
+		})
+	}
+	if err := client.Ping(context.TODO()).Err(); err != nil {
+		return nil, err
+	}
+	return &RedisStreamSink{client: client, stream: stream}, nil
+}
+
+func (sink *RedisStreamSink) Publish(ctx context.Context, message SinkMessage) error {
+	return sink.client.XAdd(ctx, &goredis.XAddArgs{
+		Stream: sink.stream,
+		MaxLen: redisStreamMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{
+			"id":   message.ID,
+			"key":  message.Key,
+			"data": message.Data,
+		},
+	}).Err()
+}
+
+func (sink *RedisStreamSink) Close() error {
+	return sink.client.Close()
+}
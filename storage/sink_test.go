@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/HyperGAI/serving-webhook/utils"
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewEventSink(t *testing.T) {
+	sink, err := NewEventSink(utils.Config{EventSink: "empty"})
+	require.NoError(t, err)
+	require.Nil(t, sink)
+
+	_, err = NewEventSink(utils.Config{EventSink: "unknown"})
+	require.Error(t, err)
+
+	_, err = NewEventSink(utils.Config{EventSink: EventSinkKafka, EventSinkAddress: "localhost:8082"})
+	require.Error(t, err)
+
+	server := miniredis.RunT(t)
+	sink, err = NewEventSink(utils.Config{EventSink: EventSinkRedis, RedisAddress: server.Addr()})
+	require.NoError(t, err)
+	defer sink.Close()
+	require.Equal(t, defaultEventSinkTopic, sink.(*RedisStreamSink).stream)
+}
+
+func TestRedisStreamSink(t *testing.T) {
+	server := miniredis.RunT(t)
+	sink, err := NewRedisStreamSink(server.Addr(), false, "events")
+	require.NoError(t, err)
+	defer sink.Close()
+
+	for _, id := range []string{"12345-1", "12345-2"} {
+		message := SinkMessage{ID: id, Key: "12345", Data: []byte(`{"id":"` + id + `"}`)}
+		require.NoError(t, sink.Publish(context.Background(), message))
+	}
+
+	client := goredis.NewClient(&goredis.Options{Addr: server.Addr()})
+	defer client.Close()
+	entries, err := client.XRange(context.Background(), "events", "-", "+").Result()
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.Equal(t, "12345-1", entries[0].Values["id"])
+	require.Equal(t, "12345", entries[0].Values["key"])
+	require.Equal(t, `{"id":"12345-2"}`, entries[1].Values["data"])
+}
+
+func TestKafkaSink(t *testing.T) {
+	var response string
+	var statusCode int
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/topics/events", r.URL.Path)
+		require.Equal(t, kafkaContentType, r.Header.Get("Content-Type"))
+		var req kafkaProduceRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		require.Len(t, req.Records, 1)
+		require.Equal(t, "12345", req.Records[0].Key)
+		require.JSONEq(t, `{"id":"12345-1"}`, string(req.Records[0].Value))
+		w.WriteHeader(statusCode)
+		_, _ = w.Write([]byte(response))
+	}))
+	defer proxy.Close()
+
+	sink, err := NewKafkaSink(proxy.URL+"/", "events")
+	require.NoError(t, err)
+	defer sink.Close()
+	message := SinkMessage{ID: "12345-1", Key: "12345", Data: []byte(`{"id":"12345-1"}`)}
+
+	statusCode, response = http.StatusOK, `{"offsets":[{"partition":0,"offset":1}]}`
+	require.NoError(t, sink.Publish(context.Background(), message))
+
+	statusCode, response = http.StatusOK, `{"offsets":[{"partition":0,"offset":-1,"error_code":50003,"error":"timeout"}]}`
+	require.ErrorContains(t, sink.Publish(context.Background(), message), "timeout")
+
+	statusCode, response = http.StatusNotFound, `{"error_code":40401,"message":"Topic not found."}`
+	require.ErrorContains(t, sink.Publish(context.Background(), message), "404")
+}
@@ -49,3 +49,21 @@ func TestPutObject(t *testing.T) {
 	require.NoError(t, err)
 	fmt.Println(location)
 }
+
+func TestObjectKey(t *testing.T) {
+	for location, expected := range map[string]string{
+		"https://bucket.s3.us-east-2.amazonaws.com/1234.png":   "1234.png",
+		"https://bucket.s3.amazonaws.com/outputs/1234.png":     "outputs/1234.png",
+		"https://bucket.s3-accelerate.amazonaws.com/1234.png":  "1234.png",
+		"https://other.s3.us-east-2.amazonaws.com/1234.png":    "",
+		"https://bucket-2.s3.us-east-2.amazonaws.com/1234.png": "",
+		"https://bucket.s3.us-east-2.amazonaws.com/":           "",
+		"https://example.com/bucket.s3.amazonaws.com/1234.png": "",
+		"s3://bucket.s3.us-east-2.amazonaws.com/1234.png":      "",
+		"not a url at all": "",
+	} {
+		key, ok := ObjectKey("bucket", location)
+		require.Equal(t, expected, key, location)
+		require.Equal(t, expected != "", ok, location)
+	}
+}
@@ -10,11 +10,15 @@ import (
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"io"
+	"net/url"
+	"strings"
 )
 
 type Store interface {
 	Upload(fileReader io.Reader, fileKey string) (string, error)
 	PutObject(fileReader io.Reader, fileKey string) (string, error)
+	PutPrivateObject(fileReader io.Reader, fileKey string) error
+	DeleteObject(fileKey string) error
 }
 
 type S3Store struct {
@@ -83,3 +87,47 @@ func (uploader *S3Store) PutObject(fileReader io.Reader, fileKey string) (string
 		uploader.config.AWSBucket, uploader.config.AWSRegion, fileKey)
 	return location, nil
 }
+
+// PutPrivateObject uploads a file without the public-read ACL, e.g., for quarantined files
+func (uploader *S3Store) PutPrivateObject(fileReader io.Reader, fileKey string) error {
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, fileReader); err != nil {
+		return fmt.Errorf("failed to read file, %v", err)
+	}
+	_, err := uploader.svc.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String(uploader.config.AWSBucket),
+		Key:    aws.String(fileKey),
+		Body:   bytes.NewReader(buf.Bytes()),
+		ACL:    aws.String("private"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload file, %v", err)
+	}
+	return nil
+}
+
+func (uploader *S3Store) DeleteObject(fileKey string) error {
+	_, err := uploader.svc.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(uploader.config.AWSBucket),
+		Key:    aws.String(fileKey),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete file, %v", err)
+	}
+	return nil
+}
+
+// ObjectKey returns the key of an object in the bucket from its virtual-hosted-style URL,
+// e.g., the location returned by PutObject, and false if the URL is not in the bucket
+func ObjectKey(bucket string, location string) (string, bool) {
+	u, err := url.Parse(location)
+	if err != nil || bucket == "" || (u.Scheme != "https" && u.Scheme != "http") {
+		return "", false
+	}
+	host := u.Hostname()
+	if !strings.HasPrefix(host, bucket+".s3") || !strings.HasSuffix(host, ".amazonaws.com") {
+		return "", false
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+	return key, key != ""
+}
@@ -7,18 +7,39 @@ import (
 // Config stores all configuration of the application.
 // The values are read by viper from a config file or environment variable.
 type Config struct {
-	HTTPServerAddress  string `mapstructure:"HTTP_SERVER_ADDRESS"`
-	RedisAddress       string `mapstructure:"REDIS_ADDRESS"`
-	RedisClusterMode   bool   `mapstructure:"REDIS_CLUSTER_MODE"`
-	RedisKeyDuration   string `mapstructure:"REDIS_KEY_DURATION"`
-	SecretAPIKey       string `mapstructure:"SECRET_APIKEY"`
-	AWSBucket          string `mapstructure:"AWS_BUCKET"`
-	AWSRegion          string `mapstructure:"AWS_REGION"`
-	AWSS3UseAccelerate bool   `mapstructure:"AWS_S3_USE_ACCELERATE"`
-	AWSAccessKeyID     string `mapstructure:"AWS_ACCESS_KEY_ID"`
-	AWSSecretAccessKey string `mapstructure:"AWS_SECRET_ACCESS_KEY"`
-	DBSource           string `mapstructure:"DB_SOURCE"`
-	MigrationURL       string `mapstructure:"MIGRATION_URL"`
+	HTTPServerAddress      string `mapstructure:"HTTP_SERVER_ADDRESS"`
+	RedisAddress           string `mapstructure:"REDIS_ADDRESS"`
+	RedisClusterMode       bool   `mapstructure:"REDIS_CLUSTER_MODE"`
+	RedisKeyDuration       string `mapstructure:"REDIS_KEY_DURATION"`
+	RedisRepopulate        bool   `mapstructure:"REDIS_REPOPULATE"`
+	SecretAPIKey           string `mapstructure:"SECRET_APIKEY"`
+	AdminAPIKey            string `mapstructure:"ADMIN_APIKEY"`
+	AWSBucket              string `mapstructure:"AWS_BUCKET"`
+	AWSRegion              string `mapstructure:"AWS_REGION"`
+	AWSS3UseAccelerate     bool   `mapstructure:"AWS_S3_USE_ACCELERATE"`
+	AWSAccessKeyID         string `mapstructure:"AWS_ACCESS_KEY_ID"`
+	AWSSecretAccessKey     string `mapstructure:"AWS_SECRET_ACCESS_KEY"`
+	DBSource               string `mapstructure:"DB_SOURCE"`
+	MigrationURL           string `mapstructure:"MIGRATION_URL"`
+	ScannerAddress         string `mapstructure:"SCANNER_ADDRESS"`
+	ScannerTimeout         string `mapstructure:"SCANNER_TIMEOUT"`
+	ScannerAction          string `mapstructure:"SCANNER_ACTION"`
+	WebhookTimeout         string `mapstructure:"WEBHOOK_TIMEOUT"`
+	WebhookSecret          string `mapstructure:"WEBHOOK_SECRET"`
+	WebhookMaxAttempts     int    `mapstructure:"WEBHOOK_MAX_ATTEMPTS"`
+	WebhookAllowPrivate    bool   `mapstructure:"WEBHOOK_ALLOW_PRIVATE"`
+	CloudEventsSink        string `mapstructure:"K_SINK"`
+	CloudEventsMode        string `mapstructure:"CLOUDEVENTS_MODE"`
+	CloudEventsSource      string `mapstructure:"CLOUDEVENTS_SOURCE"`
+	EventSink              string `mapstructure:"EVENT_SINK"`
+	EventSinkAddress       string `mapstructure:"EVENT_SINK_ADDRESS"`
+	EventSinkTopic         string `mapstructure:"EVENT_SINK_TOPIC"`
+	TaskTimeout            string `mapstructure:"TASK_TIMEOUT"`
+	TaskModelTimeouts      string `mapstructure:"TASK_MODEL_TIMEOUTS"`
+	RetentionAge           string `mapstructure:"RETENTION_AGE"`
+	RetentionModelAges     string `mapstructure:"RETENTION_MODEL_AGES"`
+	RetentionDeleteOutputs bool   `mapstructure:"RETENTION_DELETE_OUTPUTS"`
+	SchedulerElection      string `mapstructure:"SCHEDULER_ELECTION"`
 }
 
 // LoadConfig reads configuration from file or environment variables.